@@ -0,0 +1,169 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"math"
+	"math/bits"
+)
+
+// bitUsage accumulates which bits of the decoded samples are in use.
+type bitUsage struct {
+	// Or is the bitwise or of all samples; its trailing zeros are never-used low bits.
+	or uint32
+	// Mag is the bitwise or of the sample magnitudes (one's complement for negatives).
+	mag uint32
+}
+
+func (u *bitUsage) add(data [][]int32) {
+	or, mag := u.or, u.mag
+	for _, ch := range data {
+		for _, v := range ch {
+			or |= uint32(v)
+			mag |= uint32(v ^ (v >> 31))
+		}
+	}
+	u.or, u.mag = or, mag
+}
+
+// EffectiveBitDepth returns the number of bits per sample actually carrying
+// information in the frames decoded so far.
+// It excludes low-order bits that are zero in every sample, such as those of
+// audio padded to a higher bit depth, and high-order bits that no sample's
+// magnitude reaches.
+// A file whose effective bit depth is well below BitsPerSample after a full
+// decode was likely converted up from a lower resolution.
+// It requires the decoder to be created with WithBitDepthAnalysis.
+// EffectiveBitDepth returns 0 if every decoded sample was 0,
+// or if the decoder was created without WithBitDepthAnalysis.
+func (d *Decoder) EffectiveBitDepth() int {
+	if d.usage.or == 0 {
+		return 0
+	}
+	high := bits.Len32(d.usage.mag) + 1 // Plus the sign bit.
+	if high > d.BitsPerSample {
+		high = d.BitsPerSample
+	}
+	return high - bits.TrailingZeros32(d.usage.or)
+}
+
+// countClipped returns the number of samples at the minimum or maximum
+// value representable with bps bits.
+func countClipped(data [][]int32, bps int) int64 {
+	max := int32(1)<<uint(bps-1) - 1
+	min := -max - 1
+	var n int64
+	for _, ch := range data {
+		for _, v := range ch {
+			if v == max || v == min {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// ClippedSamples returns the number of samples decoded so far that are at
+// the full-scale minimum or maximum for the stream's bit depth,
+// an indication of clipping.
+// Samples are only counted if the decoder was created with WithClipDetection.
+func (d *Decoder) ClippedSamples() int64 {
+	return d.clipped
+}
+
+// String returns the name of the channel assignment as used by ChannelAssignmentStats.
+func (c channelAssignment) String() string {
+	switch c {
+	case leftSide:
+		return "left/side"
+	case rightSide:
+		return "right/side"
+	case midSide:
+		return "mid/side"
+	default:
+		return "independent"
+	}
+}
+
+// ChannelAssignmentStats returns the number of frames decoded so far using each
+// channel assignment: "independent", "left/side", "right/side", or "mid/side".
+// Encoders choose the stereo decorrelation mode per frame, so the distribution
+// characterizes the encoder that produced the stream.
+// Assignments that no frame used are omitted.
+func (d *Decoder) ChannelAssignmentStats() map[string]int {
+	stats := make(map[string]int)
+	for c, n := range d.assignments {
+		if n > 0 {
+			stats[channelAssignment(c).String()] += n
+		}
+	}
+	return stats
+}
+
+// stereoSums accumulates the sums from which the correlation of two channels is computed.
+type stereoSums struct {
+	n, l, r, ll, rr, lr float64
+}
+
+func (s *stereoSums) add(left, right []int32) {
+	for i, l := range left {
+		fl, fr := float64(l), float64(right[i])
+		s.l += fl
+		s.r += fr
+		s.ll += fl * fl
+		s.rr += fr * fr
+		s.lr += fl * fr
+	}
+	s.n += float64(len(left))
+}
+
+func (s *stereoSums) merge(o stereoSums) {
+	s.n, s.l, s.r, s.ll, s.rr, s.lr = s.n+o.n, s.l+o.l, s.r+o.r, s.ll+o.ll, s.rr+o.rr, s.lr+o.lr
+}
+
+// correlation returns the Pearson correlation coefficient of the two channels,
+// or 0 if either is constant.
+func (s stereoSums) correlation() float64 {
+	if s.n == 0 {
+		return 0
+	}
+	vl := s.ll - s.l*s.l/s.n
+	vr := s.rr - s.r*s.r/s.n
+	if vl <= 0 || vr <= 0 {
+		return 0
+	}
+	c := (s.lr - s.l*s.r/s.n) / math.Sqrt(vl*vr)
+	return math.Max(-1, math.Min(1, c))
+}
+
+// StereoStats describes the stereo decorrelation of the frames of a two-channel
+// stream decoded so far, to help judge how efficiently the stream was encoded.
+type StereoStats struct {
+	// Independent, LeftSide, RightSide, and MidSide are the numbers of
+	// frames coded with each channel assignment.
+	Independent int
+	LeftSide    int
+	RightSide   int
+	MidSide     int
+	// Correlation is the Pearson correlation coefficient of the left and right
+	// channels over all of the frames, from -1 to 1, if the decoder was created
+	// with WithStereoAnalysis. It is 0 if either channel is constant.
+	// Highly correlated channels that were coded independently could have been
+	// coded more compactly as mid/side or left/side.
+	Correlation float64
+}
+
+// StereoMode returns the stereo decorrelation statistics of the frames decoded so far.
+// For streams that do not have two channels, it returns the zero StereoStats.
+func (d *Decoder) StereoMode() StereoStats {
+	if d.NChannels != 2 {
+		return StereoStats{}
+	}
+	return StereoStats{
+		Independent: d.assignments[1],
+		LeftSide:    d.assignments[leftSide],
+		RightSide:   d.assignments[rightSide],
+		MidSide:     d.assignments[midSide],
+		Correlation: d.stereo.correlation(),
+	}
+}
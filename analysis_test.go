@@ -0,0 +1,202 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestEffectiveBitDepth(t *testing.T) {
+	full := testRamp(500, 24, 12345)
+	upsampled := make([]int32, len(full))
+	quiet := make([]int32, len(full))
+	for i, s := range full {
+		upsampled[i] = s &^ 0xFF // 16-bit audio in a 24-bit container.
+		quiet[i] = s >> 12
+	}
+	tests := []struct {
+		samples []int32
+		depth   int
+	}{
+		{full, 24},
+		{upsampled, 16},
+		{quiet, 12},
+		{make([]int32, 10), 0},
+	}
+	for _, test := range tests {
+		data, _ := testPCMStream(96000, 24, 128, test.samples)
+		d, err := NewDecoder(bytes.NewReader(data), WithBitDepthAnalysis())
+		if err != nil {
+			t.Fatalf("Unexpected error making a new decoder: %v", err)
+		}
+		for {
+			if _, err := d.Next(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("Unexpected error decoding: %v", err)
+			}
+		}
+		if n := d.EffectiveBitDepth(); n != test.depth {
+			t.Errorf("Expected effective bit depth %d, got %d", test.depth, n)
+		}
+	}
+
+	// Without WithBitDepthAnalysis, the samples are not scanned.
+	data, _ := testPCMStream(96000, 24, 128, full)
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	if _, err := d.Next(); err != nil {
+		t.Fatalf("Unexpected error decoding: %v", err)
+	}
+	if n := d.EffectiveBitDepth(); n != 0 {
+		t.Errorf("Expected effective bit depth 0 without analysis, got %d", n)
+	}
+}
+
+func TestClippedSamples(t *testing.T) {
+	samples := []int32{0, 32767, 32767, 100, -32768, -32767, 32766}
+	data, _ := testPCMStream(44100, 16, 4, samples, samples)
+	for _, detect := range []bool{false, true} {
+		var opts []Option
+		want := int64(0)
+		if detect {
+			opts = append(opts, WithClipDetection())
+			want = 6
+		}
+		d, err := NewDecoder(bytes.NewReader(data), opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error making a new decoder: %v", err)
+		}
+		for {
+			if _, err := d.Next(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("Unexpected error decoding: %v", err)
+			}
+		}
+		if n := d.ClippedSamples(); n != want {
+			t.Errorf("Expected %d clipped samples, got %d", want, n)
+		}
+	}
+}
+
+func TestChannelAssignmentStats(t *testing.T) {
+	left, right := testRamp(16, 16, 1001), testRamp(16, 16, 77)
+	side := make([]int32, len(left))
+	for i := range side {
+		side[i] = left[i] - right[i]
+	}
+	frame := func(number uint64, assign channelAssignment, a, b []int32, bpsA, bpsB uint) []byte {
+		h := testHeader{blockSize: len(a), assign: assign, number: number}
+		return testFrame(h, func(w *bitWriter) {
+			writeVerbatim(w, bpsA, a)
+			writeVerbatim(w, bpsB, b)
+		})
+	}
+	info := StreamInfo{MinBlock: 16, MaxBlock: 16, SampleRate: 44100, NChannels: 2, BitsPerSample: 16}
+	data := testStream(info, nil,
+		frame(0, 1, left, right, 16, 16),
+		frame(1, leftSide, left, side, 16, 17),
+		frame(2, leftSide, left, side, 16, 17),
+		frame(3, rightSide, side, right, 17, 16))
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	for {
+		if _, err := d.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error decoding: %v", err)
+		}
+	}
+	want := map[string]int{"independent": 1, "left/side": 2, "right/side": 1}
+	got := d.ChannelAssignmentStats()
+	if len(got) != len(want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	for k, n := range want {
+		if got[k] != n {
+			t.Errorf("Expected %v, got %v", want, got)
+			break
+		}
+	}
+}
+
+func TestStereoMode(t *testing.T) {
+	left := testRamp(32, 16, 1001)
+	same, inverted, side := make([]int32, 32), make([]int32, 32), make([]int32, 32)
+	for i, l := range left {
+		same[i] = l / 2
+		inverted[i] = -l / 2
+		side[i] = l - same[i]
+	}
+	info := StreamInfo{MinBlock: 32, MaxBlock: 32, SampleRate: 44100, NChannels: 2, BitsPerSample: 16}
+	data := testStream(info, nil,
+		verbatimFrame(0, 16, left, same),
+		testFrame(testHeader{blockSize: 32, assign: leftSide, number: 1}, func(w *bitWriter) {
+			writeVerbatim(w, 16, left)
+			writeVerbatim(w, 17, side)
+		}),
+		verbatimFrame(2, 16, left, inverted))
+
+	for _, analyze := range []bool{false, true} {
+		var opts []Option
+		if analyze {
+			opts = append(opts, WithStereoAnalysis())
+		}
+		d, err := NewDecoder(bytes.NewReader(data), opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error making a new decoder: %v", err)
+		}
+		var frames []float64
+		for {
+			if _, err := d.Next(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("Unexpected error decoding: %v", err)
+			}
+			frames = append(frames, d.FrameInfo().Correlation)
+		}
+		want := []float64{0, 0, 0}
+		wantAll := 0.0
+		if analyze {
+			want = []float64{1, 1, -1}
+			wantAll = pearson(append(append(append([]int32{}, left...), left...), left...),
+				append(append(append([]int32{}, same...), same...), inverted...))
+		}
+		for i, c := range frames {
+			if math.Abs(c-want[i]) > 1e-3 {
+				t.Errorf("Frame %d: expected correlation %v, got %v", i, want[i], c)
+			}
+		}
+		s := d.StereoMode()
+		if s.Independent != 2 || s.LeftSide != 1 || s.RightSide != 0 || s.MidSide != 0 || math.Abs(s.Correlation-wantAll) > 1e-3 {
+			t.Errorf("Unexpected stereo stats %+v, want correlation %v", s, wantAll)
+		}
+	}
+}
+
+// pearson returns the Pearson correlation coefficient of x and y.
+func pearson(x, y []int32) float64 {
+	var mx, my float64
+	for i := range x {
+		mx += float64(x[i])
+		my += float64(y[i])
+	}
+	mx /= float64(len(x))
+	my /= float64(len(y))
+	var cov, vx, vy float64
+	for i := range x {
+		dx, dy := float64(x[i])-mx, float64(y[i])-my
+		cov += dx * dy
+		vx += dx * dx
+		vy += dy * dy
+	}
+	return cov / math.Sqrt(vx*vy)
+}
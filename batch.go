@@ -0,0 +1,77 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// DecodeFiles decodes the FLAC files at paths, up to concurrency at a time,
+// calling fn with the result of each, as Decode returns it.
+// Fn is called from the decoding goroutines, so calls for different files
+// may run at the same time.
+//
+// Once ctx is done, the files not yet started are skipped without a call of fn,
+// and the files being decoded fail with the error of ctx.
+// DecodeFiles returns when every call of fn has returned; its result is
+// ctx.Err(), as errors decoding a file are only given to fn.
+func DecodeFiles(ctx context.Context, paths []string, concurrency int, fn func(path string, pcm []byte, meta MetaData, err error)) error {
+	if concurrency < 1 {
+		return errors.New("Bad concurrency (" + strconv.Itoa(concurrency) + ")")
+	}
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency && i < len(paths); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				pcm, meta, err := decodeFile(ctx, path)
+				fn(path, pcm, meta, err)
+			}
+		}()
+	}
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case jobs <- path:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return ctx.Err()
+}
+
+// decodeFile decodes the FLAC file at path, failing once ctx is done.
+func decodeFile(ctx context.Context, path string) ([]byte, MetaData, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+	defer f.Close()
+	return Decode(contextReader{ctx: ctx, ReadSeeker: f})
+}
+
+// A contextReader is an io.ReadSeeker whose reads fail once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	io.ReadSeeker
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.ReadSeeker.Read(p)
+}
@@ -0,0 +1,86 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestDecodeFiles(t *testing.T) {
+	dir := t.TempDir()
+	want := make(map[string][]byte)
+	var paths []string
+	for i := 0; i < 8; i++ {
+		stream, pcm := testPCMStream(44100, 16, 64, testRamp(200+i, 16, 7+i), testRamp(200+i, 16, 91))
+		path := filepath.Join(dir, strconv.Itoa(i)+".flac")
+		if err := os.WriteFile(path, stream, 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		want[path] = pcm
+		paths = append(paths, path)
+	}
+	missing := filepath.Join(dir, "missing.flac")
+	paths = append(paths, missing)
+
+	var mu sync.Mutex
+	var active, maxActive int
+	got := make(map[string]error)
+	err := DecodeFiles(context.Background(), paths, 3, func(path string, pcm []byte, meta MetaData, err error) {
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		got[path] = err
+		mu.Unlock()
+
+		if err == nil && !bytes.Equal(pcm, want[path]) {
+			t.Errorf("%s: decoded data does not match", path)
+		}
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(got) != len(paths) {
+		t.Errorf("Expected %d calls, got %d", len(paths), len(got))
+	}
+	for path := range want {
+		if err := got[path]; err != nil {
+			t.Errorf("%s: unexpected error: %v", path, err)
+		}
+	}
+	if !os.IsNotExist(got[missing]) {
+		t.Errorf("Expected a missing file error, got %v", got[missing])
+	}
+	if maxActive > 3 {
+		t.Errorf("Expected at most 3 concurrent calls, got %d", maxActive)
+	}
+
+	// Cancelling in the first call skips the files not yet started.
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err = DecodeFiles(ctx, paths, 1, func(path string, pcm []byte, meta MetaData, err error) {
+		calls++
+		cancel()
+	})
+	if err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 call after cancelling, got %d", calls)
+	}
+
+	if err := DecodeFiles(context.Background(), paths, 0, nil); err == nil {
+		t.Errorf("Expected an error for a concurrency of 0")
+	}
+}
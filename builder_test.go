@@ -0,0 +1,268 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"math"
+)
+
+// A testHeader describes a frame header to be written by testFrame.
+type testHeader struct {
+	variable  bool
+	blockSize int
+	// BlockCode is the block size code; 0 selects code 7 (16-bit size at the end of the header).
+	blockCode uint64
+	// ReservedBlockCode writes the reserved block size code 0 instead.
+	reservedBlockCode bool
+	// RateCode is the sample rate code; rate is used for codes 12–14.
+	rateCode uint64
+	rate     int
+	assign   channelAssignment
+	// SizeCode is the sample size code; 0 means get it from STREAMINFO.
+	sizeCode uint64
+	number   uint64
+}
+
+func (h testHeader) write(w *bitWriter) {
+	blockCode := h.blockCode
+	if h.reservedBlockCode {
+		blockCode = 0
+	} else if blockCode == 0 {
+		blockCode = 7
+	}
+	w.write(0x3FFE, 14)
+	w.write(0, 1)
+	if h.variable {
+		w.write(1, 1)
+	} else {
+		w.write(0, 1)
+	}
+	w.write(blockCode, 4)
+	w.write(h.rateCode, 4)
+	w.write(uint64(h.assign), 4)
+	w.write(h.sizeCode, 3)
+	w.write(0, 1)
+	for _, b := range utf8Encode(h.number) {
+		w.write(uint64(b), 8)
+	}
+	switch blockCode {
+	case 6:
+		w.write(uint64(h.blockSize-1), 8)
+	case 7:
+		w.write(uint64(h.blockSize-1), 16)
+	}
+	switch h.rateCode {
+	case 12:
+		w.write(uint64(h.rate/1000), 8)
+	case 13:
+		w.write(uint64(h.rate), 16)
+	case 14:
+		w.write(uint64(h.rate/10), 16)
+	}
+	w.write(uint64(crc8(w.buf)), 8)
+}
+
+// testFrame returns an encoded frame with the given header.
+// The body function writes the subframes.
+func testFrame(h testHeader, body func(w *bitWriter)) []byte {
+	w := new(bitWriter)
+	h.write(w)
+	body(w)
+	w.align()
+	crc := crc16(w.buf)
+	w.write(uint64(crc), 16)
+	return w.bytes()
+}
+
+// writeVerbatim writes a SUBFRAME_VERBATIM of the given samples.
+func writeVerbatim(w *bitWriter, bps uint, samples []int32) {
+	w.write(0, 1)
+	w.write(uint64(subFrameVerbatim), 6)
+	w.write(0, 1)
+	for _, s := range samples {
+		w.writeSigned(int64(s), bps)
+	}
+}
+
+// verbatimFrame returns a frame of independent channels coded as verbatim subframes.
+func verbatimFrame(number uint64, bps int, chans ...[]int32) []byte {
+	h := testHeader{
+		blockSize: len(chans[0]),
+		assign:    channelAssignment(len(chans) - 1),
+		number:    number,
+	}
+	return testFrame(h, func(w *bitWriter) {
+		for _, ch := range chans {
+			writeVerbatim(w, uint(bps), ch)
+		}
+	})
+}
+
+// writeResidual writes a partitioned Rice residual with a single partition of parameter k.
+func writeResidual(w *bitWriter, residual []int32, k uint) {
+	w.write(0, 2)
+	w.write(0, 4)
+	w.write(uint64(k), 4)
+	for _, r := range residual {
+		w.writeRice(r, k)
+	}
+}
+
+// writeLPC writes a SUBFRAME_LPC predicting samples with the given coefficients.
+func writeLPC(w *bitWriter, bps uint, prec uint, shift int, coeffs, samples []int32) {
+	order := len(coeffs)
+	w.write(0, 1)
+	w.write(uint64(subFrameLPC)|uint64(order-1), 6)
+	w.write(0, 1)
+	for _, s := range samples[:order] {
+		w.writeSigned(int64(s), bps)
+	}
+	w.write(uint64(prec-1), 4)
+	w.writeSigned(int64(shift), 5)
+	for _, c := range coeffs {
+		w.writeSigned(int64(c), prec)
+	}
+	residual := make([]int32, 0, len(samples)-order)
+	for i := order; i < len(samples); i++ {
+		var sum int64
+		for j, c := range coeffs {
+			sum += int64(c) * int64(samples[i-j-1])
+		}
+		residual = append(residual, samples[i]-int32(sum>>uint(shift)))
+	}
+	writeResidual(w, residual, 12)
+}
+
+func metaBlock(kind BlockType, last bool, body []byte) []byte {
+	hdr := uint32(kind)<<24 | uint32(len(body))
+	if last {
+		hdr |= 1 << 31
+	}
+	b := make([]byte, 4, 4+len(body))
+	binary.BigEndian.PutUint32(b, hdr)
+	return append(b, body...)
+}
+
+func streamInfoBody(info StreamInfo) []byte {
+	w := new(bitWriter)
+	w.write(uint64(info.MinBlock), 16)
+	w.write(uint64(info.MaxBlock), 16)
+	w.write(uint64(info.MinFrame), 24)
+	w.write(uint64(info.MaxFrame), 24)
+	w.write(uint64(info.SampleRate), 20)
+	w.write(uint64(info.NChannels-1), 3)
+	w.write(uint64(info.BitsPerSample-1), 5)
+	w.write(uint64(info.TotalSamples), 36)
+	return append(w.bytes(), info.MD5[:]...)
+}
+
+// testStream returns a FLAC stream with a STREAMINFO block
+// followed by the given metadata blocks and frames.
+func testStream(info StreamInfo, blocks [][]byte, frames ...[]byte) []byte {
+	data := append([]byte{}, magic[:]...)
+	data = append(data, metaBlock(StreamInfoType, len(blocks) == 0, streamInfoBody(info))...)
+	for _, b := range blocks {
+		data = append(data, b...)
+	}
+	for _, f := range frames {
+		data = append(data, f...)
+	}
+	return data
+}
+
+// testPCMStream returns a valid FLAC stream encoding the given channels
+// in verbatim frames of at most blockSize samples, along with the expected decoded PCM.
+func testPCMStream(rate, bps, blockSize int, chans ...[]int32) ([]byte, []byte) {
+	n := len(chans[0])
+	info := StreamInfo{
+		MinBlock:      blockSize,
+		MaxBlock:      blockSize,
+		SampleRate:    rate,
+		NChannels:     len(chans),
+		BitsPerSample: bps,
+		TotalSamples:  int64(n),
+	}
+	var pcm []byte
+	var frames [][]byte
+	for i, num := 0, uint64(0); i < n; i, num = i+blockSize, num+1 {
+		end := i + blockSize
+		if end > n {
+			end = n
+		}
+		part := make([][]int32, len(chans))
+		for ch := range chans {
+			part[ch] = chans[ch][i:end]
+		}
+		frames = append(frames, verbatimFrame(num, bps, part...))
+		p, err := interleave(part, bps)
+		if err != nil {
+			panic(err)
+		}
+		pcm = append(pcm, p...)
+	}
+	info.MD5 = md5.Sum(pcm)
+	return testStream(info, nil, frames...), pcm
+}
+
+// testRamp returns n samples of a ramp suitable for the given bits per sample.
+func testRamp(n, bps, step int) []int32 {
+	s := make([]int32, n)
+	max := int32(1)<<uint(bps-1) - 1
+	min := -max - 1
+	v := min
+	for i := range s {
+		s[i] = v
+		v += int32(step)
+		if v > max {
+			v = min + (v - max - 1)
+		}
+	}
+	return s
+}
+
+// testTrack returns a stereo 16-bit stream of n samples per channel coded with
+// second order LPC subframes in blocks of 4096, resembling a typical CD track.
+func testTrack(n int) []byte {
+	const blockSize = 4096
+	chans := [2][]int32{make([]int32, n), make([]int32, n)}
+	seed := uint32(1)
+	for i := 0; i < n; i++ {
+		seed = seed*1664525 + 1013904223
+		noise := int32(seed>>24) - 128
+		t := float64(i) / 44100
+		chans[0][i] = int32(12000*math.Sin(2*math.Pi*440*t)) + noise
+		chans[1][i] = int32(9000*math.Sin(2*math.Pi*660*t+1)) + noise/2
+	}
+	info := StreamInfo{
+		MinBlock:      blockSize,
+		MaxBlock:      blockSize,
+		SampleRate:    44100,
+		NChannels:     2,
+		BitsPerSample: 16,
+		TotalSamples:  int64(n),
+	}
+	var pcm []byte
+	var frames [][]byte
+	for i, num := 0, uint64(0); i < n; i, num = i+blockSize, num+1 {
+		end := i + blockSize
+		if end > n {
+			end = n
+		}
+		part := [][]int32{chans[0][i:end], chans[1][i:end]}
+		h := testHeader{blockSize: end - i, assign: 1, number: num}
+		frames = append(frames, testFrame(h, func(w *bitWriter) {
+			for _, ch := range part {
+				writeLPC(w, 16, 4, 0, []int32{2, -1}, ch)
+			}
+		}))
+		p, err := interleave(part, 16)
+		if err != nil {
+			panic(err)
+		}
+		pcm = append(pcm, p...)
+	}
+	info.MD5 = md5.Sum(pcm)
+	return testStream(info, nil, frames...)
+}
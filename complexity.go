@@ -0,0 +1,130 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/eaburns/bit"
+)
+
+// Complexity is an estimate of the cost of decoding a stream, returned by EstimateComplexity.
+type Complexity struct {
+	// Score is the estimated cost of decoding a sample, relative to a sample
+	// of a verbatim subframe, which costs 1. Constant subframes cost less,
+	// and the cost of fixed and LPC subframes grows with their predictor order.
+	Score float64
+	// Cost is the estimated cost of decoding the whole stream,
+	// the score times the number of samples of all channels.
+	// It suits balancing streams of different lengths between workers.
+	Cost float64
+	// Frames is the number of frames in the stream.
+	Frames int
+	// MaxBlockSize is the largest block size of the frames.
+	MaxBlockSize int
+	// DominantType is the subframe type, such as SUBFRAME_LPC, that codes the most samples.
+	DominantType string
+	// DominantOrder is the predictor order that codes the most samples of
+	// the dominant subframe type, or 0 for constant and verbatim subframes.
+	DominantOrder int
+	// MaxLPCOrder is the highest order of the LPC subframes, or 0 if there are none.
+	MaxLPCOrder int
+}
+
+// The estimated cost of decoding a sample of each subframe type,
+// relative to a verbatim sample. Predicted samples also cost a residual,
+// and a multiply and add for each coefficient.
+const (
+	constantCost   = 0.1
+	residualCost   = 1.5
+	fixedOrderCost = 0.5
+	lpcOrderCost   = 1.0
+	verbatimCost   = 1.0
+)
+
+func sampleCost(kind subFrameKind, order int) float64 {
+	switch kind {
+	case subFrameConstant:
+		return constantCost
+	case subFrameFixed:
+		return residualCost + fixedOrderCost*float64(order)
+	case subFrameLPC:
+		return residualCost + lpcOrderCost*float64(order)
+	}
+	return verbatimCost
+}
+
+// EstimateComplexity scans the frames of a FLAC stream without decoding any
+// audio, and estimates the relative cost of decoding it from the block size
+// of each frame and the type and predictor order of its subframes.
+// Only the first subframe of each frame is read, since finding the others
+// would take decoding the residuals, and it stands for every channel of the frame.
+// The CRC8 and CRC16 checksums of every frame are verified while scanning.
+// The stream must begin at the current offset of r.
+func EstimateComplexity(r io.ReadSeeker) (Complexity, error) {
+	d, err := NewDecoder(r)
+	if err != nil {
+		return Complexity{}, err
+	}
+	type subframe struct {
+		kind  subFrameKind
+		order int
+	}
+	// Samples counts the samples of all channels coded by each kind of subframe.
+	samples := make(map[subframe]int64)
+	var c Complexity
+	var total int64
+	s := newFrameScanner(d.r, d.StreamInfo)
+	for ; ; c.Frames++ {
+		frame, h, err := s.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return Complexity{}, fmt.Errorf("Frame %d: %w", c.Frames, err)
+		}
+		hdrLen, err := frameHeaderSize(frame)
+		if err != nil {
+			return Complexity{}, fmt.Errorf("Frame %d: %w", c.Frames, err)
+		}
+		kind, order, _, err := readSubFrameHeader(bit.NewReader(bytes.NewReader(frame[hdrLen:])))
+		if err != nil {
+			return Complexity{}, fmt.Errorf("Frame %d: %w", c.Frames, err)
+		}
+
+		n := int64(h.blockSize) * int64(h.channelAssignment.nChannels())
+		samples[subframe{kind, order}] += n
+		total += n
+		c.Cost += float64(n) * sampleCost(kind, order)
+		if h.blockSize > c.MaxBlockSize {
+			c.MaxBlockSize = h.blockSize
+		}
+		if kind == subFrameLPC && order > c.MaxLPCOrder {
+			c.MaxLPCOrder = order
+		}
+	}
+	if total == 0 {
+		return c, nil
+	}
+	c.Score = c.Cost / float64(total)
+
+	byKind := make(map[subFrameKind]int64)
+	for sf, n := range samples {
+		byKind[sf.kind] += n
+	}
+	var dominant subFrameKind
+	for _, kind := range []subFrameKind{subFrameConstant, subFrameVerbatim, subFrameFixed, subFrameLPC} {
+		if byKind[kind] > byKind[dominant] || byKind[dominant] == 0 {
+			dominant = kind
+		}
+	}
+	c.DominantType = dominant.String()
+	var most int64
+	for sf, n := range samples {
+		if sf.kind == dominant && (n > most || n == most && sf.order < c.DominantOrder) {
+			c.DominantOrder, most = sf.order, n
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,48 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestEstimateComplexity(t *testing.T) {
+	samples := testRamp(64*4, 16, 1001)
+	coeffs := []int32{60, -30, 12, -5, 3, -2, 1, 1}
+	info := StreamInfo{MinBlock: 64, MaxBlock: 64, SampleRate: 44100, NChannels: 2, BitsPerSample: 16, TotalSamples: 64 * 4}
+	var frames [][]byte
+	for i := 0; i < 3; i++ {
+		part := samples[64*i : 64*(i+1)]
+		frames = append(frames, testFrame(testHeader{blockSize: 64, assign: 1, number: uint64(i)}, func(w *bitWriter) {
+			writeLPC(w, 16, 8, 5, coeffs, part)
+			writeLPC(w, 16, 8, 5, coeffs[:2], part)
+		}))
+	}
+	frames = append(frames, verbatimFrame(3, 16, samples[192:], samples[192:]))
+
+	c, err := EstimateComplexity(bytes.NewReader(testStream(info, nil, frames...)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Three frames of order 8 LPC and one verbatim frame.
+	want := (3*(residualCost+8*lpcOrderCost) + verbatimCost) / 4
+	if math.Abs(c.Score-want) > 1e-9 {
+		t.Errorf("Expected score %v, got %v", want, c.Score)
+	}
+	if math.Abs(c.Cost-want*64*4*2) > 1e-6 {
+		t.Errorf("Expected cost %v, got %v", want*64*4*2, c.Cost)
+	}
+	if c.Frames != 4 || c.MaxBlockSize != 64 || c.MaxLPCOrder != 8 {
+		t.Errorf("Expected 4 frames of 64 samples and LPC order 8, got %+v", c)
+	}
+	if c.DominantType != "SUBFRAME_LPC" || c.DominantOrder != 8 {
+		t.Errorf("Expected dominant order 8 LPC subframes, got %+v", c)
+	}
+
+	stream, _ := testPCMStream(44100, 16, 64, testRamp(100, 16, 7))
+	if c, err := EstimateComplexity(bytes.NewReader(stream)); err != nil || c.Score != verbatimCost || c.DominantType != "SUBFRAME_VERBATIM" {
+		t.Errorf("Expected verbatim subframes, got %+v, %v", c, err)
+	}
+}
@@ -0,0 +1,70 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+)
+
+// NewAutoDecoder is like NewDecoder, but it first detects a gzip or zlib
+// wrapper around the FLAC stream and transparently decompresses it.
+// Streams with no such wrapper are passed to NewDecoder unchanged.
+func NewAutoDecoder(r io.Reader, opts ...Option) (*Decoder, error) {
+	hdr, r, err := peekHeader(r, 2)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case isGzip(hdr):
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return NewDecoder(zr, opts...)
+	case isZlib(hdr):
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return NewDecoder(zr, opts...)
+	}
+	return NewDecoder(r, opts...)
+}
+
+// peekHeader returns up to the first n bytes of r without consuming them,
+// and a reader that reads from the start of r.
+// A seekable r is rewound and returned as is.
+func peekHeader(r io.Reader, n int) ([]byte, io.Reader, error) {
+	if rs, ok := r.(io.ReadSeeker); ok {
+		if start, err := rs.Seek(0, io.SeekCurrent); err == nil {
+			hdr := make([]byte, n)
+			m, err := io.ReadFull(rs, hdr)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return nil, nil, err
+			}
+			if _, err := rs.Seek(start, io.SeekStart); err != nil {
+				return nil, nil, err
+			}
+			return hdr[:m], rs, nil
+		}
+	}
+	br := bufio.NewReader(r)
+	hdr, err := br.Peek(n)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	return hdr, br, nil
+}
+
+func isGzip(hdr []byte) bool {
+	return len(hdr) >= 2 && hdr[0] == 0x1F && hdr[1] == 0x8B
+}
+
+// isZlib reports whether hdr begins with a zlib header using deflate:
+// compression method 8 and a check value making the first two bytes a multiple of 31.
+func isZlib(hdr []byte) bool {
+	return len(hdr) >= 2 && hdr[0]&0x0F == 8 && hdr[0]>>4 <= 7 && (uint16(hdr[0])<<8|uint16(hdr[1]))%31 == 0
+}
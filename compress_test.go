@@ -0,0 +1,61 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"testing"
+)
+
+func TestNewAutoDecoder(t *testing.T) {
+	stream, pcm := testPCMStream(44100, 16, 256, testRamp(1000, 16, 31), testRamp(1000, 16, 57))
+	var gz, zl bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(stream)
+	gw.Close()
+	zw := zlib.NewWriter(&zl)
+	zw.Write(stream)
+	zw.Close()
+
+	tests := []struct {
+		name string
+		r    io.Reader
+	}{
+		{"plain", bytes.NewReader(stream)},
+		{"plain unseekable", struct{ io.Reader }{bytes.NewReader(stream)}},
+		{"gzip", bytes.NewReader(gz.Bytes())},
+		{"gzip unseekable", struct{ io.Reader }{bytes.NewReader(gz.Bytes())}},
+		{"zlib", bytes.NewReader(zl.Bytes())},
+	}
+	for _, test := range tests {
+		d, err := NewAutoDecoder(test.r, WithStrict())
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		var got []byte
+		for {
+			frame, err := d.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", test.name, err)
+			}
+			got = append(got, frame...)
+		}
+		if !bytes.Equal(got, pcm) {
+			t.Errorf("%s: decoded data does not match", test.name)
+		}
+	}
+
+	if _, err := NewAutoDecoder(bytes.NewReader([]byte{0x1F, 0x8B, 0, 0})); err == nil {
+		t.Errorf("Expected an error for a truncated gzip header")
+	}
+	if _, err := NewAutoDecoder(bytes.NewReader(nil)); err == nil {
+		t.Errorf("Expected an error for an empty stream")
+	}
+}
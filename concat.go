@@ -0,0 +1,150 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Concat joins FLAC streams with the same sample rate, number of channels,
+// and bits per sample into a single stream written to w, without re-encoding.
+//
+// The stream has the metadata of the first source, except for the CUESHEET
+// and SEEKTABLE blocks, which no longer apply. Its STREAMINFO has the total
+// samples, MD5 checksum, and block and frame sizes of the joined audio.
+// The frames of each source are copied in order and renumbered to be continuous.
+// If every source but the last has a fixed block size and a whole number of
+// blocks, the frames keep a fixed block size; otherwise they are written with
+// a variable block size, numbered by their first sample.
+//
+// The STREAMINFO can only be written once every source has been decoded,
+// so if w is an io.WriteSeeker it is rewritten in place at the end;
+// otherwise the frames are held in memory until then.
+func Concat(w io.Writer, sources ...io.Reader) error {
+	if len(sources) == 0 {
+		return errors.New("No streams to concatenate")
+	}
+	decoders := make([]*Decoder, len(sources))
+	for i, src := range sources {
+		d, err := NewDecoder(src, WithRawMetadata(), WithFullFinalFrame())
+		if err != nil {
+			return fmt.Errorf("Stream %d: %w", i, err)
+		}
+		defer d.Close()
+		decoders[i] = d
+	}
+	first := decoders[0]
+	info := *first.StreamInfo
+	fixed := true
+	for i, d := range decoders {
+		if d.SampleRate != info.SampleRate || d.NChannels != info.NChannels || d.BitsPerSample != info.BitsPerSample {
+			return errors.New("Stream " + strconv.Itoa(i) + " has " + strconv.Itoa(d.SampleRate) + " Hz, " +
+				strconv.Itoa(d.NChannels) + " channels, and " + strconv.Itoa(d.BitsPerSample) + " bits per sample, but stream 0 has " +
+				strconv.Itoa(info.SampleRate) + " Hz, " + strconv.Itoa(info.NChannels) + " channels, and " +
+				strconv.Itoa(info.BitsPerSample) + " bits per sample")
+		}
+		if d.MinBlock != d.MaxBlock || d.MaxBlock != info.MaxBlock ||
+			(i < len(decoders)-1 && (d.TotalSamples == 0 || d.TotalSamples%int64(d.MaxBlock) != 0)) {
+			fixed = false
+		}
+	}
+
+	// Frames are written to out, which is w if the STREAMINFO can be rewritten afterwards.
+	out := w
+	ws, seekable := w.(io.WriteSeeker)
+	var start int64
+	var held bytes.Buffer
+	if seekable {
+		var err error
+		if start, err = ws.Seek(0, io.SeekCurrent); err != nil {
+			return err
+		}
+		if err := writeHeader(w, first.Blocks, info); err != nil {
+			return err
+		}
+	} else {
+		out = &held
+	}
+
+	h := md5.New()
+	var n uint64
+	var total int64
+	// Last is the block size of the last frame, which does not count towards the minimum.
+	var last int
+	info.MinBlock, info.MaxBlock, info.MinFrame, info.MaxFrame = 0, 0, 0, 0
+	for i, d := range decoders {
+		for {
+			data, err := d.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("Stream %d: %w", i, err)
+			}
+			f := d.currentFrame()
+			if fixed && (f.VariableBlockSize || (last != 0 && last != info.MaxBlock)) {
+				return errors.New("Stream " + strconv.Itoa(i) + ": frame " + strconv.FormatUint(f.Number, 10) +
+					" breaks the fixed block size of " + strconv.Itoa(info.MaxBlock))
+			}
+			number := n
+			if !fixed {
+				d.in.buf[1] |= 1 // Variable block size.
+				number = uint64(total)
+			}
+			frame, err := renumberFrame(d.in.buf, number)
+			if err != nil {
+				return err
+			}
+			if _, err := out.Write(frame); err != nil {
+				return err
+			}
+			h.Write(data)
+
+			if last != 0 && (info.MinBlock == 0 || last < info.MinBlock) {
+				info.MinBlock = last
+			}
+			if f.BlockSize > info.MaxBlock {
+				info.MaxBlock = f.BlockSize
+			}
+			if info.MinFrame == 0 || len(frame) < info.MinFrame {
+				info.MinFrame = len(frame)
+			}
+			if len(frame) > info.MaxFrame {
+				info.MaxFrame = len(frame)
+			}
+			last = f.BlockSize
+			total += int64(f.BlockSize)
+			n++
+		}
+	}
+	if info.MinBlock == 0 {
+		// There is at most one frame.
+		info.MinBlock = info.MaxBlock
+	}
+	info.TotalSamples = total
+	copy(info.MD5[:], h.Sum(nil))
+
+	if !seekable {
+		if err := writeHeader(w, first.Blocks, info); err != nil {
+			return err
+		}
+		_, err := held.WriteTo(w)
+		return err
+	}
+	end, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := ws.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	if err := writeHeader(w, first.Blocks, info); err != nil {
+		return err
+	}
+	_, err = ws.Seek(end, io.SeekStart)
+	return err
+}
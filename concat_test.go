@@ -0,0 +1,87 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConcat(t *testing.T) {
+	tests := []struct {
+		name     string
+		lengths  []int
+		variable bool
+	}{
+		{"whole blocks", []int{128, 64, 100}, false},
+		{"partial blocks", []int{100, 150, 30}, true},
+		{"single stream", []int{100}, false},
+	}
+	for _, test := range tests {
+		var sources []io.Reader
+		var pcm []byte
+		for i, n := range test.lengths {
+			stream, p := testPCMStream(44100, 16, 64, testRamp(n, 16, 7+i), testRamp(n, 16, 91-i))
+			sources = append(sources, bytes.NewReader(stream))
+			pcm = append(pcm, p...)
+		}
+		var buf bytes.Buffer
+		if err := Concat(&buf, sources...); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		got, meta, err := Decode(bytes.NewReader(buf.Bytes()), WithStrict())
+		if err != nil {
+			t.Fatalf("%s: unexpected error decoding: %v", test.name, err)
+		}
+		if !bytes.Equal(got, pcm) {
+			t.Errorf("%s: decoded data does not match", test.name)
+		}
+		if meta.TotalSamples != int64(len(pcm)/4) {
+			t.Errorf("%s: expected %d total samples, got %d", test.name, len(pcm)/4, meta.TotalSamples)
+		}
+		desc, err := Describe(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		for _, f := range desc.Frames {
+			if f.VariableBlockSize != test.variable {
+				t.Errorf("%s: expected variable block size %v, got %+v", test.name, test.variable, f.FrameInfo)
+			}
+		}
+	}
+
+	a, _ := testPCMStream(44100, 16, 64, testRamp(100, 16, 7))
+	b, _ := testPCMStream(48000, 16, 64, testRamp(100, 16, 7))
+	if err := Concat(io.Discard, bytes.NewReader(a), bytes.NewReader(b)); err == nil {
+		t.Errorf("Expected an error concatenating streams of different sample rates")
+	}
+}
+
+func TestConcatSeekable(t *testing.T) {
+	a, pa := testPCMStream(44100, 16, 64, testRamp(100, 16, 7))
+	b, pb := testPCMStream(44100, 16, 64, testRamp(150, 16, 11))
+	f, err := os.Create(filepath.Join(t.TempDir(), "concat.flac"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer f.Close()
+	if err := Concat(f, bytes.NewReader(a), bytes.NewReader(b)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, meta, err := Decode(f)
+	if err != nil {
+		t.Fatalf("Unexpected error decoding: %v", err)
+	}
+	if want := append(pa, pb...); !bytes.Equal(got, want) {
+		t.Errorf("Decoded data does not match")
+	}
+	if meta.TotalSamples != 250 {
+		t.Errorf("Expected 250 total samples, got %d", meta.TotalSamples)
+	}
+}
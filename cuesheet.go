@@ -0,0 +1,112 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// CueSheet is the content of a CUESHEET metadata block,
+// typically describing the tracks of a CD image.
+type CueSheet struct {
+	// MediaCatalogNumber is the media catalog number, such as the UPC/EAN code of a CD.
+	MediaCatalogNumber string
+	// LeadIn is the number of lead-in samples of a CD.
+	LeadIn uint64
+	// CDDA is whether the cuesheet corresponds to a Compact Disc.
+	CDDA bool
+	// Tracks are the tracks in stream order. The last is the lead-out track.
+	Tracks []CueTrack
+}
+
+// CueTrack is a track of a CueSheet.
+type CueTrack struct {
+	// Offset is the offset in samples of the track from the start of the stream.
+	Offset uint64
+	// Number is the track number; the lead-out track is 170 for a CD and 255 otherwise.
+	Number uint8
+	ISRC   string
+	// Audio is false for a non-audio (data) track.
+	Audio       bool
+	PreEmphasis bool
+	// Indices are the index points of the track.
+	Indices []CueIndex
+}
+
+// CueIndex is an index point of a CueTrack.
+type CueIndex struct {
+	// Offset is the offset in samples of the index point from the start of its track.
+	Offset uint64
+	Number uint8
+}
+
+// IsLeadOut returns whether t is the lead-out track of the cuesheet:
+// track 170 of a CD-DA cuesheet, or track 255 of any other.
+// On a cuesheet that is not CD-DA, track 170 is an ordinary track.
+func (cs *CueSheet) IsLeadOut(t CueTrack) bool {
+	if cs.CDDA {
+		return t.Number == 170
+	}
+	return t.Number == 255
+}
+
+// Sizes of the fixed-length parts of a CUESHEET block.
+const (
+	cueSheetHeaderSize = 128 + 8 + 259 + 1
+	cueTrackSize       = 8 + 1 + 12 + 14 + 1
+	cueIndexSize       = 8 + 1 + 3
+)
+
+func readCueSheet(r io.Reader) (*CueSheet, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < cueSheetHeaderSize {
+		return nil, errors.New("Truncated CUESHEET block")
+	}
+	cs := &CueSheet{
+		MediaCatalogNumber: cueString(data[:128]),
+		LeadIn:             binary.BigEndian.Uint64(data[128:]),
+		CDDA:               data[136]&0x80 != 0,
+	}
+	nTracks := int(data[395])
+	data = data[cueSheetHeaderSize:]
+	cs.Tracks = make([]CueTrack, 0, nTracks)
+	for i := 0; i < nTracks; i++ {
+		if len(data) < cueTrackSize {
+			return nil, errors.New("Truncated CUESHEET track")
+		}
+		t := CueTrack{
+			Offset:      binary.BigEndian.Uint64(data),
+			Number:      data[8],
+			ISRC:        cueString(data[9:21]),
+			Audio:       data[21]&0x80 == 0,
+			PreEmphasis: data[21]&0x40 != 0,
+		}
+		nIndices := int(data[35])
+		data = data[cueTrackSize:]
+		if len(data) < nIndices*cueIndexSize {
+			return nil, errors.New("Truncated CUESHEET track index")
+		}
+		t.Indices = make([]CueIndex, nIndices)
+		for j := range t.Indices {
+			t.Indices[j] = CueIndex{Offset: binary.BigEndian.Uint64(data), Number: data[8]}
+			data = data[cueIndexSize:]
+		}
+		cs.Tracks = append(cs.Tracks, t)
+	}
+	return cs, nil
+}
+
+// cueString returns the NUL-padded ASCII string in b.
+func cueString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -0,0 +1,88 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+// cueSheetBody returns the body of a CUESHEET block.
+func cueSheetBody(cs CueSheet) []byte {
+	b := make([]byte, cueSheetHeaderSize)
+	copy(b, cs.MediaCatalogNumber)
+	binary.BigEndian.PutUint64(b[128:], cs.LeadIn)
+	if cs.CDDA {
+		b[136] = 0x80
+	}
+	b[395] = byte(len(cs.Tracks))
+	for _, t := range cs.Tracks {
+		tb := make([]byte, cueTrackSize)
+		binary.BigEndian.PutUint64(tb, t.Offset)
+		tb[8] = t.Number
+		copy(tb[9:21], t.ISRC)
+		if !t.Audio {
+			tb[21] |= 0x80
+		}
+		if t.PreEmphasis {
+			tb[21] |= 0x40
+		}
+		tb[35] = byte(len(t.Indices))
+		b = append(b, tb...)
+		for _, idx := range t.Indices {
+			ib := make([]byte, cueIndexSize)
+			binary.BigEndian.PutUint64(ib, idx.Offset)
+			ib[8] = idx.Number
+			b = append(b, ib...)
+		}
+	}
+	return b
+}
+
+func TestCueSheet(t *testing.T) {
+	want := CueSheet{
+		MediaCatalogNumber: "1234567890123",
+		LeadIn:             88200,
+		CDDA:               true,
+		Tracks: []CueTrack{
+			{Offset: 0, Number: 1, ISRC: "USRC17607839", Audio: true, Indices: []CueIndex{{Offset: 0, Number: 0}, {Offset: 588, Number: 1}}},
+			{Offset: 44100, Number: 2, Audio: false, PreEmphasis: true, Indices: []CueIndex{{Number: 1}}},
+			{Offset: 88200, Number: 170},
+		},
+	}
+	info := StreamInfo{MinBlock: 16, MaxBlock: 16, SampleRate: 44100, NChannels: 2, BitsPerSample: 16}
+	data := testStream(info, [][]byte{metaBlock(CueSheetType, true, cueSheetBody(want))})
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if d.CueSheet == nil {
+		t.Fatalf("Expected a cuesheet")
+	}
+	if fmt.Sprintf("%+v", *d.CueSheet) != fmt.Sprintf("%+v", want) {
+		t.Errorf("Expected %+v, got %+v", want, *d.CueSheet)
+	}
+	for i, tr := range d.CueSheet.Tracks {
+		if d.CueSheet.IsLeadOut(tr) != (i == len(want.Tracks)-1) {
+			t.Errorf("Track %d: expected lead-out %v, got %v", i, i == len(want.Tracks)-1, d.CueSheet.IsLeadOut(tr))
+		}
+	}
+
+	notCD := &CueSheet{}
+	if !notCD.IsLeadOut(CueTrack{Number: 255}) || notCD.IsLeadOut(CueTrack{Number: 170}) {
+		t.Errorf("Expected only track 255 to be the lead-out of a cuesheet that is not CD-DA")
+	}
+	if want.IsLeadOut(CueTrack{Number: 255}) {
+		t.Errorf("Expected track 255 not to be the lead-out of a CD-DA cuesheet")
+	}
+
+	body := cueSheetBody(want)
+	for _, n := range []int{cueSheetHeaderSize - 1, cueSheetHeaderSize + cueTrackSize - 1, len(body) - 1} {
+		bad := testStream(info, [][]byte{metaBlock(CueSheetType, true, body[:n])})
+		if _, err := NewDecoder(bytes.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error for a CUESHEET block truncated to %d bytes", n)
+		}
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"crypto/md5"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"strconv"
@@ -19,42 +21,247 @@ import (
 
 var magic = [4]byte{'f', 'L', 'a', 'C'}
 
+// frameBuffers are the buffers used to decode frames.
+// They are shared between decoders through frameBufferPool.
+type frameBuffers struct {
+	// Raw holds the bytes of the current frame, for checking its CRCs.
+	raw []byte
+	// Samples holds the decoded samples of each channel of the current frame.
+	samples [][]int32
+	scratch subframeScratch[int32]
+	// Wide holds the 64-bit samples of each channel of a 32-bit frame before decorrelation.
+	wide        [][]int64
+	wideScratch subframeScratch[int64]
+}
+
+// A sample is the type of decoded samples: int32, or int64 for 32-bit
+// streams, whose side channel has 33 bits.
+type sample interface {
+	int32 | int64
+}
+
+// A subframeScratch holds the buffers used while decoding a subframe, reused
+// from one subframe to the next. Frames are independent, so goroutines can
+// decode frames in parallel as long as each has its own.
+type subframeScratch[T sample] struct {
+	warm             []T
+	coeffs, residual []int32
+}
+
 var frameBufferPool = sync.Pool{
 	New: func() interface{} {
-		return make([]int32, 0, 65536) // Common frame size
+		return &frameBuffers{raw: make([]byte, 0, 4096)}
 	},
 }
 
+// A captureReader reads from r, appending the bytes read to buf if capture is set.
+// A frame is read through a single captureReader so that its bytes are
+// captured once, for checking the CRCs, as it is parsed.
+type captureReader struct {
+	r       io.Reader
+	buf     []byte
+	capture bool
+	// N is the number of bytes read.
+	n int64
+}
+
+func (c *captureReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if c.capture {
+		c.buf = append(c.buf, p[:n]...)
+	}
+	return n, err
+}
+
 // Decode reads a FLAC file, decodes it, verifies its MD5 checksum, and returns the data and metadata.
-func Decode(r io.Reader) ([]byte, MetaData, error) {
-	d, err := NewDecoder(r)
+// A stream whose encoder did not compute the MD5 checksum, leaving it all zeros,
+// is not verified; see StreamInfo.HasMD5.
+func Decode(r io.Reader, opts ...Option) ([]byte, MetaData, error) {
+	data, meta, err := decode(r, opts)
 	if err != nil {
 		return nil, MetaData{}, err
 	}
+	return data, meta, nil
+}
+
+// DecodePartial is like Decode, but if an error is encountered after the header,
+// it returns the data decoded before the error along with the metadata and the error.
+// This allows best-effort use of damaged files.
+// If the data is complete but its MD5 checksum does not match, the data is returned
+// with the error.
+func DecodePartial(r io.Reader, opts ...Option) ([]byte, MetaData, error) {
+	return decode(r, opts)
+}
+
+// decode decodes a FLAC file, returning the data decoded before any error in the frames.
+func decode(r io.Reader, opts []Option) ([]byte, MetaData, error) {
+	d, err := NewDecoder(r, opts...)
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+	defer d.Close()
 
 	// Pre-calculate approximate capacity based on audio specs
-	expectedSize := d.TotalSamples * int64(d.NChannels) * int64(d.BitsPerSample/8)
+	samples := d.TotalSamples
+	if !d.HasTotalSamples() {
+		// The length is unknown: start with a second of audio, and grow by doubling.
+		samples = int64(d.SampleRate)
+	}
+	expectedSize := samples * int64(d.NChannels) * int64(bytesPerSample(d.BitsPerSample))
+	if left := d.mem.remaining(); left >= 0 && expectedSize > left {
+		// Don't trust the header to reserve the whole budget up front.
+		expectedSize = left
+	}
+	if err := d.mem.alloc(expectedSize); err != nil {
+		return nil, d.MetaData, err
+	}
 	data := make([]byte, 0, expectedSize)
+
+	// The MD5 checksum is of the original samples.
+	verify := d.HasMD5() && d.resampler == nil && d.transform == nil && !d.reducesTo16()
+	// The audio is hashed a frame at a time, rather than all of data at the end,
+	// so that converting it for hashing does not copy the whole stream.
+	var h hash.Hash
+	var async *asyncHash
+	if verify && d.asyncMD5 {
+		async = newAsyncHash(md5.New())
+		defer async.Close()
+	} else if verify {
+		h = md5.New()
+	}
 	for {
 		frame, err := d.Next()
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return nil, MetaData{}, err
+			return data, d.MetaData, err
+		}
+		if len(data)+len(frame) > cap(data) {
+			grown, err := d.grow(data, len(frame))
+			if err != nil {
+				return data, d.MetaData, err
+			}
+			data = grown
 		}
 		data = append(data, frame...)
+		if async != nil {
+			async.Write(d.md5Data(frame))
+		} else if h != nil {
+			h.Write(d.md5Data(frame))
+		}
 	}
 
-	h := md5.New()
-	if _, err := h.Write(data); err != nil {
-		return nil, MetaData{}, err
+	if !verify {
+		return data, d.MetaData, nil
 	}
-	if !bytes.Equal(h.Sum(nil), d.MD5[:]) {
-		return nil, MetaData{}, errors.New("Bad MD5 checksum")
+	var sum []byte
+	if async != nil {
+		sum = async.Sum()
+	} else {
+		sum = h.Sum(nil)
+	}
+	if !bytes.Equal(sum, d.MD5[:]) {
+		return data, d.MetaData, errors.New("Bad MD5 checksum")
 	}
 	return data, d.MetaData, nil
 }
 
+// DecodeStreaming decodes the remaining frames, writing their interleaved audio
+// data to w through a staging buffer of bufSize bytes that is reused for the whole
+// stream, so that, unlike Decode, memory use does not grow with the length of the stream.
+// Frames larger than the buffer are written directly.
+// If the decoder is at the start of the stream, the MD5 checksum of the audio is
+// verified as by Decode, after all of it is written.
+func (d *Decoder) DecodeStreaming(w io.Writer, bufSize int) error {
+	if bufSize <= 0 {
+		return errors.New("Bad buffer size (" + strconv.Itoa(bufSize) + ")")
+	}
+	if err := d.mem.alloc(int64(bufSize)); err != nil {
+		return err
+	}
+	bw := bufio.NewWriterSize(w, bufSize)
+	// The MD5 checksum is of all of the original samples.
+	verify := d.HasMD5() && d.currentFrame().BlockSize == 0 && d.resampler == nil && d.transform == nil && d.channels == nil && !d.reducesTo16()
+	h := md5.New()
+	for {
+		frame, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if _, err := bw.Write(frame); err != nil {
+			return err
+		}
+		if verify {
+			h.Write(d.md5Data(frame))
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if verify && !bytes.Equal(h.Sum(nil), d.MD5[:]) {
+		return errors.New("Bad MD5 checksum")
+	}
+	return nil
+}
+
+// Peek reads the FLAC header information and decodes only the first frame,
+// returning the metadata and the audio data of that frame.
+// If the stream has no frames, the returned data is empty and the error is nil.
+func Peek(r io.Reader, opts ...Option) (MetaData, []byte, error) {
+	d, err := NewDecoder(r, opts...)
+	if err != nil {
+		return MetaData{}, nil, err
+	}
+	defer d.Close()
+	frame, err := d.Next()
+	if err == io.EOF {
+		return d.MetaData, []byte{}, nil
+	} else if err != nil {
+		return MetaData{}, nil, err
+	}
+	return d.MetaData, frame, nil
+}
+
+// DecodeFrame decodes the frame at the start of b, for a stream described by info.
+// It returns the interleaved audio data of the frame, information about the frame,
+// and the number of bytes of b that the frame occupies.
+// The CRC8 and CRC16 checksums of the frame are verified.
+// If b is empty, DecodeFrame returns io.EOF;
+// if b holds only part of a frame, the error wraps io.ErrUnexpectedEOF.
+func DecodeFrame(b []byte, info StreamInfo) ([]byte, FrameInfo, int, error) {
+	d := newFrameDecoder(bufio.NewReader(bytes.NewReader(b)), info)
+	defer d.Close()
+	data, err := d.Next()
+	if err != nil {
+		return nil, FrameInfo{}, 0, err
+	}
+	return data, d.FrameInfo(), len(d.in.buf), nil
+}
+
+// grow returns data with room for at least n more bytes,
+// charging the added capacity to the decoder's memory budget.
+func (d *Decoder) grow(data []byte, n int) ([]byte, error) {
+	c := 2 * cap(data)
+	if c < len(data)+n {
+		c = len(data) + n
+	}
+	if left := d.mem.remaining(); left >= 0 && int64(c-cap(data)) > left {
+		c = cap(data) + int(left)
+	}
+	if c < len(data)+n {
+		return nil, ErrMemoryLimit
+	}
+	if err := d.mem.alloc(int64(c - cap(data))); err != nil {
+		return nil, err
+	}
+	grown := make([]byte, len(data), c)
+	copy(grown, data)
+	return grown, nil
+}
+
 // A Decoder decodes a FLAC audio file.
 // Unlike the Decode function, a decoder can decode the file incrementally,
 // one frame at a time.
@@ -64,23 +271,196 @@ type Decoder struct {
 	n int
 
 	MetaData
-	// Add reusable buffers
-	rawBuffer   *bytes.Buffer
-	frameBuffer []int32
+	// Bufs are the frame buffers, acquired from frameBufferPool
+	// on the first call to Next and released by Close.
+	bufs *frameBuffers
+
+	// In reads the current frame, capturing its bytes for checking the CRCs.
+	in captureReader
+
+	log              Logger
+	mem              memBudget
+	strict           bool
+	noCRC            bool
+	ignoreCRC        bool
+	lenientBlockSize bool
+	fullFinalFrame   bool
+	asyncMD5         bool
+	rawMetadata      bool
+	// Frame describes the most recently decoded frame.
+	// Its Subframes are held in subframes, which the next frame reuses.
+	frame     FrameInfo
+	subframes []SubframeInfo
+	// Err is the error that ended iteration by Samples.
+	err error
+
+	// DetectLast is whether to peek past each frame to set FrameInfo.IsLast.
+	detectLast       bool
+	bitDepthAnalysis bool
+	usage            bitUsage
+	// Assignments counts the frames decoded with each channel assignment, 0 through midSide.
+	assignments    [11]int
+	detectClipping bool
+	clipped        int64
+	stereoAnalysis bool
+	// Stereo accumulates the correlation of the channels of a stereo stream.
+	stereo stereoSums
+
+	// Decoded is the number of inter-channel samples decoded.
+	decoded int64
+	// Offset is the offset in bytes of the end of the most recently decoded frame.
+	offset int64
+
+	// Start is the number of the first frame expected by NewDecoderWithStart,
+	// until it is decoded.
+	start *uint64
+
+	// Streaming is the state of streaming started by StartStreaming, or nil.
+	streaming *streamer
+
+	// ReadAhead is the number of frames to decode ahead, set by WithReadAhead.
+	readAhead int
+	// Ahead is the state of the read-ahead goroutine once it is started, or nil.
+	ahead *readAheadQueue
+
+	resampleRate int
+	newResampler func(srcRate, dstRate, nChannels int) Resampler
+	resampler    Resampler
+	// Resampled holds the resampled samples of each channel of the current frame.
+	resampled [][]int32
+
+	// Transform is applied to the samples of each channel, set by WithSampleTransform.
+	transform func(ch int, samples []int32)
+
+	// Justify is the placement of 24-bit samples in 4-byte containers, set by With24In32,
+	// or 0 for 3-byte samples.
+	justify Justification
+	// Rounding is the rounding of samples reduced to 16 bits, set by With16BitRounding,
+	// or 0 to keep the stream's bit depth.
+	rounding RoundingMode
+
+	// Channels are the channels selected by SelectChannels, or nil for all channels.
+	channels []int
+	// Selected holds the selected channels of the current frame.
+	selected [][]int32
 }
 
 // MetaData contains metadata header information from a FLAC file header.
 type MetaData struct {
 	*StreamInfo
 	*VorbisComment
+	// ID3v1 is a nonstandard ID3v1 tag following the last frame, or nil if there is none.
+	ID3v1 *ID3v1
+	// CueSheet is the content of the CUESHEET block, or nil if there is none.
+	CueSheet *CueSheet
+	// SeekTable holds the seek points of the SEEKTABLE block, or nil if there is none.
+	SeekTable SeekTable
+	// Pictures are the pictures of the PICTURE blocks, in stream order.
+	Pictures []*Picture
+	// Blocks are the raw metadata blocks, in stream order, if the decoder
+	// was created with WithRawMetadata.
+	Blocks []RawBlock
+	// SkippedBlocks are the types of the metadata blocks that were present
+	// but not parsed, such as PADDING or APPLICATION, in stream order.
+	SkippedBlocks []BlockType
+
+	// HeaderSize is the number of bytes from the start of the fLaC magic through the last metadata block.
+	headerSize int64
+	// Blocks holds the header of each metadata block, in stream order.
+	blocks []blockHeader
+	// RawStreamInfo is the body of the STREAMINFO block as read.
+	rawStreamInfo []byte
+}
+
+// A RawBlock is a metadata block exactly as read, of any type.
+type RawBlock struct {
+	Type BlockType
+	// Last is whether the block is marked as the last metadata block.
+	Last bool
+	// Data is the body of the block, without its 4-byte header.
+	Data []byte
+}
+
+// Bytes returns the encoded block: its 4-byte header followed by its body.
+func (b RawBlock) Bytes() []byte {
+	hdr := uint32(b.Type)<<24 | uint32(len(b.Data))
+	if b.Last {
+		hdr |= 1 << 31
+	}
+	enc := make([]byte, 4, 4+len(b.Data))
+	binary.BigEndian.PutUint32(enc, hdr)
+	return append(enc, b.Data...)
+}
+
+// A blockHeader is the header of a metadata block.
+type blockHeader struct {
+	kind   BlockType
+	length int
+	last   bool
+}
+
+// HeaderSize returns the size in bytes of the FLAC header:
+// the 4-byte fLaC magic and all of the metadata blocks.
+// It is the offset of the first frame from the start of the stream.
+func (m MetaData) HeaderSize() int64 {
+	return m.headerSize
+}
+
+// PaddingBlock is a PADDING metadata block, as returned by MetaData.Padding.
+type PaddingBlock struct {
+	// Index is the position of the block among the metadata blocks, from 0 for STREAMINFO.
+	Index int
+	// Offset is the offset in bytes of the block header from the start of the stream.
+	Offset int64
+	// Size is the size in bytes of the padding, excluding the 4-byte block header.
+	Size int
+}
+
+// Padding returns the PADDING blocks, in stream order.
+// Metadata edited in place can grow into them without rewriting the audio.
+func (m MetaData) Padding() []PaddingBlock {
+	var pad []PaddingBlock
+	off := int64(len(magic))
+	for i, b := range m.blocks {
+		if b.kind == PaddingType {
+			pad = append(pad, PaddingBlock{Index: i, Offset: off, Size: b.length})
+		}
+		off += 4 + int64(b.length)
+	}
+	return pad
+}
+
+// PaddingSize returns the total size in bytes of the PADDING blocks,
+// excluding their block headers.
+func (m MetaData) PaddingSize() int {
+	var n int
+	for _, p := range m.Padding() {
+		n += p.Size
+	}
+	return n
+}
+
+// RawStreamInfo returns a copy of the 34-byte body of the STREAMINFO block exactly as read,
+// for copying into containers that embed it, such as the Matroska CodecPrivate.
+// It returns nil if the metadata was not read from a stream.
+func (m MetaData) RawStreamInfo() []byte {
+	if m.rawStreamInfo == nil {
+		return nil
+	}
+	return append([]byte(nil), m.rawStreamInfo...)
 }
 
 // StreamInfo contains information about the FLAC stream.
 type StreamInfo struct {
-	MinBlock      int
-	MaxBlock      int
-	MinFrame      int
-	MaxFrame      int
+	MinBlock int
+	MaxBlock int
+	// MinFrame and MaxFrame are the minimum and maximum frame sizes in bytes.
+	// Either may be 0, meaning the size is unknown; many encoders leave them 0.
+	MinFrame int
+	MaxFrame int
+	// SampleRate is the sample rate in Hz. A STREAMINFO may give 0 when
+	// the frame headers carry the rate; NewDecoder then sets it
+	// from the header of the first frame.
 	SampleRate    int
 	NChannels     int
 	BitsPerSample int
@@ -88,6 +468,29 @@ type StreamInfo struct {
 	MD5           [md5.Size]byte
 }
 
+// HasTotalSamples returns whether the total number of samples of the stream is known.
+// An encoder that does not know the length of the stream, such as one writing
+// a live capture to a pipe, leaves TotalSamples 0. Its length is then only
+// known by decoding or scanning every frame; see Decoder.DecodedSamples and
+// Decoder.ComputeDuration.
+func (s *StreamInfo) HasTotalSamples() bool {
+	return s.TotalSamples > 0
+}
+
+// HasMD5 returns whether the stream has an MD5 checksum of its audio.
+// An encoder that cannot seek back to fill it in, such as one writing to
+// standard output, leaves MD5 all zeros, meaning the checksum was not computed.
+// Decode and DecodeStreaming then do not verify the audio, and report no error.
+func (s *StreamInfo) HasMD5() bool {
+	return s.MD5 != [md5.Size]byte{}
+}
+
+// HasFrameSizeInfo returns whether both the minimum and maximum frame sizes are known.
+// Code estimating frame positions must not rely on MinFrame or MaxFrame otherwise.
+func (s *StreamInfo) HasFrameSizeInfo() bool {
+	return s.MinFrame > 0 && s.MaxFrame > 0
+}
+
 // VorbisComment (a.k.a. FLAC tags) contains Vorbis-style comments that are
 // human-readable textual information.
 type VorbisComment struct {
@@ -98,29 +501,193 @@ type VorbisComment struct {
 // NewDecoder reads the FLAC header information and returns a new Decoder.
 // If an error is encountered while reading the header information then nil is
 // returned along with the error.
-func NewDecoder(r io.Reader) (*Decoder, error) {
-	br := bufio.NewReaderSize(r, 32*1024)
-
-	err := checkMagic(br)
+// A nonstandard ID3v1 tag at the end of the stream is excluded from the audio
+// and reported in the ID3v1 field of the metadata; if r is an io.ReadSeeker,
+// it is found before decoding.
+func NewDecoder(r io.Reader, opts ...Option) (*Decoder, error) {
+	r, id3, err := trimID3v1(r)
 	if err != nil {
 		return nil, err
 	}
+	br := bufio.NewReaderSize(r, 32*1024)
+
+	// The header is read through in to count the bytes read, for reporting errors.
+	in := &captureReader{r: br}
+	if err = checkMagic(in); err != nil {
+		return nil, newParseError(in.n, err)
+	}
 
-	d := &Decoder{r: br}
-	if d.MetaData, err = readMetaData(d.r); err != nil {
-		return nil, err
+	d := &Decoder{r: br, log: nopLogger{}}
+	for _, opt := range opts {
+		opt(d)
 	}
+	if d.MetaData, err = d.readMetaData(in); err != nil {
+		return nil, newParseError(in.n, err)
+	}
+	d.ID3v1 = id3
+	d.offset = d.HeaderSize()
 	if d.StreamInfo == nil {
-		return nil, errors.New("Missing STREAMINFO header")
+		return nil, newParseError(d.offset, errors.New("Missing STREAMINFO header"))
+	}
+	if d.SampleRate == 0 {
+		d.SampleRate = d.peekSampleRate()
+	}
+	if d.strict {
+		if err := d.StreamInfo.Validate(); err != nil {
+			return nil, newParseError(d.offset, err)
+		}
+	}
+	if !d.HasMD5() {
+		d.log.Warnf("flac: STREAMINFO MD5 signature is unset")
 	}
 
-	if d.BitsPerSample != 8 && d.BitsPerSample != 16 && d.BitsPerSample != 24 {
-		return nil, errors.New("Unsupported bits per sample (" + strconv.Itoa(d.BitsPerSample) + "), supported values are: 8, 16, and 24")
+	if err := checkBitsPerSample(d.BitsPerSample); err != nil {
+		return nil, newParseError(d.offset, err)
+	}
+
+	if d.newResampler != nil {
+		if d.resampleRate <= 0 {
+			return nil, errors.New("Bad resample rate (" + strconv.Itoa(d.resampleRate) + ")")
+		}
+		if d.SampleRate <= 0 {
+			return nil, errors.New("Cannot resample from an unknown sample rate")
+		}
+		d.resampler = d.newResampler(d.SampleRate, d.resampleRate, d.NChannels)
 	}
 
 	return d, nil
 }
 
+// ReadTagsBuffered reads the FLAC header information from r, reading exactly
+// up to the end of the last metadata block and no further, and returns the
+// metadata and the number of bytes read, even on error.
+// It suits sources that cannot seek, such as network streams being indexed:
+// afterwards the caller can abandon r, or continue decoding the frames from it
+// with NewDecoderWithStart(r, *meta.StreamInfo, 0).
+func ReadTagsBuffered(r io.Reader) (MetaData, int64, error) {
+	in := &captureReader{r: r}
+	if err := checkMagic(in); err != nil {
+		return MetaData{}, in.n, newParseError(in.n, err)
+	}
+	d := &Decoder{log: nopLogger{}}
+	meta, err := d.readMetaData(in)
+	if err != nil {
+		return MetaData{}, in.n, newParseError(in.n, err)
+	}
+	if meta.StreamInfo == nil {
+		return MetaData{}, in.n, newParseError(in.n, errors.New("Missing STREAMINFO header"))
+	}
+	return meta, in.n, nil
+}
+
+// NewDecoderWithStart returns a new Decoder for a piece of a FLAC stream
+// split between frames, such as a chunk given to one of several workers.
+// The piece has no header: r begins with a frame, info describes the whole stream,
+// and firstFrameNumber is the number of the first frame of the piece,
+// or for a variable block size stream the number of its first sample.
+// Frame and sample positions reported by the decoder are those of the whole stream.
+// The first decoded frame must have the given number.
+func NewDecoderWithStart(r io.Reader, info StreamInfo, firstFrameNumber uint64) (*Decoder, error) {
+	if err := checkBitsPerSample(info.BitsPerSample); err != nil {
+		return nil, err
+	}
+	d := newFrameDecoder(bufio.NewReaderSize(r, 32*1024), info)
+	d.start = &firstFrameNumber
+	if d.SampleRate == 0 {
+		d.SampleRate = d.peekSampleRate()
+	}
+	return d, nil
+}
+
+// newFrameDecoder returns a Decoder of the frames read from r, with no header.
+func newFrameDecoder(r *bufio.Reader, info StreamInfo) *Decoder {
+	return &Decoder{
+		r:        r,
+		MetaData: MetaData{StreamInfo: &info},
+		log:      nopLogger{},
+	}
+}
+
+func checkBitsPerSample(bps int) error {
+	if bps != 8 && bps != 12 && bps != 16 && bps != 20 && bps != 24 && bps != 32 {
+		return errors.New("Unsupported bits per sample (" + strconv.Itoa(bps) + "), supported values are: 8, 12, 16, 20, 24, and 32")
+	}
+	return nil
+}
+
+// StreamOffset returns the offset in bytes of the end of the most recently
+// decoded frame, just after its CRC16 footer, from the start of the stream,
+// or the size of the header before the first frame is decoded.
+// Together with the size of each frame it gives the exact frame boundaries
+// needed to build a seek table or to cut a stream.
+// For a decoder made with NewDecoderWithStart, it is the offset from the
+// start of the piece.
+func (d *Decoder) StreamOffset() int64 {
+	if d.ahead != nil {
+		return d.ahead.offset
+	}
+	return d.offset
+}
+
+// CurrentSampleRate returns the sample rate coded in the header of the most
+// recently decoded frame, or the STREAMINFO sample rate before the first frame
+// is decoded. It can differ from the STREAMINFO sample rate in damaged or
+// spliced streams, so timing and resampling code should prefer it.
+func (d *Decoder) CurrentSampleRate() int {
+	if rate := d.currentFrame().SampleRate; rate != 0 {
+		return rate
+	}
+	return d.SampleRate
+}
+
+// DecodedSamples returns the number of inter-channel samples in the frames
+// decoded so far. After the last frame, it is the length of the stream,
+// even if STREAMINFO does not give it; the final frame counts in full,
+// though Next trims any samples past a known TotalSamples.
+func (d *Decoder) DecodedSamples() int64 {
+	if d.ahead != nil {
+		return d.ahead.decoded
+	}
+	return d.decoded
+}
+
+// Position returns the number of the inter-channel sample following the
+// most recently decoded frame, or 0 before the first frame is decoded.
+func (d *Decoder) Position() int64 {
+	f := d.currentFrame()
+	return f.FirstSample + int64(f.BlockSize)
+}
+
+// A ParseError is an error in the data of a stream, with the approximate
+// offset in bytes from the start of the stream where it was found.
+// The errors of reading the header in NewDecoder and of decoding frames are
+// ParseErrors, except for io.EOF at the end of the stream and ErrMemoryLimit.
+// Use errors.As to get the offset.
+type ParseError struct {
+	Offset int64
+	// Msg is the description of the error, as returned by Error.
+	Msg string
+	// Err is the underlying error.
+	Err error
+}
+
+// newParseError returns err as a *ParseError at offset off,
+// unless it is ErrMemoryLimit, which is returned as is.
+func newParseError(off int64, err error) error {
+	if err == ErrMemoryLimit {
+		return err
+	}
+	return &ParseError{Offset: off, Msg: err.Error(), Err: err}
+}
+
+func (e *ParseError) Error() string {
+	return e.Msg
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
 func checkMagic(r io.Reader) error {
 	var m [4]byte
 	if _, err := io.ReadFull(r, m[:]); err != nil {
@@ -132,31 +699,34 @@ func checkMagic(r io.Reader) error {
 	return nil
 }
 
-type blockType int
+// BlockType is the type of a metadata block.
+type BlockType int
 
+// The metadata block types.
 const (
-	streamInfoType    blockType = 0
-	paddingType       blockType = 1
-	applicationType   blockType = 2
-	seekTableType     blockType = 3
-	vorbisCommentType blockType = 4
-	cueSheetType      blockType = 5
-	pictureType       blockType = 6
+	StreamInfoType    BlockType = 0
+	PaddingType       BlockType = 1
+	ApplicationType   BlockType = 2
+	SeekTableType     BlockType = 3
+	VorbisCommentType BlockType = 4
+	CueSheetType      BlockType = 5
+	PictureType       BlockType = 6
 
 	invalidBlockType = 127
 )
 
-var blockTypeNames = map[blockType]string{
-	streamInfoType:    "STREAMINFO",
-	paddingType:       "PADDING",
-	applicationType:   "APPLICATION",
-	seekTableType:     "SEEKTABLE",
-	vorbisCommentType: "VORBIS_COMMENT",
-	cueSheetType:      "CUESHEET",
-	pictureType:       "PICTURE",
+var blockTypeNames = map[BlockType]string{
+	StreamInfoType:    "STREAMINFO",
+	PaddingType:       "PADDING",
+	ApplicationType:   "APPLICATION",
+	SeekTableType:     "SEEKTABLE",
+	VorbisCommentType: "VORBIS_COMMENT",
+	CueSheetType:      "CUESHEET",
+	PictureType:       "PICTURE",
 }
 
-func (t blockType) String() string {
+// String returns the name of the block type in the FLAC specification, such as VORBIS_COMMENT.
+func (t BlockType) String() string {
 	if n, ok := blockTypeNames[t]; ok {
 		return n
 	}
@@ -166,25 +736,68 @@ func (t blockType) String() string {
 	return "Unknown(" + strconv.Itoa(int(t)) + ")"
 }
 
-func readMetaData(r io.Reader) (MetaData, error) {
-	var meta MetaData
+func (d *Decoder) readMetaData(r io.Reader) (MetaData, error) {
+	meta := MetaData{headerSize: int64(len(magic))}
 	for {
 		last, kind, n, err := readMetaDataHeader(r)
+		if err == io.EOF {
+			// The stream ended before its last metadata block.
+			err = io.ErrUnexpectedEOF
+		}
 		if err != nil {
-			return meta, errors.New("Failed to read metadata header: " + err.Error())
+			return meta, fmt.Errorf("Failed to read metadata header: %w", err)
 		}
+		meta.headerSize += 4 + int64(n)
+		meta.blocks = append(meta.blocks, blockHeader{kind: kind, length: int(n), last: last})
 
-		header := &io.LimitedReader{R: r, N: int64(n)}
+		var header io.Reader = &io.LimitedReader{R: unexpectedEOF{r}, N: int64(n)}
+		if d.rawMetadata {
+			if err := d.mem.alloc(int64(n)); err != nil {
+				return meta, err
+			}
+			data := make([]byte, n)
+			if _, err := io.ReadFull(header, data); err != nil {
+				return meta, fmt.Errorf("Failed to read metadata: %w", err)
+			}
+			meta.Blocks = append(meta.Blocks, RawBlock{Type: kind, Last: last, Data: data})
+			header = bytes.NewReader(data)
+		}
 
 		switch kind {
 		case invalidBlockType:
 			return meta, errors.New("Invalid metadata block type (127)")
 
-		case streamInfoType:
-			meta.StreamInfo, err = readStreamInfo(header)
+		case StreamInfoType:
+			var raw bytes.Buffer
+			meta.StreamInfo, err = readStreamInfo(io.TeeReader(header, &raw))
+			meta.rawStreamInfo = raw.Bytes()
+
+		case VorbisCommentType:
+			if err = d.mem.alloc(int64(n)); err == nil {
+				meta.VorbisComment, err = readVorbisComment(header, &d.mem)
+			}
 
-		case vorbisCommentType:
-			meta.VorbisComment, err = readVorbisComment(header)
+		case CueSheetType:
+			if err = d.mem.alloc(int64(n)); err == nil {
+				meta.CueSheet, err = readCueSheet(header)
+			}
+
+		case SeekTableType:
+			if err = d.mem.alloc(int64(n)); err == nil {
+				meta.SeekTable, err = readSeekTable(header)
+			}
+
+		case PictureType:
+			if err = d.mem.alloc(int64(n)); err == nil {
+				var p *Picture
+				if p, err = readPicture(header); err == nil {
+					meta.Pictures = append(meta.Pictures, p)
+				}
+			}
+
+		default:
+			d.log.Debugf("flac: skipping %v metadata block of %d bytes", kind, n)
+			meta.SkippedBlocks = append(meta.SkippedBlocks, kind)
 		}
 
 		if err != nil {
@@ -193,7 +806,7 @@ func readMetaData(r io.Reader) (MetaData, error) {
 
 		// Junk any unread bytes.
 		if _, err = io.Copy(ioutil.Discard, header); err != nil {
-			return meta, errors.New("Failed to discard metadata: " + err.Error())
+			return meta, fmt.Errorf("Failed to discard metadata: %w", err)
 		}
 
 		if last {
@@ -203,14 +816,14 @@ func readMetaData(r io.Reader) (MetaData, error) {
 	return meta, nil
 }
 
-func readMetaDataHeader(r io.Reader) (last bool, kind blockType, n int32, err error) {
+func readMetaDataHeader(r io.Reader) (last bool, kind BlockType, n int32, err error) {
 	const headerSize = 32 // bits
 	br := bit.NewReader(&io.LimitedReader{R: r, N: headerSize})
 	fs, err := br.ReadFields(1, 7, 24)
 	if err != nil {
 		return false, 0, 0, err
 	}
-	return fs[0] == 1, blockType(fs[1]), int32(fs[2]), nil
+	return fs[0] == 1, BlockType(fs[1]), int32(fs[2]), nil
 }
 
 func readStreamInfo(r io.Reader) (*StreamInfo, error) {
@@ -238,14 +851,10 @@ func readStreamInfo(r io.Reader) (*StreamInfo, error) {
 	}
 	copy(info.MD5[:], csum)
 
-	if info.SampleRate == 0 {
-		return info, errors.New("Bad sample rate")
-	}
-
 	return info, nil
 }
 
-func readVorbisComment(r io.Reader) (*VorbisComment, error) {
+func readVorbisComment(r io.Reader, mem *memBudget) (*VorbisComment, error) {
 	data, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
@@ -263,7 +872,16 @@ func readVorbisComment(r io.Reader) (*VorbisComment, error) {
 	data = data[4:]
 
 	// Pre-allocate comments slice
-	cmnt.Comments = make([]string, 0, n)
+	if err := mem.alloc(int64(n) * stringSize); err != nil {
+		return nil, err
+	}
+	// Each comment takes at least 4 bytes, so a count beyond that is a lie
+	// and must not size the allocation.
+	prealloc := n
+	if max := uint32(len(data) / 4); prealloc > max {
+		prealloc = max
+	}
+	cmnt.Comments = make([]string, 0, prealloc)
 
 	for i := uint32(0); i < n; i++ {
 		var s string
@@ -290,98 +908,490 @@ func vorbisString(data []byte) (string, []byte, error) {
 
 // Next returns the audio data from the next frame.
 func (d *Decoder) Next() ([]byte, error) {
-	frameBuffer := frameBufferPool.Get().([]int32)
-	defer frameBufferPool.Put(frameBuffer)
+	data, err := d.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	return d.interleave(data)
+}
+
+// Samples returns an iterator over the inter-channel samples of the remaining frames.
+// Each call of the iterator returns the next sample of every channel and true,
+// crossing frame boundaries as needed.
+// At the end of the stream, or if decoding fails, it returns nil and false;
+// Err reports the failure, if any.
+// The returned slice is overwritten by the next call.
+func (d *Decoder) Samples() func() ([]int32, bool) {
+	var chans [][]int32
+	var sample []int32
+	var i int
+	done := false
+	return func() ([]int32, bool) {
+		for !done && (chans == nil || i >= len(chans[0])) {
+			var err error
+			if chans, err = d.readFrame(); err != nil {
+				if err != io.EOF {
+					d.err = err
+				}
+				done = true
+			}
+			i = 0
+		}
+		if done {
+			return nil, false
+		}
+		if len(sample) != len(chans) {
+			sample = make([]int32, len(chans))
+		}
+		for ch := range sample {
+			sample[ch] = chans[ch][i]
+		}
+		i++
+		return sample, true
+	}
+}
 
+// Err returns the error, other than io.EOF, that ended iteration by Samples.
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// readFrame decodes the next frame, returning its samples for each channel,
+// from the read-ahead queue if the decoder was created with WithReadAhead.
+func (d *Decoder) readFrame() ([][]int32, error) {
+	var data [][]int32
+	var err error
+	if d.readAhead > 0 {
+		data, err = d.readQueuedFrame()
+	} else {
+		data, err = d.readNextFrame()
+	}
+	if err != nil || d.channels == nil {
+		return data, err
+	}
+	for i, ch := range d.channels {
+		d.selected[i] = data[ch]
+	}
+	return d.selected, nil
+}
+
+// SelectChannels limits the output of subsequent frames to the given channels,
+// in the given order, after inter-channel decorrelation. A channel may be
+// selected more than once. For example, []int{1, 0} swaps the channels of a
+// stereo stream, and []int{2} extracts the third channel.
+// The metadata and FrameInfo continue to describe all channels of the stream.
+// A nil or empty indices restores the output of all channels.
+func (d *Decoder) SelectChannels(indices []int) error {
+	if len(indices) == 0 {
+		d.channels, d.selected = nil, nil
+		return nil
+	}
+	for _, ch := range indices {
+		if ch < 0 || ch >= d.NChannels {
+			return errors.New("Bad channel index (" + strconv.Itoa(ch) + ") for " + strconv.Itoa(d.NChannels) + " channels")
+		}
+	}
+	d.channels = append([]int(nil), indices...)
+	d.selected = make([][]int32, len(indices))
+	return nil
+}
+
+// readNextFrame decodes the next frame from the underlying reader.
+// Errors other than io.EOF are returned as a *ParseError.
+func (d *Decoder) readNextFrame() ([][]int32, error) {
+	data, err := d.parseNextFrame()
+	if err != nil && err != io.EOF {
+		return nil, newParseError(d.offset+d.in.n, err)
+	}
+	return data, err
+}
+
+// parseNextFrame decodes the next frame from the underlying reader.
+func (d *Decoder) parseNextFrame() ([][]int32, error) {
 	defer func() { d.n++ }()
 
-	// Reuse buffer instead of creating new one each time
-	if d.rawBuffer == nil {
-		d.rawBuffer = bytes.NewBuffer(make([]byte, 0, 4096))
+	if d.bufs == nil {
+		d.bufs = frameBufferPool.Get().(*frameBuffers)
+	}
+	if d.ID3v1 == nil && d.readTrailingID3v1() {
+		return nil, io.EOF
 	}
-	d.rawBuffer.Reset()
-	frame := io.TeeReader(d.r, d.rawBuffer)
-	h, err := readFrameHeader(frame, d.StreamInfo)
+	d.in = captureReader{r: d.r, buf: d.bufs.raw[:0], capture: !d.noCRC}
+	defer func() { d.bufs.raw = d.in.buf[:0] }()
+
+	br := bit.NewReader(&d.in)
+	h, err := parseFrameHeader(br, d.StreamInfo)
 	if err == io.EOF {
 		return nil, err
 	} else if err != nil {
-		return nil, errors.New("Failed to read the frame header: " + err.Error())
+		return nil, fmt.Errorf("Failed to read the frame header: %w", err)
 	}
 
-	br := bit.NewReader(frame)
-	data := make([][]int32, h.channelAssignment.nChannels())
-	for ch := range data {
-		data[ch] = make([]int32, h.blockSize)
-		if data[ch], err = readSubFrame(br, h, ch); err != nil {
+	if err := d.inferBlockSize(h); err != nil {
+		return nil, fmt.Errorf("Failed to read the frame header: %w", err)
+	}
+
+	if d.start != nil {
+		if h.number != *d.start {
+			return nil, errors.New("First frame number is " + strconv.FormatUint(h.number, 10) +
+				", expected " + strconv.FormatUint(*d.start, 10))
+		}
+		d.start = nil
+	}
+
+	info := frameInfo(h, d.StreamInfo)
+	info.CRCValid = true
+	if !d.noCRC {
+		if err := verifyCRC8(d.in.buf); err != nil {
+			if !d.ignoreCRC {
+				return nil, fmt.Errorf("Failed to read the frame header: %w", err)
+			}
+			d.log.Warnf("flac: frame %d: header failed its CRC8 check, decoding anyway", h.number)
+			info.CRCValid = false
+		}
+	}
+
+	if h.channelAssignment >= leftSide && d.NChannels != 2 {
+		return nil, errors.New("Frame has " + h.channelAssignment.String() + " coded channels, but STREAMINFO has " +
+			strconv.Itoa(d.NChannels) + "; side coding needs exactly 2 channels")
+	}
+	if n := h.channelAssignment.nChannels(); n != d.NChannels {
+		return nil, errors.New("Frame has " + strconv.Itoa(n) + " channels, but STREAMINFO has " + strconv.Itoa(d.NChannels))
+	}
+
+	if d.SampleRate != 0 && info.SampleRate != d.SampleRate {
+		if d.strict {
+			return nil, errors.New("Frame has sample rate " + strconv.Itoa(info.SampleRate) + ", but STREAMINFO has " + strconv.Itoa(d.SampleRate))
+		}
+		d.log.Warnf("flac: frame %d has sample rate %d, STREAMINFO has %d", h.number, info.SampleRate, d.SampleRate)
+	}
+
+	if prev := d.frame; prev.BlockSize > 0 {
+		want := prev.FirstSample + int64(prev.BlockSize)
+		if info.Gap = info.FirstSample - want; info.Gap != 0 && d.strict {
+			return nil, errors.New("Discontinuous frame: starts at sample " + strconv.FormatInt(info.FirstSample, 10) +
+				", expected sample " + strconv.FormatInt(want, 10))
+		} else if info.Gap != 0 {
+			d.log.Warnf("flac: frame %d starts at sample %d, expected sample %d", h.number, info.FirstSample, want)
+		}
+	}
+
+	if d.strict && d.HasTotalSamples() && d.decoded >= d.TotalSamples {
+		// Only the last frame may run past the end of the stream.
+		return nil, errors.New("Frame " + strconv.FormatUint(h.number, 10) + " follows the " +
+			strconv.FormatInt(d.TotalSamples, 10) + " samples of the stream given by STREAMINFO")
+	}
+
+	// Samples, residuals, and output bytes for every channel of the frame.
+	frameSize := int64(h.blockSize) * int64(h.channelAssignment.nChannels()) * int64(4+4+bytesPerSample(d.BitsPerSample))
+	if err := d.mem.check(frameSize); err != nil {
+		return nil, err
+	}
+
+	nChannels := h.channelAssignment.nChannels()
+	if cap(d.bufs.samples) < nChannels {
+		d.bufs.samples = append(d.bufs.samples[:cap(d.bufs.samples)], make([][]int32, nChannels-cap(d.bufs.samples))...)
+	}
+	data := d.bufs.samples[:nChannels]
+	if cap(d.subframes) < nChannels {
+		d.subframes = make([]SubframeInfo, nChannels)
+	}
+	info.Subframes = d.subframes[:nChannels]
+	for ch := range info.Subframes {
+		info.Subframes[ch] = SubframeInfo{}
+	}
+	if h.sampleSize == 32 {
+		if err := d.bufs.readWideSubFrames(br, h, data, info.Subframes, d.strict); err != nil {
 			return nil, err
 		}
+	} else {
+		for ch := range data {
+			if data[ch], err = readSubFrame(br, h, ch, data[ch], &info.Subframes[ch], d.strict, &d.bufs.scratch); err != nil {
+				return nil, err
+			}
+		}
+		fixChannels(data, h.channelAssignment)
 	}
 
-	// The bit.Reader buffers up to the next byte, so reading from frame occurs
+	// The bit.Reader buffers up to the next byte, so reading from d.in occurs
 	// on the next byte boundary.  That takes care of the padding to align to the
 	// next byte.
 	var crc16 [2]byte
-	if _, err := io.ReadFull(frame, crc16[:]); err != nil {
-		return nil, err
+	if _, err := io.ReadFull(&d.in, crc16[:]); err != nil {
+		return nil, truncated("frame footer", err)
 	}
-	if err = verifyCRC16(d.rawBuffer.Bytes()); err != nil {
-		return nil, err
+	if !d.noCRC {
+		if err = verifyCRC16(d.in.buf); err != nil {
+			if !d.ignoreCRC {
+				return nil, err
+			}
+			d.log.Warnf("flac: frame %d failed its CRC16 check, decoding anyway", h.number)
+			info.CRCValid = false
+		}
 	}
 
-	fixChannels(data, h.channelAssignment)
-	return interleave(data, d.BitsPerSample)
+	d.decoded += int64(h.blockSize)
+	d.offset += d.in.n
+	if d.detectLast {
+		info.IsLast = d.atEnd()
+	}
+	if end := info.FirstSample + int64(h.blockSize); d.HasTotalSamples() && end > d.TotalSamples && !d.fullFinalFrame {
+		// The encoder padded the last frame beyond the end of the stream.
+		n := d.TotalSamples - info.FirstSample
+		if n < 0 {
+			n = 0
+		}
+		for ch := range data {
+			data[ch] = data[ch][:n]
+		}
+	}
+	if d.bitDepthAnalysis {
+		d.usage.add(data)
+	}
+	d.assignments[h.channelAssignment]++
+	if d.detectClipping {
+		d.clipped += countClipped(data, d.BitsPerSample)
+	}
+	if d.stereoAnalysis && nChannels == 2 {
+		var s stereoSums
+		s.add(data[0], data[1])
+		info.Correlation = s.correlation()
+		d.stereo.merge(s)
+	}
+	d.frame = info
+	if d.resampler != nil {
+		// The resampled samples are kept apart from the frame buffers,
+		// which the next frame is decoded into.
+		if cap(d.resampled) < nChannels {
+			d.resampled = make([][]int32, nChannels)
+		}
+		out := d.resampled[:nChannels]
+		for ch := range data {
+			out[ch] = d.resampler.Resample(ch, data[ch])
+		}
+		data = out
+	}
+	if d.transform != nil {
+		for ch := range data {
+			d.transform(ch, data[ch])
+		}
+	}
+	return data, nil
 }
 
-func readSubFrame(br *bit.Reader, h *frameHeader, ch int) ([]int32, error) {
-	var data []int32
-	bps := h.bitsPerSample(ch)
+// atEnd reports whether the stream ends at the current offset,
+// but for any trailing ID3v1 tag, without consuming any of it.
+func (d *Decoder) atEnd() bool {
+	if b, err := d.r.Peek(1); len(b) == 0 && err == io.EOF {
+		return true
+	}
+	if b, _ := d.r.Peek(3); !isID3v1(b) {
+		return false
+	}
+	b, _ := d.r.Peek(id3v1Size + 1)
+	return len(b) == id3v1Size
+}
+
+// inferBlockSize sets the block size of a frame header with the reserved block size code 0
+// if the decoder was created with WithLenientBlockSize, or returns errBlockSize.
+func (d *Decoder) inferBlockSize(h *frameHeader) error {
+	if h.blockSize != 0 {
+		return nil
+	}
+	// Some encoders write the reserved block size code 0 in streams with a fixed block size.
+	if !d.lenientBlockSize || d.MinBlock != d.MaxBlock || d.MaxBlock == 0 {
+		return errBlockSize
+	}
+	h.blockSize = d.MaxBlock
+	return nil
+}
+
+// PeekFrameSize returns the number of inter-channel samples in the next frame,
+// read from its header without decoding or consuming any of the frame,
+// so that the next call of Next decodes that same frame.
+// The CRC8 of the header is verified unless checking is disabled.
+// At the end of the stream, PeekFrameSize returns io.EOF.
+// It cannot be used with a decoder created with WithReadAhead.
+func (d *Decoder) PeekFrameSize() (int, error) {
+	if d.readAhead > 0 {
+		return 0, errors.New("PeekFrameSize is not supported while reading ahead")
+	}
+	if d.ID3v1 == nil && d.readTrailingID3v1() {
+		return 0, io.EOF
+	}
+	b, err := d.r.Peek(maxFrameHeaderSize)
+	if len(b) == 0 {
+		if err == nil || err == io.EOF {
+			return 0, io.EOF
+		}
+		return 0, err
+	}
+	in := &captureReader{r: bytes.NewReader(b), capture: true}
+	h, err := parseFrameHeader(bit.NewReader(in), d.StreamInfo)
+	if err == nil {
+		err = d.inferBlockSize(h)
+	}
+	if err == nil && !d.noCRC && !d.ignoreCRC {
+		err = verifyCRC8(in.buf)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Failed to read the frame header: %w", err)
+	}
+	return h.blockSize, nil
+}
 
-	kind, order, err := readSubFrameHeader(br)
+// peekSampleRate returns the sample rate given by the frame header
+// at the current offset, without consuming it, or 0 if there is none.
+// A STREAMINFO may leave the sample rate unset, 0, when every frame header
+// carries its own; the rate of the first frame then stands for the stream,
+// and frames that defer to STREAMINFO take it too.
+// A first frame that defers to STREAMINFO fails to decode with errUnknownSampleRate.
+func (d *Decoder) peekSampleRate() int {
+	b, _ := d.r.Peek(maxFrameHeaderSize)
+	h, err := parseFrameHeader(bit.NewReader(bytes.NewReader(b)), d.StreamInfo)
 	if err != nil {
-		return nil, err
+		return 0
+	}
+	return h.sampleRate
+}
+
+// Close releases the frame buffers of the decoder so that they can be reused
+// by other decoders, first stopping any streaming or read-ahead that uses them.
+// The decoder can still be used after Close, but it will acquire new buffers.
+func (d *Decoder) Close() error {
+	d.Stop()
+	d.stopReadAhead()
+	if d.bufs != nil {
+		frameBufferPool.Put(d.bufs)
+		d.bufs = nil
+		d.in = captureReader{}
+	}
+	return nil
+}
+
+// FrameInfo returns information about the most recently decoded frame.
+func (d *Decoder) FrameInfo() FrameInfo {
+	f := d.currentFrame()
+	f.Subframes = copySubframes(f.Subframes)
+	return f
+}
+
+// currentFrame is like FrameInfo, but its Subframes are reused by the next frame.
+func (d *Decoder) currentFrame() FrameInfo {
+	if d.ahead != nil {
+		return d.ahead.frame
+	}
+	return d.frame
+}
+
+// copySubframes returns a copy of s that outlives the frame it describes.
+func copySubframes(s []SubframeInfo) []SubframeInfo {
+	if s == nil {
+		return nil
+	}
+	return append([]SubframeInfo(nil), s...)
+}
+
+// readSubFrame reads the subframe of channel ch and describes it in info.
+// Its samples are decoded into dst if it has enough capacity, and otherwise
+// into a new slice; s holds the scratch buffers of the predictor and residual.
+// If strict is set, LPC subframes that suggest corruption are rejected.
+func readSubFrame[T sample](br *bit.Reader, h *frameHeader, ch int, dst []T, info *SubframeInfo, strict bool, s *subframeScratch[T]) ([]T, error) {
+	var data []T
+	bps := h.bitsPerSample(ch)
+
+	kind, order, wasted, err := readSubFrameHeader(br)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, truncated("subframe header", err)
+	} else if err != nil {
+		return nil, fmt.Errorf("Frame %d, channel %d: %w", h.number, ch, err)
+	}
+	*info = SubframeInfo{Type: kind.String(), Order: order, WastedBits: int(wasted)}
+	if order > h.blockSize {
+		// The warm-up samples alone would overrun the block.
+		return nil, errors.New("Predictor order (" + strconv.Itoa(order) + ") exceeds block size (" + strconv.Itoa(h.blockSize) + ")")
 	}
+	if wasted >= bps {
+		return nil, errors.New("Wasted bits (" + strconv.Itoa(int(wasted)) + ") leave no bits of the " + strconv.Itoa(int(bps)) + "-bit samples")
+	}
+	// The samples are coded without their wasted low bits, which are restored
+	// before the channels are decorrelated.
+	bps -= wasted
 	switch kind {
 	case subFrameConstant:
 		v, err := br.Read(bps)
 		if err != nil {
-			return nil, err
+			return nil, truncated("constant value", err)
 		}
-		u := signExtend(v, bps)
-		data = make([]int32, h.blockSize)
+		u := T(signExtend64(v, bps)) << wasted
+		data = sampleBuffer(dst, h.blockSize)
 		for j := range data {
 			data[j] = u
 		}
 
 	case subFrameVerbatim:
-		data = make([]int32, h.blockSize)
+		data = sampleBuffer(dst, h.blockSize)
 		for j := range data {
 			v, err := br.Read(bps)
 			if err != nil {
-				return nil, err
+				return nil, truncated("verbatim sample", err)
 			}
-			data[j] = signExtend(v, bps)
+			data[j] = T(signExtend64(v, bps))
 		}
 
 	case subFrameFixed:
-		data, err = decodeFixedSubFrame(br, bps, h.blockSize, order)
+		data, err = decodeFixedSubFrame(br, bps, h.blockSize, order, dst, s)
 		if err != nil {
 			return nil, err
 		}
 
 	case subFrameLPC:
-		data, err = decodeLPCSubFrame(br, bps, h.blockSize, order)
-		if err != nil {
+		data, err = decodeLPCSubFrame(br, bps, h.blockSize, order, dst, info, s)
+		if errors.Is(err, errLPCShift) {
+			if strict {
+				return nil, fmt.Errorf("Frame %d, channel %d: %w", h.number, ch, err)
+			}
+		} else if err != nil {
 			return nil, err
 		}
 
 	default:
-		return nil, errors.New("Unsupported frame kind")
+		return nil, fmt.Errorf("Frame %d, channel %d: unsupported subframe type %v", h.number, ch, kind)
 	}
 
+	if wasted > 0 && kind != subFrameConstant {
+		for j := range data {
+			data[j] <<= wasted
+		}
+	}
 	return data, nil
 }
 
-func fixChannels(data [][]int32, assign channelAssignment) {
+// readWideSubFrames decodes the subframes of a 32-bit frame into data.
+// The side channel has 33 bits, so the subframes are decoded and decorrelated
+// in 64 bits, and only the final samples, which fit in 32 bits, are narrowed.
+func (b *frameBuffers) readWideSubFrames(br *bit.Reader, h *frameHeader, data [][]int32, info []SubframeInfo, strict bool) error {
+	if cap(b.wide) < len(data) {
+		b.wide = append(b.wide[:cap(b.wide)], make([][]int64, len(data)-cap(b.wide))...)
+	}
+	wide := b.wide[:len(data)]
+	var err error
+	for ch := range wide {
+		if wide[ch], err = readSubFrame(br, h, ch, wide[ch], &info[ch], strict, &b.wideScratch); err != nil {
+			return err
+		}
+	}
+	fixChannels(wide, h.channelAssignment)
+	for ch := range data {
+		data[ch] = sampleBuffer(data[ch], len(wide[ch]))
+		for i, v := range wide[ch] {
+			data[ch][i] = int32(v)
+		}
+	}
+	return nil
+}
+
+func fixChannels[T sample](data [][]T, assign channelAssignment) {
 	switch assign {
 	case leftSide:
 		for i, d0 := range data[0] {
@@ -404,19 +1414,28 @@ func fixChannels(data [][]int32, assign channelAssignment) {
 	}
 }
 
+// bytesPerSample returns the size in bytes of a sample of the given bit depth
+// in the data returned by Next: the fewest whole bytes that hold it,
+// as the samples are hashed for the MD5 checksum.
+func bytesPerSample(bps int) int {
+	return (bps + 7) / 8
+}
+
+// interleave returns the samples of chs interleaved as little-endian signed
+// integers of bytesPerSample(bps) bytes, right-justified and sign-extended.
 func interleave(chs [][]int32, bps int) ([]byte, error) {
+	width := bytesPerSample(bps)
 	// Fast path for common stereo 16-bit case
-	if bps == 16 && len(chs) == 2 {
+	if width == 2 && len(chs) == 2 {
 		return interleave16BitStereo(chs[0], chs[1])
 	}
 	nSamples := len(chs[0])
 	nChannels := len(chs)
 
-	bytesPerSample := bps / 8
-	data := make([]byte, nSamples*nChannels*bytesPerSample)
+	data := make([]byte, nSamples*nChannels*width)
 
-	switch bps {
-	case 8:
+	switch width {
+	case 1:
 		var i int
 		for j := 0; j < nSamples; j++ {
 			for _, ch := range chs {
@@ -426,7 +1445,7 @@ func interleave(chs [][]int32, bps int) ([]byte, error) {
 		}
 		return data, nil
 
-	case 16:
+	case 2:
 		var i int
 		for j := 0; j < nSamples; j++ {
 			for _, ch := range chs {
@@ -438,7 +1457,7 @@ func interleave(chs [][]int32, bps int) ([]byte, error) {
 		}
 		return data, nil
 
-	case 24:
+	case 3:
 		var i int
 		for j := 0; j < nSamples; j++ {
 			for _, ch := range chs {
@@ -451,24 +1470,19 @@ func interleave(chs [][]int32, bps int) ([]byte, error) {
 		}
 		return data, nil
 
+	case 4:
+		var i int
+		for j := 0; j < nSamples; j++ {
+			for _, ch := range chs {
+				binary.LittleEndian.PutUint32(data[i:], uint32(ch[j]))
+				i += 4
+			}
+		}
+		return data, nil
 	}
 	return nil, errors.New("Unsupported bits per sample")
 }
 
-func interleave16BitStereo(left, right []int32) ([]byte, error) {
-	nSamples := len(left)
-	data := make([]byte, nSamples*4)
-	for i, j := 0, 0; i < nSamples; i++ {
-		l, r := left[i], right[i]
-		data[j] = byte(l & 0xFF)
-		data[j+1] = byte((l >> 8) & 0xFF)
-		data[j+2] = byte(r & 0xFF)
-		data[j+3] = byte((r >> 8) & 0xFF)
-		j += 4
-	}
-	return data, nil
-}
-
 type frameHeader struct {
 	variableSize      bool
 	blockSize         int // Number of inter-channel samples.
@@ -479,6 +1493,86 @@ type frameHeader struct {
 	crc8              uint8
 }
 
+// FrameInfo contains information about a decoded audio frame.
+type FrameInfo struct {
+	// Number is the frame number coded in the frame header.
+	// For variable block size streams it is the number of the first sample instead.
+	Number            uint64
+	VariableBlockSize bool
+	// FirstSample is the number of the first inter-channel sample in the frame.
+	FirstSample int64
+	// BlockSize is the number of inter-channel samples in the frame.
+	BlockSize int
+	// SampleRate is the sample rate coded in the frame header,
+	// or the STREAMINFO sample rate if the header defers to it.
+	SampleRate    int
+	NChannels     int
+	BitsPerSample int
+	// Gap is the number of samples between the end of the previous frame and
+	// the start of this one; it is negative if the frames overlap.
+	// Gap is 0 for contiguous frames and for the first decoded frame.
+	Gap int64
+	// CRCValid is false if the frame failed its CRC8 or CRC16 check
+	// and was decoded anyway because of WithIgnoreCRC.
+	// It is always true if checking was disabled with WithoutCRC.
+	CRCValid bool
+	// ChannelAssignment is the stereo decorrelation mode of the frame:
+	// "independent", "left/side", "right/side", or "mid/side".
+	ChannelAssignment string
+	// Correlation is the Pearson correlation coefficient of the left and right
+	// channels of a stereo frame, if the decoder was created with WithStereoAnalysis.
+	Correlation float64
+	// Subframes describes the subframe of each channel, in channel order.
+	Subframes []SubframeInfo
+	// IsLast is true if the stream ends right after the frame, or after the
+	// frame and an ID3v1 tag, so that no further call of Next returns data.
+	// It is only set if the decoder was created with WithLastFrameDetection.
+	IsLast bool
+}
+
+// SubframeInfo describes how a subframe is coded.
+type SubframeInfo struct {
+	// Type is the subframe type: SUBFRAME_CONSTANT, SUBFRAME_VERBATIM,
+	// SUBFRAME_FIXED, or SUBFRAME_LPC.
+	Type string
+	// Order is the predictor order of a fixed or LPC subframe.
+	Order int
+	// Precision is the precision in bits of the coefficients of an LPC subframe.
+	Precision int
+	// Shift is the number of bits by which the predictions of an LPC subframe are shifted right.
+	Shift int
+	// WastedBits is the number of low bits that are zero in every sample of the
+	// subframe, which are not coded.
+	WastedBits int
+}
+
+// frameInfo returns the information about a frame with header h in the stream described by info.
+func frameInfo(h *frameHeader, info *StreamInfo) FrameInfo {
+	first := int64(h.number)
+	if !h.variableSize {
+		blockSize := info.MaxBlock
+		if blockSize == 0 {
+			blockSize = h.blockSize
+		}
+		first *= int64(blockSize)
+	}
+	return FrameInfo{
+		Number:            h.number,
+		VariableBlockSize: h.variableSize,
+		FirstSample:       first,
+		BlockSize:         h.blockSize,
+		SampleRate:        h.sampleRate,
+		NChannels:         h.channelAssignment.nChannels(),
+		BitsPerSample:     h.sampleSize,
+		ChannelAssignment: h.channelAssignment.String(),
+	}
+}
+
+// A channelAssignment is the channel assignment code of a frame header.
+// Codes 0 through 7 are 1 through 8 independently coded channels.
+// The side coded assignments, left/side, right/side, and mid/side, always code
+// exactly 2 channels, so every frame of a stream with more than 2 channels
+// codes its channels independently.
 type channelAssignment int
 
 var (
@@ -525,7 +1619,7 @@ var (
 		12: 4096,
 		13: 8192,
 		14: 16384,
-		15: 23768,
+		15: 32768,
 	}
 
 	sampleRates = [...]int{
@@ -535,7 +1629,7 @@ var (
 		3:  192000,
 		4:  8000,
 		5:  16000,
-		6:  220500,
+		6:  22050,
 		7:  24000,
 		8:  32000,
 		9:  44100,
@@ -555,14 +1649,50 @@ var (
 		4: 16,
 		5: 20,
 		6: 24,
-		7: -1, // Reserved.
+		7: 32,
 	}
 )
 
+var errBlockSize = errors.New("Bad block size in frame header")
+
+// errUnknownSampleRate is returned for a frame header that takes its sample rate
+// from a STREAMINFO that does not give one.
+var errUnknownSampleRate = errors.New("Indeterminate sample rate: the frame header defers to STREAMINFO, whose sample rate is unknown (0)")
+
+// readFrameHeader reads a frame header from r and verifies its CRC8.
 func readFrameHeader(r io.Reader, info *StreamInfo) (*frameHeader, error) {
-	raw := bytes.NewBuffer(nil)
-	br := bit.NewReader(io.TeeReader(r, raw))
+	in := &captureReader{r: r, capture: true}
+	h, err := parseFrameHeader(bit.NewReader(in), info)
+	if err != nil {
+		return nil, err
+	}
+	if h.blockSize == 0 {
+		return nil, errBlockSize
+	}
+	return h, verifyCRC8(in.buf)
+}
+
+// ParseFrameHeader reads the header of a frame from r, for a stream described by info,
+// and verifies its CRC8, without decoding the rest of the frame.
+// It reads exactly the bytes of the header, so that tools such as muxers can find
+// the block size and first sample of each frame of a stream without decoding its audio.
+// The returned FrameInfo has no Subframes, and its Gap is 0.
+// If r is at its end, ParseFrameHeader returns io.EOF.
+func ParseFrameHeader(r io.Reader, info StreamInfo) (FrameInfo, error) {
+	h, err := readFrameHeader(r, &info)
+	if err == io.EOF {
+		return FrameInfo{}, err
+	} else if err != nil {
+		return FrameInfo{}, fmt.Errorf("Failed to read the frame header: %w", err)
+	}
+	f := frameInfo(h, &info)
+	f.CRCValid = true
+	return f, nil
+}
 
+// parseFrameHeader reads a frame header without verifying its CRC8.
+// The header ends on a byte boundary, so br has no bits buffered afterwards.
+func parseFrameHeader(br *bit.Reader, info *StreamInfo) (*frameHeader, error) {
 	const syncCode = 0x3FFE
 
 	switch sync, err := br.Read(14); {
@@ -574,7 +1704,7 @@ func readFrameHeader(r io.Reader, info *StreamInfo) (*frameHeader, error) {
 
 	fs, err := br.ReadFields(1, 1, 4, 4, 4, 3, 1)
 	if err != nil {
-		return nil, err
+		return nil, truncated("frame header", err)
 	}
 	if fs[0] != 0 || fs[6] != 0 {
 		return nil, errors.New("Invalid reserved value in frame header")
@@ -595,29 +1725,29 @@ func readFrameHeader(r io.Reader, info *StreamInfo) (*frameHeader, error) {
 	switch sampleSize := fs[5]; sampleSize {
 	case 0:
 		h.sampleSize = info.BitsPerSample
-	case 3, 7:
+	case 3:
 		return nil, errors.New("Bad sample size in frame header")
 	default:
 		h.sampleSize = sampleSizes[sampleSize]
 	}
 
 	if h.number, err = utf8Decode(br); err != nil {
-		return nil, err
+		return nil, truncated("frame header", err)
 	}
 
 	switch blockSize {
 	case 0:
-		return nil, errors.New("Bad block size in frame header")
+		// Reserved; the block size is left 0 for the caller to reject or infer.
 	case 6:
 		sz, err := br.Read(8)
 		if err != nil {
-			return nil, err
+			return nil, truncated("frame header", err)
 		}
 		h.blockSize = int(sz) + 1
 	case 7:
 		sz, err := br.Read(16)
 		if err != nil {
-			return nil, err
+			return nil, truncated("frame header", err)
 		}
 		h.blockSize = int(sz) + 1
 	default:
@@ -626,36 +1756,61 @@ func readFrameHeader(r io.Reader, info *StreamInfo) (*frameHeader, error) {
 
 	switch sampleRate {
 	case 0:
+		if info.SampleRate == 0 {
+			return nil, errUnknownSampleRate
+		}
 		h.sampleRate = info.SampleRate
 	case 12:
 		r, err := br.Read(8)
 		if err != nil {
-			return nil, err
+			return nil, truncated("frame header", err)
 		}
-		h.sampleRate = int(r)
+		h.sampleRate = int(r) * 1000
 	case 13:
 		r, err := br.Read(16)
 		if err != nil {
-			return nil, err
+			return nil, truncated("frame header", err)
 		}
 		h.sampleRate = int(r)
 	case 14:
 		r, err := br.Read(16)
 		if err != nil {
-			return nil, err
+			return nil, truncated("frame header", err)
 		}
 		h.sampleRate = int(r * 10)
+	case 15:
+		return nil, errors.New("Invalid sample rate code (15) in frame header")
 	default:
 		h.sampleRate = sampleRates[sampleRate]
 	}
 
 	crc8, err := br.Read(8)
 	if err != nil {
-		return nil, err
+		return nil, truncated("frame header", err)
 	}
 	h.crc8 = byte(crc8)
 
-	return h, verifyCRC8(raw.Bytes())
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// validate checks that the values decoded from a frame header are within the
+// ranges allowed by the specification. A block size of 0, from the reserved
+// block size code, is left for the caller to reject or infer.
+func (h *frameHeader) validate() error {
+	if h.blockSize < 0 || h.blockSize > maxBlockSize {
+		// Code 7 can give 65536, one more than the largest block size allowed.
+		return errors.New("Bad block size (" + strconv.Itoa(h.blockSize) + ") in frame header")
+	}
+	if h.sampleRate <= 0 || h.sampleRate > maxSampleRate {
+		return errors.New("Bad sample rate (" + strconv.Itoa(h.sampleRate) + ") in frame header")
+	}
+	if h.sampleSize < minBPS || h.sampleSize > 32 {
+		return errors.New("Bad sample size (" + strconv.Itoa(h.sampleSize) + ") in frame header")
+	}
+	return nil
 }
 
 type subFrameKind int
@@ -682,17 +1837,19 @@ func (k subFrameKind) String() string {
 	}
 }
 
-func readSubFrameHeader(br *bit.Reader) (kind subFrameKind, order int, err error) {
+// readSubFrameHeader reads a subframe header, returning the subframe type,
+// its predictor order, and the number of wasted low bits in its samples.
+func readSubFrameHeader(br *bit.Reader) (kind subFrameKind, order int, wasted uint, err error) {
 	switch pad, err := br.Read(1); {
 	case err != nil:
-		return 0, 0, err
+		return 0, 0, 0, err
 	case pad != 0:
 		// Do nothing, but this is a bad padding value.
 	}
 
 	switch k, err := br.Read(6); {
 	case err != nil:
-		return 0, 0, err
+		return 0, 0, 0, err
 
 	case k == 0:
 		kind = subFrameConstant
@@ -701,39 +1858,42 @@ func readSubFrameHeader(br *bit.Reader) (kind subFrameKind, order int, err error
 		kind = subFrameVerbatim
 
 	case (k&0x3E == 0x02) || (k&0x3C == 0x04) || (k&0x30 == 0x10):
-		return 0, 0, errors.New("Bad subframe type")
+		// 00001x, 0001xx, and 01xxxx are reserved.
+		return 0, 0, 0, errSubFrameType(k)
 
 	case k&0x38 == 0x08:
 		if order = int(k & 0x07); order > 4 {
-			return 0, 0, errors.New("Bad subframe type")
+			// 001xxx with an order above 4 is reserved.
+			return 0, 0, 0, errSubFrameType(k)
 		}
 		kind = subFrameFixed
 
-	case k&0x20 == 0x20:
+	default:
+		// 1xxxxx, the only remaining codes.
 		order = int(k&0x1F) + 1
 		kind = subFrameLPC
-
-	default:
-		return 0, 0, errors.New("Invalid subframe type")
 	}
 
-	n := 0
+	// The wasted bits flag is followed by the count minus one in unary.
 	switch k, err := br.Read(1); {
 	case err != nil:
-		return 0, 0, err
+		return 0, 0, 0, err
 
 	case k == 1:
-		n++
-		k = uint64(0)
-		for k == 0 {
+		for k = 0; k == 0; {
 			if k, err = br.Read(1); err != nil {
-				return 0, 0, err
+				return 0, 0, 0, err
 			}
-			n++
+			wasted++
 		}
 	}
 
-	return kind, order, nil
+	return kind, order, wasted, nil
+}
+
+// errSubFrameType returns the error for the reserved 6-bit subframe type code k.
+func errSubFrameType(k uint64) error {
+	return fmt.Errorf("Reserved subframe type 0x%02X (%06b)", k, k)
 }
 
 var fixedCoeffs = [...][]int32{
@@ -743,91 +1903,121 @@ var fixedCoeffs = [...][]int32{
 	4: {4, -6, 4, -1},
 }
 
-func decodeFixedSubFrame(br *bit.Reader, sampleSize uint, blkSize int, predO int) ([]int32, error) {
-	warm, err := readInts(br, predO, sampleSize)
+func decodeFixedSubFrame[T sample](br *bit.Reader, sampleSize uint, blkSize int, predO int, dst []T, s *subframeScratch[T]) ([]T, error) {
+	var err error
+	s.warm, err = readInts(br, s.warm, predO, sampleSize)
 	if err != nil {
-		return nil, err
+		return nil, truncated("warm-up sample", err)
 	}
 
-	residual, err := decodeResiduals(br, blkSize, predO)
+	s.residual, err = decodeResidualsInto(br, blkSize, predO, s.residual)
 	if err != nil {
 		return nil, err
 	}
 
-	if predO == 0 {
-		return residual, nil
-	}
-
-	return lpcDecode(fixedCoeffs[predO], warm, residual, 0), nil
+	// Even for order 0, the residual is copied out of the scratch buffer.
+	return lpcDecode(dst, fixedCoeffs[predO], s.warm, s.residual, 0), nil
 }
 
-func decodeLPCSubFrame(br *bit.Reader, sampleSize uint, blkSize int, predO int) ([]int32, error) {
-	warm, err := readInts(br, predO, sampleSize)
+// errLPCShift is returned, along with the decoded samples, for an LPC subframe
+// whose shift discards the whole prediction, which is allowed but suggests corruption.
+var errLPCShift = errors.New("LPC shift discards the whole prediction")
+
+// decodeLPCSubFrame decodes an LPC subframe, recording its precision and shift in info.
+func decodeLPCSubFrame[T sample](br *bit.Reader, sampleSize uint, blkSize int, predO int, dst []T, info *SubframeInfo, s *subframeScratch[T]) ([]T, error) {
+	var err error
+	s.warm, err = readInts(br, s.warm, predO, sampleSize)
 	if err != nil {
-		return nil, err
+		return nil, truncated("warm-up sample", err)
 	}
 
 	prec, err := br.Read(4)
 	if err != nil {
-		return nil, err
+		return nil, truncated("LPC precision", err)
 	} else if prec == 0xF {
 		return nil, errors.New("Bad LPC predictor precision")
 	}
 	prec++
 
-	s, err := br.Read(5)
+	sh, err := br.Read(5)
 	if err != nil {
-		return nil, err
+		return nil, truncated("LPC shift", err)
 	}
-	shift := int(signExtend(s, 5))
+	shift := int(signExtend(sh, 5))
 	if shift < 0 {
 		return nil, errors.New("Invalid negative shift")
 	}
 
-	coeffs, err := readInts(br, predO, uint(prec))
+	info.Precision, info.Shift = int(prec), shift
+
+	s.coeffs, err = readInts(br, s.coeffs, predO, uint(prec))
 	if err != nil {
-		return nil, err
+		return nil, truncated("LPC coefficient", err)
 	}
+	coeffs := s.coeffs
 
-	residual, err := decodeResiduals(br, blkSize, predO)
+	s.residual, err = decodeResidualsInto(br, blkSize, predO, s.residual)
 	if err != nil {
 		return nil, err
 	}
 
-	return lpcDecode(coeffs, warm, residual, uint(shift)), nil
+	data := lpcDecode(dst, coeffs, s.warm, s.residual, uint(shift))
+	// The magnitude of the prediction is below sum|c|·2^(bps-1),
+	// so if that is below 2^shift every prediction is 0 or -1.
+	var sum int64
+	for _, c := range coeffs {
+		if c < 0 {
+			c = -c
+		}
+		sum += int64(c)
+	}
+	if sum > 0 && sum<<(sampleSize-1) < 1<<uint(shift) {
+		return data, fmt.Errorf("%w: shift %d with %d-bit precision coefficients summing to at most %d in magnitude", errLPCShift, shift, prec, sum)
+	}
+	return data, nil
 }
 
-func readInts(br *bit.Reader, n int, bits uint) ([]int32, error) {
-	is := make([]int32, n)
+// readInts reads n signed integers of the given width into dst, if it has enough capacity.
+func readInts[T sample](br *bit.Reader, dst []T, n int, bits uint) ([]T, error) {
+	is := sampleBuffer(dst, n)
 	for i := range is {
 		w, err := br.Read(bits)
 		if err != nil {
 			return nil, err
 		}
-		is[i] = signExtend(w, bits)
+		is[i] = T(signExtend64(w, bits))
 	}
 	return is, nil
 }
 
-func lpcDecode(coeffs, warm, residual []int32, shift uint) []int32 {
-	data := make([]int32, len(warm)+len(residual))
+// lpcDecode predicts the samples following warm from the coefficients and residual.
+// The samples are decoded into dst if it has enough capacity.
+func lpcDecode[T sample](dst []T, coeffs []int32, warm []T, residual []int32, shift uint) []T {
+	data := sampleBuffer(dst, len(warm)+len(residual))
 	copy(data, warm)
 	for i := len(warm); i < len(data); i++ {
-		var sum int32
+		// The sum of products of up to 32 coefficients of 15 bits and samples
+		// of 33 bits may need up to 53 bits, before the shift.
+		var sum int64
 		for j, c := range coeffs {
-			sum += c * data[i-j-1]
-			data[i] = residual[i-len(warm)] + (sum >> shift)
+			sum += int64(c) * int64(data[i-j-1])
 		}
+		data[i] = T(residual[i-len(warm)]) + T(sum>>shift)
 	}
 	return data
 }
 
 func decodeResiduals(br *bit.Reader, blkSize int, predO int) ([]int32, error) {
+	return decodeResidualsInto(br, blkSize, predO, nil)
+}
+
+// decodeResidualsInto decodes the residuals of a subframe into dst, if it has enough capacity.
+func decodeResidualsInto(br *bit.Reader, blkSize int, predO int, dst []int32) ([]int32, error) {
 	var bits uint
 
 	switch method, err := br.Read(2); {
 	case err != nil:
-		return nil, err
+		return nil, truncated("residual coding method", err)
 	case method == 0:
 		bits = 4
 	case method == 1:
@@ -838,16 +2028,19 @@ func decodeResiduals(br *bit.Reader, blkSize int, predO int) ([]int32, error) {
 
 	partO, err := br.Read(4)
 	if err != nil {
-		return nil, err
+		return nil, truncated("partition order", err)
+	}
+	if blkSize%(1<<partO) != 0 || blkSize>>partO < predO {
+		// The partitions would not evenly divide the block, or the first would have a negative size.
+		return nil, errors.New("Residual partition order (" + strconv.Itoa(int(partO)) + ") is invalid for block size (" +
+			strconv.Itoa(blkSize) + ") and predictor order (" + strconv.Itoa(predO) + ")")
 	}
 
-	var residue []int32
+	residue := dst[:0]
 	for i := 0; i < 1<<partO; i++ {
 		M, err := br.Read(bits)
 		if err != nil {
-			return nil, err
-		} else if (bits == 4 && M == 0xF) || (bits == 5 && M == 0x1F) {
-			return nil, errors.New("Unsupported, unencoded residuals")
+			return nil, truncated("Rice parameter", err)
 		}
 
 		n := 0
@@ -860,15 +2053,64 @@ func decodeResiduals(br *bit.Reader, blkSize int, predO int) ([]int32, error) {
 			n = (blkSize / (1 << partO)) - predO
 		}
 
-		r, err := riceDecode(br, n, uint(M))
+		if M == 1<<bits-1 {
+			// The escape code: the residuals are unencoded, in a width given by the next 5 bits.
+			width, err := br.Read(5)
+			if err != nil {
+				return nil, truncated("escaped residual width", err)
+			}
+			residue, err = appendEscaped(residue, br, n, uint(width))
+		} else {
+			residue, err = appendRice(residue, br, n, uint(M))
+		}
 		if err != nil {
-			return nil, err
+			return nil, truncated("residual", err)
 		}
-		residue = append(residue, r...)
+	}
+	if len(residue) != blkSize-predO {
+		return nil, errors.New("Decoded " + strconv.Itoa(len(residue)) + " residuals, expected " + strconv.Itoa(blkSize-predO))
 	}
 	return residue, nil
 }
 
+// sampleBuffer returns buf resliced to n samples,
+// or a new slice if buf has too little capacity.
+func sampleBuffer[T sample](buf []T, n int) []T {
+	if cap(buf) < n {
+		return make([]T, n)
+	}
+	return buf[:n]
+}
+
+// truncated converts an EOF encountered part way through a frame into
+// io.ErrUnexpectedEOF, wrapped with the name of the field being read.
+func truncated(field string, err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("Truncated frame reading %s: %w", field, io.ErrUnexpectedEOF)
+	}
+	return err
+}
+
+// unexpectedEOF is an io.Reader that reports io.EOF from r as
+// io.ErrUnexpectedEOF, for reading data whose length is already known.
+type unexpectedEOF struct{ r io.Reader }
+
+func (u unexpectedEOF) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	if err == io.EOF && n > 0 {
+		// The next read reports the end, if more is wanted.
+		err = nil
+	} else if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// signExtend64 returns v, a two's complement integer of the given width, as an int64.
+func signExtend64(v uint64, bits uint) int64 {
+	return int64(v<<(64-bits)) >> (64 - bits)
+}
+
 func signExtend(v uint64, bits uint) int32 {
 	if v&(1<<(bits-1)) != 0 {
 		return int32(v | (^uint64(0))<<bits)
@@ -876,9 +2118,32 @@ func signExtend(v uint64, bits uint) int32 {
 	return int32(v)
 }
 
-func riceDecode(br *bit.Reader, n int, M uint) ([]int32, error) {
-	ns := make([]int32, n)
+// appendEscaped appends n unencoded residuals, each a signed integer of the given width, to dst.
+// A width of 0 codes n zeros.
+func appendEscaped(dst []int32, br *bit.Reader, n int, width uint) ([]int32, error) {
 	for i := 0; i < n; i++ {
+		var r int32
+		if width > 0 {
+			v, err := br.Read(width)
+			if err != nil {
+				return nil, err
+			}
+			r = signExtend(v, width)
+		}
+		dst = append(dst, r)
+	}
+	return dst, nil
+}
+
+func riceDecode(br *bit.Reader, n int, M uint) ([]int32, error) {
+	return appendRice(nil, br, n, M)
+}
+
+// appendRice appends n Rice-coded values with parameter M to dst.
+func appendRice(dst []int32, br *bit.Reader, n int, M uint) ([]int32, error) {
+	start := len(dst)
+	ns := append(dst, make([]int32, n)...)
+	for i := start; i < start+n; i++ {
 		var q uint64
 		for {
 			switch b, err := br.Read(1); {
@@ -891,6 +2156,8 @@ func riceDecode(br *bit.Reader, n int, M uint) ([]int32, error) {
 			break
 		}
 
+		// For M == 0, Read consumes no bits and returns 0,
+		// leaving just the unary quotient.
 		u, err := br.Read(M)
 		if err != nil {
 			return nil, err
@@ -4,6 +4,12 @@ package flac
 
 import (
 	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
 	"testing"
 
 	"github.com/eaburns/bit"
@@ -70,22 +76,6 @@ func TestNewDecoderError(t *testing.T) {
 			},
 			"Missing STREAMINFO header",
 		},
-
-		{
-			[]byte{
-				'f', 'L', 'a', 'C',
-				0x80, 0, 0, 34, // last metadata header: stream info.
-
-				// STREAMINFO
-				0, 0, // min block size
-				0, 0, // max block size
-				0, 0, 0, // min frame size
-				0, 0, 0, // max frame size
-				0, 0, 0x04, 0x40, 0, 0, 0, 0, // rate 0, 2 channels, 8 bits/sample, 0 samples
-				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, // MD5, obviously not the true value.
-			},
-			"Bad sample rate",
-		},
 	}
 
 	for _, test := range tests {
@@ -96,6 +86,55 @@ func TestNewDecoderError(t *testing.T) {
 	}
 }
 
+func TestParseError(t *testing.T) {
+	samples := testRamp(64, 16, 1001)
+	info := StreamInfo{MinBlock: 64, MaxBlock: 64, SampleRate: 44100, NChannels: 1, BitsPerSample: 16}
+	first := verbatimFrame(0, 16, samples)
+	header := testStream(info, nil)
+	badCRC := verbatimFrame(1, 16, samples)
+	badCRC[len(badCRC)-1] ^= 0xFF
+	badBPS := info
+	badBPS.BitsPerSample = 10
+	badBlocks := info
+	badBlocks.MinBlock = 128
+
+	tests := []struct {
+		name   string
+		data   []byte
+		offset int64
+		opts   []Option
+	}{
+		{"bad magic", []byte("fLaX and more"), 4, nil},
+		{"bad block type", append(append([]byte{}, magic[:]...), 0x7F, 0, 0, 1, 0), 8, nil},
+		{"bad CRC16", testStream(info, nil, first, badCRC), int64(len(header) + len(first) + len(badCRC)), nil},
+		{"truncated frame", testStream(info, nil, first, first[:30]), int64(len(header) + len(first) + 30), nil},
+		{"bad bits per sample", testStream(badBPS, nil), int64(len(header)), nil},
+		{"strict STREAMINFO", testStream(badBlocks, nil), int64(len(header)), []Option{WithStrict()}},
+	}
+	for _, test := range tests {
+		d, err := NewDecoder(bytes.NewReader(test.data), test.opts...)
+		for err == nil {
+			_, err = d.Next()
+		}
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("%s: expected a *ParseError, got %v", test.name, err)
+			continue
+		}
+		if perr.Offset != test.offset {
+			t.Errorf("%s: expected offset %d, got %d", test.name, test.offset, perr.Offset)
+		}
+		if perr.Error() != perr.Err.Error() {
+			t.Errorf("%s: expected message %q, got %q", test.name, perr.Err.Error(), perr.Error())
+		}
+	}
+
+	// Errors that are not in the data keep their identity.
+	if _, _, err := Decode(bytes.NewReader(testStream(info, nil, first)), WithMaxMemory(16)); err != ErrMemoryLimit {
+		t.Errorf("Expected %v, got %v", ErrMemoryLimit, err)
+	}
+}
+
 func TestReadFrameHeaderError(t *testing.T) {
 	tests := []struct {
 		data []byte
@@ -277,7 +316,7 @@ func TestReadFrameHeaderError(t *testing.T) {
 				// 0001 · 1001
 				0x19,
 
-				// 2 channels · bad bits per sample · 0 reserved
+				// 2 channels · 32 bits per sample · 0 reserved
 				// 0010 · 111 · 0
 				0x2E,
 
@@ -287,7 +326,7 @@ func TestReadFrameHeaderError(t *testing.T) {
 				// CRC8—invalid
 				0x00,
 			},
-			"Bad sample size in frame header",
+			"Bad checksum",
 		},
 
 		{
@@ -505,3 +544,1899 @@ func TestReadFrameHeaderError(t *testing.T) {
 		}
 	}
 }
+
+func TestFrameGap(t *testing.T) {
+	variableFrame := func(first uint64, samples []int32) []byte {
+		h := testHeader{variable: true, blockSize: len(samples), number: first}
+		return testFrame(h, func(w *bitWriter) { writeVerbatim(w, 16, samples) })
+	}
+	info := StreamInfo{MinBlock: 16, MaxBlock: 32, SampleRate: 44100, NChannels: 1, BitsPerSample: 16}
+	samples := testRamp(32, 16, 1000)
+	data := testStream(info, nil,
+		variableFrame(0, samples[:32]),
+		variableFrame(32, samples[:16]),
+		variableFrame(64, samples[:16]), // 16 samples are missing.
+	)
+
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	gaps := []int64{0, 0, 16}
+	for i, gap := range gaps {
+		if _, err := d.Next(); err != nil {
+			t.Fatalf("Unexpected error decoding frame %d: %v", i, err)
+		}
+		if fi := d.FrameInfo(); fi.Gap != gap {
+			t.Errorf("Expected frame %d to have gap %d, got %d", i, gap, fi.Gap)
+		}
+	}
+
+	d, err = NewDecoder(bytes.NewReader(data), WithStrict())
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := d.Next(); err != nil {
+			t.Fatalf("Unexpected error decoding frame %d: %v", i, err)
+		}
+	}
+	const str = "Discontinuous frame: starts at sample 64, expected sample 48"
+	if _, err := d.Next(); err == nil || err.Error() != str {
+		t.Errorf("Expected %s, got %v", str, err)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	data, pcm := testPCMStream(44100, 16, 100, testRamp(250, 16, 300), testRamp(250, 16, 500))
+	meta, frame, err := Peek(bytes.NewReader(data))
+	switch {
+	case err != nil:
+		t.Fatalf("Unexpected error: %v", err)
+	case meta.NChannels != 2 || meta.TotalSamples != 250:
+		t.Errorf("Unexpected metadata: %+v", meta.StreamInfo)
+	case !bytes.Equal(frame, pcm[:100*2*2]):
+		t.Errorf("First frame does not match")
+	}
+
+	info := StreamInfo{SampleRate: 44100, NChannels: 1, BitsPerSample: 16}
+	meta, frame, err = Peek(bytes.NewReader(testStream(info, nil)))
+	switch {
+	case err != nil:
+		t.Fatalf("Unexpected error: %v", err)
+	case meta.StreamInfo == nil:
+		t.Errorf("Missing STREAMINFO")
+	case len(frame) != 0:
+		t.Errorf("Expected no PCM, got %d bytes", len(frame))
+	}
+}
+
+func TestLPCOrder32(t *testing.T) {
+	const order = 32
+	coeffs := make([]int32, order)
+	for i := range coeffs {
+		coeffs[i] = int32((i%7)-3) * 17
+	}
+	coeffs[0] = 127
+	samples := testRamp(300, 16, 1237)
+
+	h := testHeader{blockSize: len(samples)}
+	f := testFrame(h, func(w *bitWriter) { writeLPC(w, 16, 8, 7, coeffs, samples) })
+	info := StreamInfo{MinBlock: 300, MaxBlock: 300, SampleRate: 44100, NChannels: 1, BitsPerSample: 16}
+	d, err := NewDecoder(bytes.NewReader(testStream(info, nil, f)))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	data, err := d.Next()
+	if err != nil {
+		t.Fatalf("Unexpected error decoding: %v", err)
+	}
+	want, _ := interleave([][]int32{samples}, 16)
+	if !bytes.Equal(data, want) {
+		t.Errorf("Decoded order-32 LPC subframe does not match")
+	}
+}
+
+func TestLPCOrderExceedsBlockSize(t *testing.T) {
+	coeffs := make([]int32, 32)
+	samples := testRamp(32, 16, 1)
+	// A block of 16 samples that declares 32 warm-up samples.
+	h := testHeader{blockSize: 16}
+	f := testFrame(h, func(w *bitWriter) { writeLPC(w, 16, 8, 0, coeffs, samples) })
+	info := StreamInfo{SampleRate: 44100, NChannels: 1, BitsPerSample: 16}
+	d, err := NewDecoder(bytes.NewReader(testStream(info, nil, f)))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	const str = "Predictor order (32) exceeds block size (16)"
+	if _, err := d.Next(); err == nil || err.Error() != str {
+		t.Errorf("Expected %s, got %v", str, err)
+	}
+}
+
+func TestCRCOptions(t *testing.T) {
+	samples := testRamp(64, 16, 999)
+	info := StreamInfo{MinBlock: 64, MaxBlock: 64, SampleRate: 44100, NChannels: 1, BitsPerSample: 16}
+	f := verbatimFrame(0, 16, samples)
+	f[len(f)-10] ^= 0x01 // Flip a bit in the last sample.
+	data := testStream(info, nil, f)
+
+	tests := []struct {
+		opts  []Option
+		err   string
+		valid bool
+	}{
+		{nil, "Bad checksum", false},
+		{[]Option{WithIgnoreCRC()}, "", false},
+		{[]Option{WithoutCRC()}, "", true},
+	}
+	for _, test := range tests {
+		d, err := NewDecoder(bytes.NewReader(data), test.opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error making a new decoder: %v", err)
+		}
+		_, err = d.Next()
+		switch {
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("Expected %s, got %v", test.err, err)
+		case test.err == "" && err != nil:
+			t.Errorf("Unexpected error: %v", err)
+		case test.err == "" && d.FrameInfo().CRCValid != test.valid:
+			t.Errorf("Expected CRCValid %v, got %v", test.valid, d.FrameInfo().CRCValid)
+		}
+	}
+}
+
+func TestSamples(t *testing.T) {
+	left, right := testRamp(250, 16, 300), testRamp(250, 16, 500)
+	data, _ := testPCMStream(44100, 16, 64, left, right)
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	next := d.Samples()
+	n := 0
+	for s, ok := next(); ok; s, ok = next() {
+		if len(s) != 2 || s[0] != left[n] || s[1] != right[n] {
+			t.Fatalf("Expected sample %d to be [%d %d], got %v", n, left[n], right[n], s)
+		}
+		n++
+	}
+	if n != len(left) {
+		t.Errorf("Expected %d samples, got %d", len(left), n)
+	}
+	if err := d.Err(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, ok := next(); ok {
+		t.Errorf("Expected iteration to stay finished")
+	}
+
+	// A stray byte after the last frame is a truncated frame header.
+	d, err = NewDecoder(bytes.NewReader(append(data, 0xFF)))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	next = d.Samples()
+	for _, ok := next(); ok; _, ok = next() {
+	}
+	if d.Err() == nil {
+		t.Errorf("Expected an error for a truncated stream")
+	}
+}
+
+func TestRiceDecodeZeroParameter(t *testing.T) {
+	vals := []int32{0, -1, 1, -2, 2, 3, -4, 0}
+	w := new(bitWriter)
+	for _, v := range vals {
+		w.writeRice(v, 0)
+	}
+	w.write(0x5, 3) // Trailing bits that must not be consumed.
+	br := bit.NewReader(bytes.NewReader(w.bytes()))
+
+	got, err := riceDecode(br, len(vals), 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := range vals {
+		if got[i] != vals[i] {
+			t.Errorf("Expected residual %d to be %d, got %d", i, vals[i], got[i])
+		}
+	}
+	if v, err := br.Read(3); err != nil || v != 0x5 {
+		t.Errorf("Expected trailing bits 0x5, got %#x (%v)", v, err)
+	}
+}
+
+func TestTruncatedFrame(t *testing.T) {
+	coeffs := []int32{60, -30, 12, -5}
+	samples := testRamp(64, 16, 2047)
+	info := StreamInfo{MinBlock: 64, MaxBlock: 64, SampleRate: 44100, NChannels: 2, BitsPerSample: 16}
+	f := testFrame(testHeader{blockSize: 64, assign: 1}, func(w *bitWriter) {
+		writeLPC(w, 16, 8, 5, coeffs, samples)
+		writeVerbatim(w, 16, samples)
+	})
+	header := testStream(info, nil)
+
+	fields := make(map[string]bool)
+	for n := 1; n < len(f); n++ {
+		d, err := NewDecoder(bytes.NewReader(append(header, f[:n]...)))
+		if err != nil {
+			t.Fatalf("Unexpected error making a new decoder: %v", err)
+		}
+		_, err = d.Next()
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Expected a frame truncated to %d bytes to fail with %v, got %v", n, io.ErrUnexpectedEOF, err)
+			continue
+		}
+		if i := strings.Index(err.Error(), "reading "); i >= 0 {
+			fields[strings.TrimSuffix(err.Error()[i+len("reading "):], ": unexpected EOF")] = true
+		}
+	}
+	for _, field := range []string{"frame header", "subframe header", "warm-up sample", "LPC coefficient", "residual", "verbatim sample", "frame footer"} {
+		if !fields[field] {
+			t.Errorf("Expected a truncation while reading %s", field)
+		}
+	}
+}
+
+func TestTruncatedMetadata(t *testing.T) {
+	info := StreamInfo{MinBlock: 64, MaxBlock: 64, SampleRate: 44100, NChannels: 2, BitsPerSample: 16}
+	comment := metaBlock(VorbisCommentType, true, []byte("\x03\x00\x00\x00abc\x00\x00\x00\x00"))
+	header := testStream(info, [][]byte{comment})
+
+	for n := len(magic); n < len(header); n++ {
+		_, err := NewDecoder(bytes.NewReader(header[:n]))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Expected metadata truncated to %d bytes to fail with %v, got %v", n, io.ErrUnexpectedEOF, err)
+		}
+		_, _, err = ReadTagsBuffered(bytes.NewReader(header[:n]))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Expected reading tags truncated to %d bytes to fail with %v, got %v", n, io.ErrUnexpectedEOF, err)
+		}
+	}
+	if _, err := NewDecoder(bytes.NewReader(header), WithRawMetadata()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestConcurrentDecoders(t *testing.T) {
+	left, right := testRamp(5000, 16, 77), testRamp(5000, 16, 91)
+	data, pcm := testPCMStream(44100, 16, 512, left, right)
+
+	errs := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			for j := 0; j < 10; j++ {
+				out, _, err := Decode(bytes.NewReader(data))
+				if err == nil && !bytes.Equal(out, pcm) {
+					err = errors.New("Decoded PCM does not match")
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func BenchmarkDecodeParallel(b *testing.B) {
+	left, right := testRamp(44100, 16, 77), testRamp(44100, 16, 91)
+	data, _ := testPCMStream(44100, 16, 4096, left, right)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, _, err := Decode(bytes.NewReader(data)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestHasFrameSizeInfo(t *testing.T) {
+	tests := []struct {
+		min, max int
+		has      bool
+	}{
+		{0, 0, false},
+		{0, 1000, false},
+		{14, 0, false},
+		{14, 1000, true},
+	}
+	for _, test := range tests {
+		info := StreamInfo{MinFrame: test.min, MaxFrame: test.max}
+		if has := info.HasFrameSizeInfo(); has != test.has {
+			t.Errorf("Expected HasFrameSizeInfo of %d, %d to be %v, got %v", test.min, test.max, test.has, has)
+		}
+	}
+}
+
+func TestMultichannelIndependent(t *testing.T) {
+	// Streams of more than 2 channels can only code them independently.
+	for _, nChannels := range []int{3, 4, 6, 8} {
+		for _, bps := range []int{8, 16, 24} {
+			chans := make([][]int32, nChannels)
+			for ch := range chans {
+				chans[ch] = testRamp(300, bps, 11*(ch+1))
+			}
+			data, _ := testPCMStream(48000, bps, 128, chans...)
+
+			// Build the expected interleaving by hand: each inter-channel
+			// sample holds the channels in FLAC order, little-endian.
+			var want []byte
+			for i := range chans[0] {
+				for ch := range chans {
+					s := chans[ch][i]
+					for b := 0; b < bps/8; b++ {
+						want = append(want, byte(s>>uint(8*b)))
+					}
+				}
+			}
+
+			got, meta, err := Decode(bytes.NewReader(data))
+			switch {
+			case err != nil:
+				t.Errorf("%d channels, %d bits: unexpected error: %v", nChannels, bps, err)
+			case meta.NChannels != nChannels:
+				t.Errorf("%d channels, %d bits: got %d channels", nChannels, bps, meta.NChannels)
+			case !bytes.Equal(got, want):
+				t.Errorf("%d channels, %d bits: samples are misordered", nChannels, bps)
+			}
+		}
+	}
+}
+
+func TestHeaderSize(t *testing.T) {
+	info := StreamInfo{MinBlock: 16, MaxBlock: 16, SampleRate: 44100, NChannels: 1, BitsPerSample: 16}
+	padding := metaBlock(PaddingType, true, make([]byte, 100))
+	frame := verbatimFrame(0, 16, testRamp(16, 16, 1))
+	data := testStream(info, [][]byte{padding}, frame)
+
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	want := int64(4 + (4 + 34) + (4 + 100))
+	if n := d.HeaderSize(); n != want {
+		t.Errorf("Expected header size %d, got %d", want, n)
+	}
+	if !bytes.Equal(data[want:], frame) {
+		t.Errorf("Expected the first frame to start at offset %d", want)
+	}
+}
+
+func BenchmarkReadSubFrame(b *testing.B) {
+	w := new(bitWriter)
+	writeLPC(w, 16, 12, 10, []int32{1800, -1200, 600, -300, 150, -75, 30, -10}, testRamp(4096, 16, 37))
+	sub := w.bytes()
+	h := &frameHeader{blockSize: 4096, sampleSize: 16, channelAssignment: 0}
+	var dst []int32
+	var s subframeScratch[int32]
+	var info SubframeInfo
+	r := bytes.NewReader(sub)
+	b.SetBytes(int64(len(sub)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(sub)
+		var err error
+		if dst, err = readSubFrame(bit.NewReader(r), h, 0, dst, &info, false, &s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNext(b *testing.B) {
+	data := testTrack(30 * 44100)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d, err := NewDecoder(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for {
+			if _, err := d.Next(); err == io.EOF {
+				break
+			} else if err != nil {
+				b.Fatal(err)
+			}
+		}
+		d.Close()
+	}
+}
+
+func TestLenientBlockSize(t *testing.T) {
+	samples := testRamp(64, 16, 999)
+	h := testHeader{reservedBlockCode: true, assign: 0, number: 1}
+	frame := testFrame(h, func(w *bitWriter) { writeVerbatim(w, 16, samples[32:]) })
+
+	tests := []struct {
+		opts     []Option
+		min, max int
+		err      bool
+	}{
+		{nil, 32, 32, true},
+		{[]Option{WithLenientBlockSize()}, 32, 32, false},
+		{[]Option{WithLenientBlockSize()}, 16, 32, true},
+	}
+	for _, test := range tests {
+		info := StreamInfo{MinBlock: test.min, MaxBlock: test.max, SampleRate: 44100, NChannels: 1, BitsPerSample: 16}
+		data := testStream(info, nil, verbatimFrame(0, 16, samples[:32]), frame)
+		d, err := NewDecoder(bytes.NewReader(data), test.opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error making a new decoder: %v", err)
+		}
+		if _, err := d.Next(); err != nil {
+			t.Fatalf("Unexpected error decoding the first frame: %v", err)
+		}
+		_, err = d.Next()
+		switch {
+		case test.err && !errors.Is(err, errBlockSize):
+			t.Errorf("%d–%d: expected a bad block size error, got %v", test.min, test.max, err)
+		case !test.err && err != nil:
+			t.Errorf("%d–%d: unexpected error: %v", test.min, test.max, err)
+		case !test.err && (d.FrameInfo().BlockSize != 32 || d.FrameInfo().FirstSample != 32):
+			t.Errorf("%d–%d: expected a 32 sample frame at sample 32, got %+v", test.min, test.max, d.FrameInfo())
+		}
+	}
+}
+
+func TestDecodeFrame(t *testing.T) {
+	left, right := testRamp(100, 16, 301), testRamp(100, 16, 7)
+	info := StreamInfo{MinBlock: 100, MaxBlock: 100, SampleRate: 44100, NChannels: 2, BitsPerSample: 16}
+	frame := verbatimFrame(3, 16, left, right)
+	want, err := interleave([][]int32{left, right}, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := append(append([]byte{}, frame...), verbatimFrame(4, 16, left, right)...)
+	data, fi, n, err := DecodeFrame(b, info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != len(frame) {
+		t.Errorf("Expected %d bytes consumed, got %d", len(frame), n)
+	}
+	if fi.Number != 3 || fi.FirstSample != 300 || fi.BlockSize != 100 {
+		t.Errorf("Unexpected frame info: %+v", fi)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("Decoded data does not match")
+	}
+
+	if _, _, _, err := DecodeFrame(nil, info); err != io.EOF {
+		t.Errorf("Expected io.EOF for an empty slice, got %v", err)
+	}
+	for _, n := range []int{1, 5, len(frame) / 2, len(frame) - 1} {
+		if _, _, _, err := DecodeFrame(frame[:n], info); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%d of %d bytes: expected io.ErrUnexpectedEOF, got %v", n, len(frame), err)
+		}
+	}
+	bad := append([]byte{}, frame...)
+	bad[len(bad)/2] ^= 0x01
+	if _, _, _, err := DecodeFrame(bad, info); err == nil || err.Error() != "Bad checksum" {
+		t.Errorf("Expected Bad checksum, got %v", err)
+	}
+}
+
+func TestResidualPartitions(t *testing.T) {
+	tests := []struct {
+		blkSize, predO int
+		partO          uint64
+		err            string
+	}{
+		{16, 2, 3, ""},
+		{16, 2, 1, ""},
+		{10, 1, 2, "Residual partition order (2) is invalid for block size (10) and predictor order (1)"},
+		{16, 2, 4, "Residual partition order (4) is invalid for block size (16) and predictor order (2)"},
+		{4, 4, 0, ""},
+	}
+	for _, test := range tests {
+		w := new(bitWriter)
+		w.write(0, 2)
+		w.write(test.partO, 4)
+		for i := 0; i < 1<<test.partO; i++ {
+			w.write(1, 4)
+			n := test.blkSize >> test.partO
+			if i == 0 {
+				n -= test.predO
+			}
+			for j := 0; j < n && n > 0; j++ {
+				w.writeRice(int32(j), 1)
+			}
+		}
+		residual, err := decodeResiduals(bit.NewReader(bytes.NewReader(w.bytes())), test.blkSize, test.predO)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%+v: unexpected error: %v", test, err)
+		case test.err == "" && len(residual) != test.blkSize-test.predO:
+			t.Errorf("%+v: expected %d residuals, got %d", test, test.blkSize-test.predO, len(residual))
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("%+v: expected error %q, got %v", test, test.err, err)
+		}
+	}
+}
+
+func TestNewDecoderWithStart(t *testing.T) {
+	samples := testRamp(640, 16, 99)
+	info := StreamInfo{MinBlock: 128, MaxBlock: 128, SampleRate: 44100, NChannels: 1, BitsPerSample: 16, TotalSamples: 640}
+	var piece []byte
+	for i := 2; i < 5; i++ {
+		piece = append(piece, verbatimFrame(uint64(i), 16, samples[i*128:(i+1)*128])...)
+	}
+
+	d, err := NewDecoderWithStart(bytes.NewReader(piece), info, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if d.Position() != 0 {
+		t.Errorf("Expected position 0 before decoding, got %d", d.Position())
+	}
+	var got []byte
+	for {
+		data, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if d.FrameInfo().Gap != 0 {
+			t.Errorf("Unexpected gap %d at frame %d", d.FrameInfo().Gap, d.FrameInfo().Number)
+		}
+		got = append(got, data...)
+	}
+	want, _ := interleave([][]int32{samples[256:]}, 16)
+	if !bytes.Equal(got, want) {
+		t.Errorf("Decoded data does not match")
+	}
+	if d.Position() != 640 || d.FrameInfo().FirstSample != 512 {
+		t.Errorf("Expected position 640 after a frame at 512, got %d after %d", d.Position(), d.FrameInfo().FirstSample)
+	}
+
+	d, err = NewDecoderWithStart(bytes.NewReader(piece), info, 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := d.Next(); err == nil || err.Error() != "First frame number is 2, expected 3" {
+		t.Errorf("Expected a first frame number error, got %v", err)
+	}
+}
+
+func TestDecodePartial(t *testing.T) {
+	samples := testRamp(1000, 16, 313)
+	data, pcm := testPCMStream(44100, 16, 256, samples)
+	// Corrupt the last of the four frames.
+	bad := append([]byte{}, data...)
+	bad[len(bad)-20] ^= 0x01
+
+	if got, _, err := Decode(bytes.NewReader(bad)); got != nil || err == nil {
+		t.Errorf("Decode: expected no data and an error, got %d bytes, %v", len(got), err)
+	}
+	got, meta, err := DecodePartial(bytes.NewReader(bad))
+	if err == nil || err.Error() != "Bad checksum" {
+		t.Errorf("Expected Bad checksum, got %v", err)
+	}
+	if meta.StreamInfo == nil || meta.TotalSamples != 1000 {
+		t.Errorf("Expected the metadata, got %+v", meta)
+	}
+	if !bytes.Equal(got, pcm[:3*256*2]) {
+		t.Errorf("Expected the first three frames, got %d bytes", len(got))
+	}
+
+	got, _, err = DecodePartial(bytes.NewReader(data))
+	if err != nil || !bytes.Equal(got, pcm) {
+		t.Errorf("Expected all data and no error, got %d bytes, %v", len(got), err)
+	}
+}
+
+func TestRawStreamInfo(t *testing.T) {
+	info := StreamInfo{MinBlock: 4096, MaxBlock: 4096, MinFrame: 14, MaxFrame: 9000, SampleRate: 48000, NChannels: 2, BitsPerSample: 24, TotalSamples: 123456789}
+	info.MD5[0], info.MD5[15] = 0xAB, 0xCD
+	body := streamInfoBody(info)
+	meta, _, err := Peek(bytes.NewReader(testStream(info, nil)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	raw := meta.RawStreamInfo()
+	if len(raw) != 34 || !bytes.Equal(raw, body) {
+		t.Errorf("Expected % x, got % x", body, raw)
+	}
+	raw[0] ^= 0xFF
+	if !bytes.Equal(meta.RawStreamInfo(), body) {
+		t.Errorf("Modifying the returned bytes changed the metadata")
+	}
+	if (MetaData{}).RawStreamInfo() != nil {
+		t.Errorf("Expected nil for empty metadata")
+	}
+}
+
+func TestRawMetadata(t *testing.T) {
+	info := StreamInfo{MinBlock: 16, MaxBlock: 16, SampleRate: 44100, NChannels: 1, BitsPerSample: 16}
+	blocks := [][]byte{
+		metaBlock(ApplicationType, false, []byte("abcd\x01\x02\x03")),
+		metaBlock(SeekTableType, false, make([]byte, 18)),
+		metaBlock(CueSheetType, false, cueSheetBody(CueSheet{Tracks: []CueTrack{{Number: 1, Audio: true}, {Offset: 16, Number: 170}}})),
+		metaBlock(PictureType, false, pictureBody(Picture{Type: 3, MIME: "image/png", Data: []byte{1, 2}})),
+		metaBlock(PaddingType, true, make([]byte, 5)),
+	}
+	data := testStream(info, blocks)
+
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if d.Blocks != nil {
+		t.Errorf("Expected no raw blocks without WithRawMetadata, got %d", len(d.Blocks))
+	}
+
+	d, err = NewDecoder(bytes.NewReader(data), WithRawMetadata())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(d.Blocks) != len(blocks)+1 {
+		t.Fatalf("Expected %d raw blocks, got %d", len(blocks)+1, len(d.Blocks))
+	}
+	var got []byte
+	for _, b := range d.Blocks {
+		got = append(got, b.Bytes()...)
+	}
+	if want := data[len(magic):]; !bytes.Equal(got, want) {
+		t.Errorf("Re-encoded blocks do not match the original:\n% x\n% x", got, want)
+	}
+	if len(d.Pictures) != 1 || d.VorbisComment != nil {
+		t.Errorf("Expected parsed blocks to be parsed as usual")
+	}
+	if want := []BlockType{ApplicationType, PaddingType}; fmt.Sprint(d.SkippedBlocks) != fmt.Sprint(want) {
+		t.Errorf("Expected skipped blocks %v, got %v", want, d.SkippedBlocks)
+	}
+}
+
+func TestFrameInfoSubframes(t *testing.T) {
+	samples := testRamp(100, 16, 1001)
+	info := StreamInfo{MinBlock: 64, MaxBlock: 64, SampleRate: 44100, NChannels: 1, BitsPerSample: 16, TotalSamples: 100}
+	lpc := testFrame(testHeader{blockSize: 36, number: 1}, func(w *bitWriter) {
+		writeLPC(w, 16, 4, 0, []int32{2, -1}, samples[64:])
+	})
+	data := testStream(info, nil, verbatimFrame(0, 16, samples[:64]), lpc)
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := d.Next(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	first := d.FrameInfo()
+	if _, err := d.Next(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The subframes of a returned FrameInfo are not reused by the next frame.
+	if first.Subframes[0].Type != "SUBFRAME_VERBATIM" {
+		t.Errorf("Expected SUBFRAME_VERBATIM, got %s", first.Subframes[0].Type)
+	}
+	if sf := d.FrameInfo().Subframes[0]; sf.Type != "SUBFRAME_LPC" || sf.Order != 2 {
+		t.Errorf("Expected an order 2 SUBFRAME_LPC, got %+v", sf)
+	}
+}
+
+func TestPadding(t *testing.T) {
+	info := StreamInfo{MinBlock: 16, MaxBlock: 16, SampleRate: 44100, NChannels: 1, BitsPerSample: 16}
+	blocks := [][]byte{
+		metaBlock(PaddingType, false, make([]byte, 10)),
+		metaBlock(ApplicationType, false, []byte("abcd")),
+		metaBlock(PaddingType, true, make([]byte, 100)),
+	}
+	data := testStream(info, blocks)
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []PaddingBlock{{Index: 1, Offset: 42, Size: 10}, {Index: 3, Offset: 64, Size: 100}}
+	if got := d.Padding(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	for _, p := range want {
+		if data[p.Offset]&0x7F != byte(PaddingType) {
+			t.Errorf("Expected a PADDING block header at offset %d", p.Offset)
+		}
+	}
+	if n := d.PaddingSize(); n != 110 {
+		t.Errorf("Expected 110 bytes of padding, got %d", n)
+	}
+
+	d, err = NewDecoder(bytes.NewReader(testStream(info, nil)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if d.Padding() != nil || d.PaddingSize() != 0 {
+		t.Errorf("Expected no padding, got %v", d.Padding())
+	}
+}
+
+func TestChannelCountMismatch(t *testing.T) {
+	a, b, c := testRamp(16, 16, 5), testRamp(16, 16, 7), testRamp(16, 16, 9)
+	tests := []struct {
+		nChannels int
+		frame     []byte
+		err       string
+	}{
+		{3, verbatimFrame(0, 16, a, b, c), ""},
+		{2, verbatimFrame(0, 16, a, b), ""},
+		{2, testFrame(testHeader{blockSize: 16, assign: midSide}, func(w *bitWriter) {
+			writeVerbatim(w, 16, a)
+			writeVerbatim(w, 17, b)
+		}), ""},
+		{2, verbatimFrame(0, 16, a, b, c), "Frame has 3 channels, but STREAMINFO has 2"},
+		{6, verbatimFrame(0, 16, a, b), "Frame has 2 channels, but STREAMINFO has 6"},
+		{1, testFrame(testHeader{blockSize: 16, assign: leftSide}, func(w *bitWriter) {
+			writeVerbatim(w, 16, a)
+			writeVerbatim(w, 17, b)
+		}), "Frame has left/side coded channels, but STREAMINFO has 1; side coding needs exactly 2 channels"},
+		{6, testFrame(testHeader{blockSize: 16, assign: midSide}, func(w *bitWriter) {
+			writeVerbatim(w, 16, a)
+			writeVerbatim(w, 17, b)
+		}), "Frame has mid/side coded channels, but STREAMINFO has 6; side coding needs exactly 2 channels"},
+	}
+	for _, test := range tests {
+		info := StreamInfo{MinBlock: 16, MaxBlock: 16, SampleRate: 44100, NChannels: test.nChannels, BitsPerSample: 16}
+		d, err := NewDecoder(bytes.NewReader(testStream(info, nil, test.frame)))
+		if err != nil {
+			t.Fatalf("Unexpected error making a new decoder: %v", err)
+		}
+		_, err = d.Next()
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%d channels: unexpected error: %v", test.nChannels, err)
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("%d channels: expected %q, got %v", test.nChannels, test.err, err)
+		}
+	}
+}
+
+func TestFrameSampleRate(t *testing.T) {
+	samples := testRamp(16, 16, 5)
+	tests := []struct {
+		h      testHeader
+		strict bool
+		rate   int
+		err    string
+	}{
+		{h: testHeader{}, rate: 48000},
+		{h: testHeader{rateCode: 10}, strict: true, rate: 48000},
+		{h: testHeader{rateCode: 12, rate: 48000}, strict: true, rate: 48000},
+		{h: testHeader{rateCode: 12, rate: 22000}, rate: 22000},
+		{h: testHeader{rateCode: 13, rate: 48000}, strict: true, rate: 48000},
+		{h: testHeader{rateCode: 14, rate: 48000}, strict: true, rate: 48000},
+		{h: testHeader{rateCode: 13, rate: 22050}, rate: 22050},
+		{h: testHeader{rateCode: 13, rate: 22050}, strict: true, err: "Frame has sample rate 22050, but STREAMINFO has 48000"},
+		{h: testHeader{rateCode: 12, rate: 0}, err: "Failed to read the frame header: Bad sample rate (0) in frame header"},
+		{h: testHeader{rateCode: 13, rate: 0}, err: "Failed to read the frame header: Bad sample rate (0) in frame header"},
+		{h: testHeader{rateCode: 14, rate: 0}, err: "Failed to read the frame header: Bad sample rate (0) in frame header"},
+		{h: testHeader{rateCode: 15}, err: "Failed to read the frame header: Invalid sample rate code (15) in frame header"},
+	}
+	for _, test := range tests {
+		test.h.blockSize = 16
+		frame := testFrame(test.h, func(w *bitWriter) { writeVerbatim(w, 16, samples) })
+		info := StreamInfo{MinBlock: 16, MaxBlock: 16, SampleRate: 48000, NChannels: 1, BitsPerSample: 16}
+		var opts []Option
+		if test.strict {
+			opts = append(opts, WithStrict())
+		}
+		d, err := NewDecoder(bytes.NewReader(testStream(info, nil, frame)), opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error making a new decoder: %v", err)
+		}
+		if rate := d.CurrentSampleRate(); rate != 48000 {
+			t.Errorf("%+v: expected current sample rate 48000 before decoding, got %d", test.h, rate)
+		}
+		_, err = d.Next()
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%+v: unexpected error: %v", test.h, err)
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("%+v: expected %q, got %v", test.h, test.err, err)
+		case test.err == "" && d.FrameInfo().SampleRate != test.rate:
+			t.Errorf("%+v: expected sample rate %d, got %d", test.h, test.rate, d.FrameInfo().SampleRate)
+		case test.err == "" && d.CurrentSampleRate() != test.rate:
+			t.Errorf("%+v: expected current sample rate %d, got %d", test.h, test.rate, d.CurrentSampleRate())
+		}
+	}
+}
+
+func TestSampleTransform(t *testing.T) {
+	left, right := testRamp(300, 16, 37), testRamp(300, 16, 91)
+	stream, _ := testPCMStream(44100, 16, 128, left, right)
+	// Halve the gain of the left channel and invert the right one.
+	gain := func(ch int, samples []int32) {
+		for i := range samples {
+			if ch == 0 {
+				samples[i] /= 2
+			} else {
+				samples[i] = -samples[i] - 1
+			}
+		}
+	}
+	got, _, err := Decode(bytes.NewReader(stream), WithSampleTransform(gain))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wantL, wantR := make([]int32, len(left)), make([]int32, len(right))
+	for i := range left {
+		wantL[i], wantR[i] = left[i]/2, -right[i]-1
+	}
+	want, err := interleave([][]int32{wantL, wantR}, 16)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Transformed data does not match")
+	}
+}
+
+func TestSingleSampleFrame(t *testing.T) {
+	first := testRamp(16, 16, 1001)
+	last := []int32{-1234}
+	writeFixed := func(w *bitWriter, order int) {
+		w.write(0, 1)
+		w.write(uint64(subFrameFixed)|uint64(order), 6)
+		w.write(0, 1)
+		for _, s := range last[:order] {
+			w.writeSigned(int64(s), 16)
+		}
+		w.write(0, 2)
+		w.write(0, 4)
+		w.write(3, 4)
+		for _, s := range last[order:] {
+			w.writeRice(s, 3)
+		}
+	}
+	tests := []struct {
+		name string
+		h    testHeader
+		body func(w *bitWriter)
+		err  string
+	}{
+		{"verbatim", testHeader{}, func(w *bitWriter) { writeVerbatim(w, 16, last) }, ""},
+		{"verbatim 8-bit size", testHeader{blockCode: 6}, func(w *bitWriter) { writeVerbatim(w, 16, last) }, ""},
+		{"constant", testHeader{}, func(w *bitWriter) {
+			w.write(0, 1)
+			w.write(uint64(subFrameConstant), 6)
+			w.write(0, 1)
+			w.writeSigned(int64(last[0]), 16)
+		}, ""},
+		{"fixed order 0", testHeader{}, func(w *bitWriter) { writeFixed(w, 0) }, ""},
+		{"fixed order 1", testHeader{}, func(w *bitWriter) { writeFixed(w, 1) }, ""},
+		{"LPC order 1", testHeader{}, func(w *bitWriter) { writeLPC(w, 16, 4, 0, []int32{1}, last) }, ""},
+		{"fixed order 2", testHeader{}, func(w *bitWriter) {
+			w.write(0, 1)
+			w.write(uint64(subFrameFixed)|2, 6)
+			w.write(0, 1)
+		}, "Predictor order (2) exceeds block size (1)"},
+		{"partition order 1", testHeader{}, func(w *bitWriter) {
+			w.write(0, 1)
+			w.write(uint64(subFrameFixed), 6)
+			w.write(0, 1)
+			w.write(0, 2)
+			w.write(1, 4)
+		}, "Residual partition order (1) is invalid for block size (1) and predictor order (0)"},
+	}
+	for _, test := range tests {
+		test.h.blockSize = 1
+		test.h.number = 1
+		info := StreamInfo{MinBlock: 16, MaxBlock: 16, SampleRate: 44100, NChannels: 1, BitsPerSample: 16, TotalSamples: 17}
+		pcm, err := interleave([][]int32{append(append([]int32{}, first...), last...)}, 16)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		info.MD5 = md5.Sum(pcm)
+		stream := testStream(info, nil, verbatimFrame(0, 16, first), testFrame(test.h, test.body))
+		got, _, err := Decode(bytes.NewReader(stream), WithStrict())
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: expected %q, got %v", test.name, test.err, err)
+		case test.err == "" && !bytes.Equal(got, pcm):
+			t.Errorf("%s: expected % x, got % x", test.name, pcm, got)
+		}
+	}
+}
+
+func TestSelectChannels(t *testing.T) {
+	a, b, c := testRamp(128, 16, 11), testRamp(128, 16, 23), testRamp(128, 16, 47)
+	stream, pcm := testPCMStream(44100, 16, 32, a, b, c)
+	d, err := NewDecoder(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	for _, bad := range [][]int{{3}, {0, -1}} {
+		if err := d.SelectChannels(bad); err == nil {
+			t.Errorf("Expected an error selecting channels %v", bad)
+		}
+	}
+
+	tests := []struct {
+		channels []int
+		want     [][]int32
+	}{
+		{[]int{2}, [][]int32{c}},
+		{[]int{1, 0}, [][]int32{b, a}},
+		{[]int{0, 2, 2}, [][]int32{a, c, c}},
+		{nil, [][]int32{a, b, c}},
+	}
+	var got []byte
+	for i, test := range tests {
+		if err := d.SelectChannels(test.channels); err != nil {
+			t.Fatalf("Unexpected error selecting channels %v: %v", test.channels, err)
+		}
+		frame, err := d.Next()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		part := make([][]int32, len(test.want))
+		for ch := range part {
+			part[ch] = test.want[ch][i*32 : (i+1)*32]
+		}
+		want, err := interleave(part, 16)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !bytes.Equal(frame, want) {
+			t.Errorf("Channels %v: decoded data does not match", test.channels)
+		}
+		got = frame
+	}
+	if !bytes.Equal(got, pcm[3*32*6:4*32*6]) {
+		t.Errorf("Expected all channels after resetting the selection")
+	}
+}
+
+func TestParseFrameHeader(t *testing.T) {
+	info := StreamInfo{MinBlock: 64, MaxBlock: 64, SampleRate: 44100, NChannels: 2, BitsPerSample: 16}
+	samples := testRamp(36, 16, 1001)
+	frame := testFrame(testHeader{blockSize: 36, number: 3, assign: midSide, rateCode: 13, rate: 22050}, func(w *bitWriter) {
+		writeVerbatim(w, 16, samples)
+		writeVerbatim(w, 17, samples)
+	})
+	r := bytes.NewReader(frame)
+	f, err := ParseFrameHeader(r, info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := FrameInfo{Number: 3, FirstSample: 192, BlockSize: 36, SampleRate: 22050, NChannels: 2,
+		BitsPerSample: 16, CRCValid: true, ChannelAssignment: "mid/side"}
+	if f.Number != want.Number || f.FirstSample != want.FirstSample || f.BlockSize != want.BlockSize ||
+		f.SampleRate != want.SampleRate || f.NChannels != want.NChannels || f.BitsPerSample != want.BitsPerSample ||
+		f.CRCValid != want.CRCValid || f.ChannelAssignment != want.ChannelAssignment || f.Subframes != nil {
+		t.Errorf("Expected %+v, got %+v", want, f)
+	}
+	// Number, code byte, rate code byte, 16-bit block size, 16-bit rate, and CRC8.
+	if n := len(frame) - r.Len(); n != 4+1+2+2+1 {
+		t.Errorf("Expected to read a 10-byte header, read %d bytes", n)
+	}
+
+	bad := append([]byte{}, frame...)
+	bad[9]++
+	if _, err := ParseFrameHeader(bytes.NewReader(bad), info); err == nil || !strings.Contains(err.Error(), "Bad checksum") {
+		t.Errorf("Expected a CRC error, got %v", err)
+	}
+	if _, err := ParseFrameHeader(bytes.NewReader(nil), info); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
+func TestReservedSubFrameType(t *testing.T) {
+	var reserved []uint64
+	for k := uint64(0); k < 64; k++ {
+		switch {
+		case k <= 1, k >= 0x08 && k <= 0x0C, k >= 0x20:
+			// Constant, verbatim, fixed orders 0–4, and LPC.
+		default:
+			reserved = append(reserved, k)
+		}
+	}
+	if len(reserved) != 2+4+3+16 {
+		t.Fatalf("Expected 25 reserved codes, got %d", len(reserved))
+	}
+	info := StreamInfo{MinBlock: 16, MaxBlock: 16, SampleRate: 44100, NChannels: 2, BitsPerSample: 16}
+	samples := testRamp(16, 16, 1001)
+	for _, k := range reserved {
+		frame := testFrame(testHeader{blockSize: 16, number: 5, assign: 1}, func(w *bitWriter) {
+			writeVerbatim(w, 16, samples)
+			w.write(0, 1)
+			w.write(k, 6)
+			w.write(0, 1)
+			for _, s := range samples {
+				w.writeSigned(int64(s), 16)
+			}
+		})
+		_, _, _, err := DecodeFrame(frame, info)
+		want := fmt.Sprintf("Frame 5, channel 1: Reserved subframe type 0x%02X (%06b)", k, k)
+		if err == nil || err.Error() != want {
+			t.Errorf("Type %#x: expected %q, got %v", k, want, err)
+		}
+	}
+}
+
+func TestConstantWastedBits(t *testing.T) {
+	// writeConstant writes a SUBFRAME_CONSTANT of v, which has its low wasted bits clear.
+	writeConstant := func(w *bitWriter, bps uint, v int32, wasted uint) {
+		w.write(0, 1)
+		w.write(uint64(subFrameConstant), 6)
+		w.write(1, 1)
+		w.writeUnary(uint64(wasted - 1))
+		w.writeSigned(int64(v>>wasted), bps-wasted)
+	}
+	info := StreamInfo{MinBlock: 16, MaxBlock: 16, SampleRate: 44100, NChannels: 2, BitsPerSample: 16}
+
+	left := make([]int32, 16)
+	for i := range left {
+		left[i] = -1234 << 3
+	}
+	right := testRamp(16, 16, 1001)
+	frame := testFrame(testHeader{blockSize: 16, assign: 1}, func(w *bitWriter) {
+		writeConstant(w, 16, left[0], 3)
+		writeVerbatim(w, 16, right)
+	})
+	got, _, _, err := DecodeFrame(frame, info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want, _ := interleave([][]int32{left, right}, 16); !bytes.Equal(got, want) {
+		t.Errorf("Decoded data does not match for independent channels")
+	}
+
+	// The side channel has 17 bits, less the wasted bits.
+	right = make([]int32, 16)
+	side := int32(-3 << 13)
+	for i := range right {
+		right[i] = left[i] - side
+	}
+	frame = testFrame(testHeader{blockSize: 16, assign: leftSide}, func(w *bitWriter) {
+		writeConstant(w, 16, left[0], 3)
+		writeConstant(w, 17, side, 13)
+	})
+	got, _, _, err = DecodeFrame(frame, info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want, _ := interleave([][]int32{left, right}, 16); !bytes.Equal(got, want) {
+		t.Errorf("Decoded data does not match for left/side channels")
+	}
+
+	frame = testFrame(testHeader{blockSize: 16, assign: 1}, func(w *bitWriter) {
+		writeConstant(w, 16, 0, 16)
+		writeVerbatim(w, 16, right)
+	})
+	if _, _, _, err := DecodeFrame(frame, info); err == nil {
+		t.Errorf("Expected an error for 16 wasted bits of 16-bit samples")
+	}
+}
+
+func TestPeekFrameSize(t *testing.T) {
+	samples := testRamp(100, 16, 1001)
+	info := StreamInfo{MinBlock: 64, MaxBlock: 64, SampleRate: 44100, NChannels: 1, BitsPerSample: 16, TotalSamples: 100}
+	frames := [][]byte{
+		verbatimFrame(0, 16, samples[:64]),
+		testFrame(testHeader{blockSize: 36, blockCode: 6, number: 1}, func(w *bitWriter) { writeVerbatim(w, 16, samples[64:]) }),
+	}
+	d, err := NewDecoder(bytes.NewReader(testStream(info, nil, frames...)))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	for i, want := range []int{64, 36} {
+		for j := 0; j < 2; j++ {
+			if n, err := d.PeekFrameSize(); err != nil || n != want {
+				t.Errorf("Frame %d: expected %d samples, got %d, %v", i, want, n, err)
+			}
+		}
+		frame, err := d.Next()
+		if err != nil {
+			t.Fatalf("Frame %d: unexpected error: %v", i, err)
+		}
+		if len(frame) != 2*want {
+			t.Errorf("Frame %d: expected %d bytes, got %d", i, 2*want, len(frame))
+		}
+	}
+	if _, err := d.PeekFrameSize(); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
+func TestUnknownSampleRate(t *testing.T) {
+	info := StreamInfo{MinBlock: 16, MaxBlock: 16, NChannels: 1, BitsPerSample: 16}
+	samples := testRamp(16, 16, 1001)
+	body := func(w *bitWriter) { writeVerbatim(w, 16, samples) }
+
+	_, _, _, err := DecodeFrame(testFrame(testHeader{blockSize: 16}, body), info)
+	if !errors.Is(err, errUnknownSampleRate) {
+		t.Errorf("Expected %v, got %v", errUnknownSampleRate, err)
+	}
+
+	_, f, _, err := DecodeFrame(testFrame(testHeader{blockSize: 16, rateCode: 13, rate: 22050}, body), info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if f.SampleRate != 22050 {
+		t.Errorf("Expected sample rate 22050, got %d", f.SampleRate)
+	}
+}
+
+func TestStreamInfoSampleRateZero(t *testing.T) {
+	info := StreamInfo{MinBlock: 16, MaxBlock: 16, NChannels: 1, BitsPerSample: 16}
+	samples := testRamp(32, 16, 1001)
+	frame := func(num, rateCode uint64, samples []int32) []byte {
+		h := testHeader{blockSize: 16, rateCode: rateCode, rate: 22050, number: num}
+		return testFrame(h, func(w *bitWriter) { writeVerbatim(w, 16, samples) })
+	}
+
+	// The rate is taken from the first frame, and a later frame deferring to STREAMINFO gets it too.
+	stream := testStream(info, nil, frame(0, 13, samples[:16]), frame(1, 0, samples[16:]))
+	d, err := NewDecoder(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if d.SampleRate != 22050 {
+		t.Errorf("Expected sample rate 22050, got %d", d.SampleRate)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := d.Next(); err != nil {
+			t.Fatalf("Frame %d: unexpected error: %v", i, err)
+		}
+		if f := d.FrameInfo(); f.SampleRate != 22050 {
+			t.Errorf("Frame %d: expected sample rate 22050, got %d", i, f.SampleRate)
+		}
+	}
+
+	// A first frame deferring to STREAMINFO leaves the rate unknown.
+	stream = testStream(info, nil, frame(0, 0, samples[:16]))
+	d, err = NewDecoder(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if d.SampleRate != 0 {
+		t.Errorf("Expected sample rate 0, got %d", d.SampleRate)
+	}
+	if _, err := d.Next(); !errors.Is(err, errUnknownSampleRate) {
+		t.Errorf("Expected %v, got %v", errUnknownSampleRate, err)
+	}
+}
+
+func TestStrictTotalSamples(t *testing.T) {
+	samples := testRamp(48, 16, 1001)
+	frames := [][]byte{
+		verbatimFrame(0, 16, samples[:16]),
+		verbatimFrame(1, 16, samples[16:32]),
+		verbatimFrame(2, 16, samples[32:]),
+	}
+	tests := []struct {
+		total  int64
+		strict bool
+		frames int
+	}{
+		{48, true, 3},
+		{40, true, 3},
+		{32, true, 2},
+		{16, true, 1},
+		{0, true, 3},
+		{16, false, 3},
+	}
+	for _, test := range tests {
+		info := StreamInfo{MinBlock: 16, MaxBlock: 16, SampleRate: 44100, NChannels: 1, BitsPerSample: 16, TotalSamples: test.total}
+		var opts []Option
+		if test.strict {
+			opts = append(opts, WithStrict())
+		}
+		d, err := NewDecoder(bytes.NewReader(testStream(info, nil, frames...)), opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error making a new decoder: %v", err)
+		}
+		n := 0
+		for ; ; n++ {
+			if _, err = d.Next(); err != nil {
+				break
+			}
+		}
+		if n != test.frames {
+			t.Errorf("%d samples, strict %v: expected %d frames, got %d", test.total, test.strict, test.frames, n)
+		}
+		if wantEOF := n == len(frames); wantEOF != (err == io.EOF) {
+			t.Errorf("%d samples, strict %v: unexpected error %v", test.total, test.strict, err)
+		}
+	}
+}
+
+func TestStreamOffset(t *testing.T) {
+	stream, _ := testPCMStream(44100, 16, 64, testRamp(1000, 16, 31), testRamp(1000, 16, 57))
+	desc, err := Describe(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, opts := range [][]Option{nil, {WithoutCRC()}, {WithReadAhead(3)}} {
+		d, err := NewDecoder(bytes.NewReader(stream), opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error making a new decoder: %v", err)
+		}
+		if off := d.StreamOffset(); off != d.HeaderSize() {
+			t.Errorf("Expected offset %d before the first frame, got %d", d.HeaderSize(), off)
+		}
+		for _, f := range desc.Frames {
+			if _, err := d.Next(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if off := d.StreamOffset(); off != f.Offset+int64(f.Size) {
+				t.Errorf("Frame %d: expected offset %d, got %d", f.Number, f.Offset+int64(f.Size), off)
+			}
+		}
+		if d.StreamOffset() != int64(len(stream)) {
+			t.Errorf("Expected to end at offset %d, got %d", len(stream), d.StreamOffset())
+		}
+		d.Close()
+	}
+}
+
+func TestLPCShift(t *testing.T) {
+	samples := testRamp(32, 8, 7)
+	tests := []struct {
+		shift int
+		err   bool
+	}{
+		{0, false},
+		{7, false},
+		{8, true},
+		{15, true},
+	}
+	for _, test := range tests {
+		frame := testFrame(testHeader{blockSize: 32}, func(w *bitWriter) {
+			writeLPC(w, 8, 5, test.shift, []int32{1}, samples)
+		})
+		info := StreamInfo{MinBlock: 32, MaxBlock: 32, SampleRate: 8000, NChannels: 1, BitsPerSample: 8}
+		for _, strict := range []bool{false, true} {
+			var opts []Option
+			if strict {
+				opts = append(opts, WithStrict())
+			}
+			d, err := NewDecoder(bytes.NewReader(testStream(info, nil, frame)), opts...)
+			if err != nil {
+				t.Fatalf("Unexpected error making a new decoder: %v", err)
+			}
+			data, err := d.Next()
+			if strict && test.err {
+				if !errors.Is(err, errLPCShift) {
+					t.Errorf("Shift %d: expected %v, got %v", test.shift, errLPCShift, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("Shift %d, strict %v: unexpected error: %v", test.shift, strict, err)
+			}
+			if want, _ := interleave([][]int32{samples}, 8); !bytes.Equal(data, want) {
+				t.Errorf("Shift %d, strict %v: decoded data does not match", test.shift, strict)
+			}
+			if sf := d.FrameInfo().Subframes[0]; sf.Precision != 5 || sf.Shift != test.shift {
+				t.Errorf("Shift %d: expected precision 5 and shift %d, got %+v", test.shift, test.shift, sf)
+			}
+		}
+	}
+}
+
+func TestTrimFinalFrame(t *testing.T) {
+	samples := testRamp(100, 16, 1001)
+	padded := append(append([]int32{}, samples[64:]...), make([]int32, 28)...)
+	pcm, err := interleave([][]int32{samples}, 16)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	info := StreamInfo{MinBlock: 64, MaxBlock: 64, SampleRate: 44100, NChannels: 1, BitsPerSample: 16, TotalSamples: 100, MD5: md5.Sum(pcm)}
+	stream := testStream(info, nil, verbatimFrame(0, 16, samples[:64]), verbatimFrame(1, 16, padded))
+
+	got, meta, err := Decode(bytes.NewReader(stream), WithStrict())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if int64(len(got)/2) != meta.TotalSamples || !bytes.Equal(got, pcm) {
+		t.Errorf("Expected %d samples, got %d", meta.TotalSamples, len(got)/2)
+	}
+
+	// The MD5 checksum is of the samples within TotalSamples.
+	got, _, err = Decode(bytes.NewReader(stream), WithFullFinalFrame())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(got) != 2*128 || !bytes.Equal(got[:len(pcm)], pcm) {
+		t.Errorf("Expected 128 samples, got %d", len(got)/2)
+	}
+	info.MD5[0] ^= 0xFF
+	stream = testStream(info, nil, verbatimFrame(0, 16, samples[:64]), verbatimFrame(1, 16, padded))
+	if _, _, err := Decode(bytes.NewReader(stream), WithFullFinalFrame()); err == nil || err.Error() != "Bad MD5 checksum" {
+		t.Errorf("Expected a bad MD5 checksum, got %v", err)
+	}
+}
+
+func TestReadTagsBufferedError(t *testing.T) {
+	data := []byte{'f', 'L', 'a', 'C', 0x81, 0x00, 0x00, 0x01, 0x00} // Only a PADDING block.
+	_, n, err := ReadTagsBuffered(bytes.NewReader(data))
+	var perr *ParseError
+	if !errors.As(err, &perr) || err.Error() != "Missing STREAMINFO header" {
+		t.Errorf("Expected Missing STREAMINFO header, got %v", err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("Expected to read %d bytes, read %d", len(data), n)
+	}
+}
+
+func TestReadTagsBuffered(t *testing.T) {
+	samples := testRamp(100, 16, 1001)
+	info := StreamInfo{MinBlock: 64, MaxBlock: 64, SampleRate: 44100, NChannels: 1, BitsPerSample: 16, TotalSamples: 100}
+	comment := metaBlock(VorbisCommentType, true, []byte("\x03\x00\x00\x00abc\x01\x00\x00\x00\x07\x00\x00\x00TITLE=x"))
+	stream := testStream(info, [][]byte{comment}, verbatimFrame(0, 16, samples[:64]), verbatimFrame(1, 16, samples[64:]))
+
+	// A reader that is not an io.ReadSeeker, like a network stream.
+	r := io.MultiReader(bytes.NewReader(stream))
+	meta, n, err := ReadTagsBuffered(r)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != meta.HeaderSize() {
+		t.Errorf("Expected to read %d bytes, read %d", meta.HeaderSize(), n)
+	}
+	if meta.VorbisComment == nil || len(meta.Comments) != 1 || meta.Comments[0] != "TITLE=x" {
+		t.Errorf("Unexpected comments %+v", meta.VorbisComment)
+	}
+
+	d, err := NewDecoderWithStart(r, *meta.StreamInfo, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got []byte
+	for {
+		frame, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error decoding the rest of the stream: %v", err)
+		}
+		got = append(got, frame...)
+	}
+	if want, _ := interleave([][]int32{samples}, 16); !bytes.Equal(got, want) {
+		t.Errorf("Decoded data does not match")
+	}
+
+	if _, n, err := ReadTagsBuffered(bytes.NewReader(stream[:20])); err == nil || n != 20 {
+		t.Errorf("Expected an error after reading 20 bytes, got %d, %v", n, err)
+	}
+}
+
+func TestFrameIsLast(t *testing.T) {
+	left, right := testRamp(300, 16, 7), testRamp(300, 16, 13)
+	stream, pcm := testPCMStream(44100, 16, 128, left, right)
+	for _, tag := range [][]byte{nil, testID3v1()} {
+		d, err := NewDecoder(bytes.NewReader(append(append([]byte{}, stream...), tag...)), WithLastFrameDetection())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var got []byte
+		var last []bool
+		for {
+			data, err := d.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			got = append(got, data...)
+			last = append(last, d.FrameInfo().IsLast)
+		}
+		if want := "[false false true]"; fmt.Sprint(last) != want {
+			t.Errorf("Expected IsLast %v, got %v", want, last)
+		}
+		// Peeking for the end loses none of the following frame.
+		if !bytes.Equal(got, pcm) {
+			t.Errorf("Decoded data does not match")
+		}
+	}
+
+	// A frame followed by anything else is not the last.
+	d, err := NewDecoder(bytes.NewReader(append(append([]byte{}, stream...), 0)), WithLastFrameDetection())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := d.Next(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if d.FrameInfo().IsLast {
+		t.Errorf("Expected IsLast false before trailing garbage")
+	}
+
+	// Without WithLastFrameDetection, the decoder does not peek past frames.
+	d, err = NewDecoder(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := d.Next(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if d.FrameInfo().IsLast {
+			t.Errorf("Frame %d: expected IsLast false without WithLastFrameDetection", i)
+		}
+	}
+}
+
+func Test32BitSamples(t *testing.T) {
+	// writeFixed writes a SUBFRAME_FIXED of samples of up to 33 bits.
+	writeFixed := func(w *bitWriter, bps uint, order int, samples []int64) {
+		w.write(0, 1)
+		w.write(uint64(subFrameFixed)|uint64(order), 6)
+		w.write(0, 1)
+		for _, s := range samples[:order] {
+			w.writeSigned(s, bps)
+		}
+		var residual []int32
+		for i := order; i < len(samples); i++ {
+			var sum int64
+			for j, c := range fixedCoeffs[order] {
+				sum += int64(c) * samples[i-j-1]
+			}
+			residual = append(residual, int32(samples[i]-sum))
+		}
+		writeResidual(w, residual, 2)
+	}
+	wide := func(s []int32) []int64 {
+		w := make([]int64, len(s))
+		for i, v := range s {
+			w[i] = int64(v)
+		}
+		return w
+	}
+
+	// Full scale ramps, so that predictions overflow 32 bits and the side channel needs 33.
+	const n = 16
+	left, right := make([]int32, 4*n), make([]int32, 4*n)
+	for i := range left {
+		left[i] = math.MaxInt32 - 1000*int32(i)
+		right[i] = math.MinInt32 + 700*int32(i)
+	}
+	side := make([]int64, len(left))
+	mid := make([]int64, len(left))
+	for i := range left {
+		side[i] = int64(left[i]) - int64(right[i])
+		mid[i] = (int64(left[i]) + int64(right[i])) >> 1
+	}
+	frames := [][]byte{
+		testFrame(testHeader{blockSize: n, assign: 1, sizeCode: 7}, func(w *bitWriter) {
+			writeLPC(w, 32, 4, 0, []int32{2, -1}, left[:n])
+			writeVerbatim(w, 32, right[:n])
+		}),
+		testFrame(testHeader{blockSize: n, assign: leftSide, number: 1}, func(w *bitWriter) {
+			writeFixed(w, 32, 2, wide(left[n:2*n]))
+			writeFixed(w, 33, 2, side[n:2*n])
+		}),
+		testFrame(testHeader{blockSize: n, assign: rightSide, sizeCode: 7, number: 2}, func(w *bitWriter) {
+			writeFixed(w, 33, 1, side[2*n:3*n])
+			writeVerbatim(w, 32, right[2*n:3*n])
+		}),
+		testFrame(testHeader{blockSize: n, assign: midSide, number: 3}, func(w *bitWriter) {
+			writeFixed(w, 32, 2, mid[3*n:])
+			writeFixed(w, 33, 2, side[3*n:])
+		}),
+	}
+	pcm, err := interleave([][]int32{left, right}, 32)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(pcm) != 4*2*4*n || pcm[0] != 0xFF || pcm[3] != 0x7F || pcm[4] != 0 || pcm[7] != 0x80 {
+		t.Errorf("Expected 4-byte little-endian samples, got % x", pcm[:8])
+	}
+	info := StreamInfo{MinBlock: n, MaxBlock: n, SampleRate: 44100, NChannels: 2, BitsPerSample: 32, TotalSamples: 4 * n, MD5: md5.Sum(pcm)}
+	got, _, err := Decode(bytes.NewReader(testStream(info, nil, frames...)), WithStrict())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(got, pcm) {
+		t.Errorf("Decoded data does not match")
+	}
+}
+
+func Test12BitSamples(t *testing.T) {
+	left, right := testRamp(300, 12, 29), testRamp(300, 12, 1001)
+	stream, pcm := testPCMStream(44100, 12, 64, left, right)
+	// Samples are right-justified in 2-byte containers, as they are hashed for the MD5 checksum.
+	if want := []byte{0x00, 0xF8, 0x00, 0xF8, 0x1D, 0xF8}; !bytes.Equal(pcm[:6], want) {
+		t.Errorf("Expected % x, got % x", want, pcm[:6])
+	}
+	got, meta, err := Decode(bytes.NewReader(stream), WithStrict())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if meta.BitsPerSample != 12 {
+		t.Errorf("Expected 12 bits per sample, got %d", meta.BitsPerSample)
+	}
+	if !bytes.Equal(got, pcm) {
+		t.Errorf("Decoded data does not match")
+	}
+
+	// The frame header may give the sample size, code 2, rather than defer to STREAMINFO.
+	info := StreamInfo{MinBlock: 16, MaxBlock: 16, SampleRate: 44100, NChannels: 1, BitsPerSample: 12}
+	frame := testFrame(testHeader{blockSize: 16, sizeCode: 2}, func(w *bitWriter) { writeVerbatim(w, 12, left[:16]) })
+	data, _, _, err := DecodeFrame(frame, info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want, _ := interleave([][]int32{left[:16]}, 12); !bytes.Equal(data, want) {
+		t.Errorf("Decoded data does not match for sample size code 2")
+	}
+}
+
+func Test20BitSamples(t *testing.T) {
+	left, right := testRamp(300, 20, 4099), testRamp(300, 20, 77)
+	stream, pcm := testPCMStream(44100, 20, 64, left, right)
+	// Samples are right-justified in 3-byte containers, as they are hashed for the MD5 checksum.
+	if want := []byte{0x00, 0x00, 0xF8, 0x00, 0x00, 0xF8, 0x03, 0x10, 0xF8}; !bytes.Equal(pcm[:9], want) {
+		t.Errorf("Expected % x, got % x", want, pcm[:9])
+	}
+	got, _, err := Decode(bytes.NewReader(stream), WithStrict())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(got, pcm) {
+		t.Errorf("Decoded data does not match")
+	}
+
+	// Side coded frames, with 21-bit side channels, and sample size code 5.
+	side := make([]int32, 32)
+	for i := range side {
+		side[i] = left[i] - right[i]
+	}
+	mid := make([]int32, 32)
+	for i := range mid {
+		mid[i] = (left[i] + right[i]) >> 1
+	}
+	frames := [][]byte{
+		testFrame(testHeader{blockSize: 16, assign: leftSide, sizeCode: 5}, func(w *bitWriter) {
+			writeVerbatim(w, 20, left[:16])
+			writeVerbatim(w, 21, side[:16])
+		}),
+		testFrame(testHeader{blockSize: 16, assign: midSide, number: 1}, func(w *bitWriter) {
+			writeVerbatim(w, 20, mid[16:32])
+			writeVerbatim(w, 21, side[16:32])
+		}),
+	}
+	pcm, err = interleave([][]int32{left[:32], right[:32]}, 20)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	info := StreamInfo{MinBlock: 16, MaxBlock: 16, SampleRate: 44100, NChannels: 2, BitsPerSample: 20, TotalSamples: 32, MD5: md5.Sum(pcm)}
+	got, _, err = Decode(bytes.NewReader(testStream(info, nil, frames...)), WithStrict())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(got, pcm) {
+		t.Errorf("Decoded data of side coded frames does not match")
+	}
+}
+
+func TestEscapedResiduals(t *testing.T) {
+	samples := testRamp(16, 16, 4099)
+	for i := 8; i < 12; i++ {
+		samples[i] = 0
+	}
+	for i := 12; i < 16; i++ {
+		samples[i] = int32(i) - 14
+	}
+	// writeFixed0 writes a SUBFRAME_FIXED of order 0, whose residuals are the samples.
+	writeFixed0 := func(w *bitWriter, method uint64, partO uint, partition func(w *bitWriter, residual []int32)) {
+		w.write(0, 1)
+		w.write(uint64(subFrameFixed), 6)
+		w.write(0, 1)
+		w.write(method, 2)
+		w.write(uint64(partO), 4)
+		n := len(samples) >> partO
+		for i := 0; i < len(samples); i += n {
+			partition(w, samples[i:i+n])
+		}
+	}
+	escaped := func(w *bitWriter, bits, width uint, residual []int32) {
+		w.write(1<<bits-1, bits)
+		w.write(uint64(width), 5)
+		for _, r := range residual {
+			w.writeSigned(int64(r), width)
+		}
+	}
+	info := StreamInfo{MinBlock: 16, MaxBlock: 16, SampleRate: 44100, NChannels: 1, BitsPerSample: 16}
+	tests := []struct {
+		name string
+		body func(w *bitWriter)
+	}{
+		{"4-bit parameters", func(w *bitWriter) {
+			part := 0
+			writeFixed0(w, 0, 2, func(w *bitWriter, residual []int32) {
+				switch part++; part {
+				case 1:
+					w.write(14, 4)
+					for _, r := range residual {
+						w.writeRice(r, 14)
+					}
+				case 2:
+					escaped(w, 4, 16, residual)
+				case 3:
+					// A width of 0 codes zeros.
+					escaped(w, 4, 0, residual)
+				case 4:
+					escaped(w, 4, 2, residual)
+				}
+			})
+		}},
+		{"5-bit parameters", func(w *bitWriter) {
+			writeFixed0(w, 1, 0, func(w *bitWriter, residual []int32) { escaped(w, 5, 31, residual) })
+		}},
+	}
+	for _, test := range tests {
+		data, _, _, err := DecodeFrame(testFrame(testHeader{blockSize: 16}, test.body), info)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if want, _ := interleave([][]int32{samples}, 16); !bytes.Equal(data, want) {
+			t.Errorf("%s: decoded data does not match", test.name)
+		}
+	}
+}
+
+func TestWastedBits(t *testing.T) {
+	// writeWasted writes the subframe written by body, of samples without their
+	// low wasted bits, with the wasted bits flag and count set in its header.
+	writeWasted := func(w *bitWriter, wasted uint, body func(w *bitWriter)) {
+		sub := new(bitWriter)
+		body(sub)
+		bits := uint(len(sub.buf))*8 + sub.n
+		data := append(sub.buf, sub.acc<<(8-sub.n))
+		bit := func(i uint) uint64 { return uint64(data[i/8]>>(7-i%8)) & 1 }
+		for i := uint(0); i < 7; i++ {
+			w.write(bit(i), 1)
+		}
+		w.write(1, 1)
+		w.writeUnary(uint64(wasted - 1))
+		for i := uint(8); i < bits; i++ {
+			w.write(bit(i), 1)
+		}
+	}
+	shifted := func(s []int32, wasted uint) []int32 {
+		out := make([]int32, len(s))
+		for i, v := range s {
+			out[i] = v >> wasted
+		}
+		return out
+	}
+
+	// An 8-bit source stored as 16 bits, and a quiet channel with 3 wasted bits.
+	const n = 32
+	left := testRamp(4*n, 8, 3)
+	for i := range left {
+		left[i] <<= 8
+	}
+	right := testRamp(4*n, 13, 7)
+	for i := range right {
+		right[i] <<= 3
+	}
+	side := make([]int32, 4*n)
+	for i := range side {
+		side[i] = left[i] - right[i]
+	}
+	frames := [][]byte{
+		testFrame(testHeader{blockSize: n, assign: 1}, func(w *bitWriter) {
+			writeWasted(w, 8, func(w *bitWriter) { writeVerbatim(w, 8, shifted(left[:n], 8)) })
+			writeWasted(w, 3, func(w *bitWriter) { writeVerbatim(w, 13, shifted(right[:n], 3)) })
+		}),
+		testFrame(testHeader{blockSize: n, assign: 1, number: 1}, func(w *bitWriter) {
+			writeWasted(w, 8, func(w *bitWriter) { writeLPC(w, 8, 4, 0, []int32{1}, shifted(left[n:2*n], 8)) })
+			writeWasted(w, 3, func(w *bitWriter) { writeLPC(w, 13, 4, 1, []int32{2}, shifted(right[n:2*n], 3)) })
+		}),
+		// The side channel has 17 bits, 3 of them wasted.
+		testFrame(testHeader{blockSize: n, assign: leftSide, number: 2}, func(w *bitWriter) {
+			writeWasted(w, 8, func(w *bitWriter) { writeVerbatim(w, 8, shifted(left[2*n:3*n], 8)) })
+			writeWasted(w, 3, func(w *bitWriter) { writeLPC(w, 14, 4, 0, []int32{1}, shifted(side[2*n:3*n], 3)) })
+		}),
+		testFrame(testHeader{blockSize: n, assign: 1, number: 3}, func(w *bitWriter) {
+			writeWasted(w, 8, func(w *bitWriter) { writeVerbatim(w, 8, shifted(left[3*n:], 8)) })
+			writeVerbatim(w, 16, right[3*n:])
+		}),
+	}
+	pcm, err := interleave([][]int32{left, right}, 16)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	info := StreamInfo{MinBlock: n, MaxBlock: n, SampleRate: 44100, NChannels: 2, BitsPerSample: 16, TotalSamples: 4 * n, MD5: md5.Sum(pcm)}
+	d, err := NewDecoder(bytes.NewReader(testStream(info, nil, frames...)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got []byte
+	var wasted []int
+	for {
+		data, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		got = append(got, data...)
+		for _, sf := range d.FrameInfo().Subframes {
+			wasted = append(wasted, sf.WastedBits)
+		}
+	}
+	if !bytes.Equal(got, pcm) {
+		t.Errorf("Decoded data does not match")
+	}
+	if want := "[8 3 8 3 8 3 8 0]"; fmt.Sprint(wasted) != want {
+		t.Errorf("Expected wasted bits %s, got %v", want, wasted)
+	}
+	if _, _, err := Decode(bytes.NewReader(testStream(info, nil, frames...)), WithStrict()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestLPC24BitHighOrder(t *testing.T) {
+	// A full scale 24-bit sine, predicted by an order 12 LPC subframe whose
+	// 15-bit coefficients code x[n] ≈ 2x[n-1] - x[n-2] with a shift of 12.
+	// Each product needs 37 bits, so a 32-bit accumulator overflows.
+	samples := make([]int32, 256)
+	for i := range samples {
+		samples[i] = int32((1<<23 - 1) * math.Sin(2*math.Pi*100*float64(i)/44100))
+	}
+	coeffs := make([]int32, 12)
+	coeffs[0], coeffs[1] = 8192, -4096
+	frame := testFrame(testHeader{blockSize: len(samples), sizeCode: 6}, func(w *bitWriter) {
+		writeLPC(w, 24, 15, 12, coeffs, samples)
+	})
+	pcm, err := interleave([][]int32{samples}, 24)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	info := StreamInfo{MinBlock: 256, MaxBlock: 256, SampleRate: 44100, NChannels: 1, BitsPerSample: 24, TotalSamples: 256, MD5: md5.Sum(pcm)}
+	got, _, err := Decode(bytes.NewReader(testStream(info, nil, frame)), WithStrict())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(got, pcm) {
+		t.Errorf("Decoded data does not match")
+	}
+}
+
+func TestFrameHeaderCodes(t *testing.T) {
+	info := StreamInfo{SampleRate: 12345, NChannels: 1, BitsPerSample: 20}
+	parse := func(h testHeader) (*frameHeader, error) {
+		w := new(bitWriter)
+		h.write(w)
+		return readFrameHeader(bytes.NewReader(w.bytes()), &info)
+	}
+
+	// The block sizes of the specification for each code, or 0 if it is reserved.
+	blockSizes := []int{0, 192, 576, 1152, 2304, 4608, 200, 40000, 256, 512, 1024, 2048, 4096, 8192, 16384, 32768}
+	for code, want := range blockSizes {
+		h := testHeader{blockCode: uint64(code), reservedBlockCode: code == 0, blockSize: want, rateCode: 9}
+		got, err := parse(h)
+		switch {
+		case want == 0 && !errors.Is(err, errBlockSize):
+			t.Errorf("Block size code %d: expected %v, got %v", code, errBlockSize, err)
+		case want != 0 && err != nil:
+			t.Errorf("Block size code %d: unexpected error: %v", code, err)
+		case want != 0 && got.blockSize != want:
+			t.Errorf("Block size code %d: expected %d, got %d", code, want, got.blockSize)
+		}
+	}
+	// A frame of block size code 15 decodes all of its 32768 samples.
+	samples := testRamp(32768, 16, 3)
+	frame := testFrame(testHeader{blockCode: 15, rateCode: 9, sizeCode: 4}, func(w *bitWriter) { writeVerbatim(w, 16, samples) })
+	data, _, n, err := DecodeFrame(frame, StreamInfo{MinBlock: 32768, MaxBlock: 32768, SampleRate: 44100, NChannels: 1, BitsPerSample: 16})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want, _ := interleave([][]int32{samples}, 16); n != len(frame) || !bytes.Equal(data, want) {
+		t.Errorf("Decoded data of a 32768 sample frame does not match")
+	}
+
+	// Code 7 can code 65536, which is too large.
+	if _, err := parse(testHeader{blockSize: 65536, rateCode: 9}); err == nil || err.Error() != "Bad block size (65536) in frame header" {
+		t.Errorf("Expected a bad block size error for 65536, got %v", err)
+	}
+
+	// The sample rates of the specification for each code, or 0 if it is invalid.
+	sampleRates := []int{12345, 88200, 176400, 192000, 8000, 16000, 22050, 24000, 32000, 44100, 48000, 96000, 255000, 65535, 655350, 0}
+	for code, want := range sampleRates {
+		h := testHeader{blockSize: 16, rateCode: uint64(code), rate: want}
+		got, err := parse(h)
+		switch {
+		case want == 0 && err == nil:
+			t.Errorf("Sample rate code %d: expected an error", code)
+		case want != 0 && err != nil:
+			t.Errorf("Sample rate code %d: unexpected error: %v", code, err)
+		case want != 0 && got.sampleRate != want:
+			t.Errorf("Sample rate code %d: expected %d, got %d", code, want, got.sampleRate)
+		}
+	}
+	if _, err := parse(testHeader{blockSize: 16, rateCode: 12, rate: 0}); err == nil || err.Error() != "Bad sample rate (0) in frame header" {
+		t.Errorf("Expected a bad sample rate error for 0 kHz, got %v", err)
+	}
+
+	// The sample sizes of the specification for each code, or 0 if it is reserved.
+	sampleSizes := []int{20, 8, 12, 0, 16, 20, 24, 32}
+	for code, want := range sampleSizes {
+		h := testHeader{blockSize: 16, rateCode: 9, sizeCode: uint64(code)}
+		got, err := parse(h)
+		switch {
+		case want == 0 && err == nil:
+			t.Errorf("Sample size code %d: expected an error", code)
+		case want != 0 && err != nil:
+			t.Errorf("Sample size code %d: unexpected error: %v", code, err)
+		case want != 0 && got.sampleSize != want:
+			t.Errorf("Sample size code %d: expected %d, got %d", code, want, got.sampleSize)
+		}
+	}
+	// Code 0 takes the sample size from STREAMINFO, which must give a valid one.
+	info.BitsPerSample = 0
+	if _, err := parse(testHeader{blockSize: 16, rateCode: 9}); err == nil || err.Error() != "Bad sample size (0) in frame header" {
+		t.Errorf("Expected a bad sample size error, got %v", err)
+	}
+}
+
+func TestUnknownTotalSamples(t *testing.T) {
+	left, right := testRamp(1000, 16, 7), testRamp(1000, 16, 13)
+	var frames [][]byte
+	for i := 0; i < 1000; i += 192 {
+		end := i + 192
+		if end > 1000 {
+			end = 1000
+		}
+		frames = append(frames, verbatimFrame(uint64(i/192), 16, left[i:end], right[i:end]))
+	}
+	pcm, _ := interleave([][]int32{left, right}, 16)
+	info := StreamInfo{MinBlock: 192, MaxBlock: 192, SampleRate: 8000, NChannels: 2, BitsPerSample: 16, MD5: md5.Sum(pcm)}
+	stream := testStream(info, nil, frames...)
+
+	data, meta, err := Decode(bytes.NewReader(stream), WithStrict())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if meta.HasTotalSamples() {
+		t.Errorf("Expected the total samples to be unknown")
+	}
+	if !bytes.Equal(data, pcm) {
+		t.Errorf("Decoded data does not match")
+	}
+
+	for _, opts := range [][]Option{nil, {WithReadAhead(2)}} {
+		d, err := NewDecoder(bytes.NewReader(stream), opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for {
+			if _, err := d.Next(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		if n := d.DecodedSamples(); n != 1000 {
+			t.Errorf("Expected 1000 decoded samples, got %d", n)
+		}
+		d.Close()
+	}
+
+	info.TotalSamples = 1000
+	if !info.HasTotalSamples() {
+		t.Errorf("Expected the total samples to be known")
+	}
+}
@@ -0,0 +1,67 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"io"
+)
+
+// FileDescription is a structural analysis of a FLAC stream returned by Describe.
+// It is suitable for encoding as JSON.
+type FileDescription struct {
+	StreamInfo    StreamInfo
+	VorbisComment *VorbisComment `json:",omitempty"`
+	// Blocks describes every metadata block, in stream order.
+	Blocks []BlockDescription
+	Frames []FrameDescription
+}
+
+// BlockDescription describes a metadata block.
+type BlockDescription struct {
+	// Type is the name of the block type, such as STREAMINFO or PADDING.
+	Type string
+	// Length is the length in bytes of the block, excluding its 4-byte header.
+	Length int
+	Last   bool
+}
+
+// FrameDescription describes a frame.
+type FrameDescription struct {
+	// Offset is the offset in bytes of the frame from the start of the stream.
+	Offset int64
+	// Size is the size in bytes of the frame.
+	Size int
+	FrameInfo
+}
+
+// Describe decodes a FLAC stream and returns a description of its metadata
+// blocks and of every frame, without its audio data.
+func Describe(r io.Reader) (FileDescription, error) {
+	d, err := NewDecoder(r)
+	if err != nil {
+		return FileDescription{}, err
+	}
+	defer d.Close()
+
+	desc := FileDescription{
+		StreamInfo:    *d.StreamInfo,
+		VorbisComment: d.VorbisComment,
+	}
+	for _, b := range d.blocks {
+		desc.Blocks = append(desc.Blocks, BlockDescription{Type: b.kind.String(), Length: b.length, Last: b.last})
+	}
+	off := d.HeaderSize()
+	for {
+		if _, err := d.readFrame(); err == io.EOF {
+			break
+		} else if err != nil {
+			return FileDescription{}, err
+		}
+		size := len(d.in.buf)
+		f := d.frame
+		f.Subframes = copySubframes(f.Subframes)
+		desc.Frames = append(desc.Frames, FrameDescription{Offset: off, Size: size, FrameInfo: f})
+		off += int64(size)
+	}
+	return desc, nil
+}
@@ -0,0 +1,52 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	samples := testRamp(100, 16, 1001)
+	info := StreamInfo{MinBlock: 64, MaxBlock: 64, SampleRate: 44100, NChannels: 1, BitsPerSample: 16, TotalSamples: 100}
+	lpc := testFrame(testHeader{blockSize: 36, number: 1}, func(w *bitWriter) {
+		writeLPC(w, 16, 4, 0, []int32{2, -1}, samples[64:])
+	})
+	frames := [][]byte{verbatimFrame(0, 16, samples[:64]), lpc}
+	padding := metaBlock(PaddingType, true, make([]byte, 10))
+	data := testStream(info, [][]byte{padding}, frames...)
+
+	desc, err := Describe(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if desc.StreamInfo.TotalSamples != 100 {
+		t.Errorf("Expected 100 total samples, got %d", desc.StreamInfo.TotalSamples)
+	}
+	wantBlocks := []BlockDescription{{"STREAMINFO", 34, false}, {"PADDING", 10, true}}
+	if len(desc.Blocks) != len(wantBlocks) || desc.Blocks[0] != wantBlocks[0] || desc.Blocks[1] != wantBlocks[1] {
+		t.Errorf("Expected blocks %+v, got %+v", wantBlocks, desc.Blocks)
+	}
+	if len(desc.Frames) != 2 {
+		t.Fatalf("Expected 2 frames, got %d", len(desc.Frames))
+	}
+	off := int64(4 + 4 + 34 + 4 + 10)
+	for i, f := range desc.Frames {
+		if f.Offset != off || f.Size != len(frames[i]) {
+			t.Errorf("Frame %d: expected offset %d and size %d, got %d and %d", i, off, len(frames[i]), f.Offset, f.Size)
+		}
+		off += int64(len(frames[i]))
+	}
+	if f := desc.Frames[0]; len(f.Subframes) != 1 || f.Subframes[0].Type != "SUBFRAME_VERBATIM" {
+		t.Errorf("Unexpected description of frame 0: %+v", f)
+	}
+	if f := desc.Frames[1]; f.ChannelAssignment != "independent" || len(f.Subframes) != 1 ||
+		f.Subframes[0] != (SubframeInfo{Type: "SUBFRAME_LPC", Order: 2, Precision: 4}) {
+		t.Errorf("Unexpected description of frame 1: %+v", f)
+	}
+	if _, err := json.Marshal(desc); err != nil {
+		t.Errorf("Failed to encode as JSON: %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bufio"
+	"crypto/md5"
+	"errors"
+	"io"
+	"math/bits"
+	"strconv"
+)
+
+// defaultEncodeBlock is the block size used by EncodePCM when StreamInfo.MaxBlock is 0.
+const defaultEncodeBlock = 4096
+
+// maxFixedOrder is the highest order of the fixed predictors.
+const maxFixedOrder = 4
+
+// EncodePCM writes interleaved PCM data as a FLAC stream to w.
+// It is the inverse of Decode: the data is coded as Decode returns it,
+// with samples of 8 bits as signed bytes, and samples of 16 and 24 bits
+// as little-endian signed integers.
+//
+// The sample rate, number of channels, and bits per sample are taken from info;
+// only 8, 16, and 24 bits per sample are supported.
+// MaxBlock, if not 0, is the block size of the frames.
+// The other fields of the written STREAMINFO, including the MD5 checksum,
+// are computed from the data.
+// Each subframe is coded with the fixed predictor whose residuals take
+// the fewest bits, or as a constant or verbatim subframe if that is smaller.
+func EncodePCM(w io.Writer, pcm []byte, info StreamInfo) error {
+	if bps := info.BitsPerSample; bps != 8 && bps != 16 && bps != 24 {
+		return errors.New("Unsupported bits per sample (" + strconv.Itoa(bps) + "), supported values are: 8, 16, and 24")
+	}
+	if info.NChannels < 1 || info.NChannels > 8 {
+		return errors.New("Bad number of channels (" + strconv.Itoa(info.NChannels) + ")")
+	}
+	if info.SampleRate <= 0 || info.SampleRate > maxSampleRate {
+		return errors.New("Bad sample rate (" + strconv.Itoa(info.SampleRate) + ")")
+	}
+	blockSize := info.MaxBlock
+	if blockSize == 0 {
+		blockSize = defaultEncodeBlock
+	}
+	if err := checkBlockSize("Maximum", blockSize); err != nil {
+		return err
+	}
+	align := info.NChannels * info.BitsPerSample / 8
+	if len(pcm)%align != 0 {
+		return errors.New("PCM data size (" + strconv.Itoa(len(pcm)) +
+			") is not a multiple of the sample frame size (" + strconv.Itoa(align) + ")")
+	}
+
+	out := StreamInfo{
+		SampleRate:    info.SampleRate,
+		NChannels:     info.NChannels,
+		BitsPerSample: info.BitsPerSample,
+		TotalSamples:  int64(len(pcm) / align),
+		MD5:           md5.Sum(pcm),
+	}
+	var frames []byte
+	chs := make([][]int32, info.NChannels)
+	for num, start := 0, 0; start < len(pcm); num++ {
+		n := blockSize
+		if rest := (len(pcm) - start) / align; rest < n {
+			n = rest
+		}
+		end := start + n*align
+		deinterleave(chs, pcm[start:end], info.BitsPerSample)
+		frame := encodeFrame(chs, info, uint64(num))
+		frames = append(frames, frame...)
+		start = end
+
+		if out.MinFrame == 0 || len(frame) < out.MinFrame {
+			out.MinFrame = len(frame)
+		}
+		if len(frame) > out.MaxFrame {
+			out.MaxFrame = len(frame)
+		}
+	}
+	// Every frame but the last has the block size, and the last does not
+	// count towards the minimum, even if it is the only frame.
+	out.MinBlock, out.MaxBlock = blockSize, blockSize
+
+	bw := bufio.NewWriter(w)
+	if err := writeMetadata(bw, []RawBlock{{Type: StreamInfoType}}, out); err != nil {
+		return err
+	}
+	if _, err := bw.Write(frames); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// deinterleave fills chs with the samples of the interleaved PCM data.
+func deinterleave(chs [][]int32, pcm []byte, bps int) {
+	width := bps / 8
+	n := len(pcm) / (width * len(chs))
+	for c := range chs {
+		chs[c] = sampleBuffer(chs[c], n)
+	}
+	i := 0
+	for j := 0; j < n; j++ {
+		for _, ch := range chs {
+			switch bps {
+			case 8:
+				ch[j] = int32(int8(pcm[i]))
+			case 16:
+				ch[j] = int32(int16(uint16(pcm[i]) | uint16(pcm[i+1])<<8))
+			case 24:
+				ch[j] = int32(uint32(pcm[i])<<8|uint32(pcm[i+1])<<16|uint32(pcm[i+2])<<24) >> 8
+			}
+			i += width
+		}
+	}
+}
+
+// encodeFrame returns the frame with the given number coding the samples of chs as independent channels.
+func encodeFrame(chs [][]int32, info StreamInfo, num uint64) []byte {
+	n := len(chs[0])
+	w := new(bitWriter)
+	w.write(0x3FFE, 14)
+	w.write(0, 1) // Reserved.
+	w.write(0, 1) // Fixed block size.
+	w.write(7, 4) // 16-bit block size at the end of the header.
+	rateCode := uint64(0)
+	for code, rate := range sampleRates {
+		if rate == info.SampleRate {
+			rateCode = uint64(code)
+			break
+		}
+	}
+	w.write(rateCode, 4)
+	w.write(uint64(len(chs)-1), 4)
+	sizeCode := uint64(0)
+	for code, size := range sampleSizes {
+		if size == info.BitsPerSample {
+			sizeCode = uint64(code)
+			break
+		}
+	}
+	w.write(sizeCode, 3)
+	w.write(0, 1) // Reserved.
+	for _, b := range utf8Encode(num) {
+		w.write(uint64(b), 8)
+	}
+	w.write(uint64(n-1), 16)
+	w.write(uint64(crc8(w.buf)), 8)
+
+	for _, ch := range chs {
+		encodeSubFrame(w, ch, uint(info.BitsPerSample))
+	}
+	w.align()
+	w.write(uint64(crc16(w.buf)), 16)
+	return w.bytes()
+}
+
+// encodeSubFrame writes the smallest of a constant subframe, a fixed
+// subframe of order 0 to 4, and a verbatim subframe coding samples.
+func encodeSubFrame(w *bitWriter, samples []int32, bps uint) {
+	constant := true
+	for _, s := range samples[1:] {
+		if s != samples[0] {
+			constant = false
+			break
+		}
+	}
+	if constant {
+		w.write(0, 1)
+		w.write(uint64(subFrameConstant), 6)
+		w.write(0, 1)
+		w.writeSigned(int64(samples[0]), bps)
+		return
+	}
+
+	// The residuals of the order with the smallest sum of magnitudes take about the fewest bits.
+	var residuals [maxFixedOrder + 1][]int32
+	order := 0
+	var best uint64
+	for o := 0; o <= maxFixedOrder && o <= len(samples); o++ {
+		residuals[o] = fixedResiduals(samples, o)
+		var sum uint64
+		for _, r := range residuals[o] {
+			sum += zigzag(r)
+		}
+		if o == 0 || sum < best {
+			order, best = o, sum
+		}
+	}
+	res := residuals[order]
+	k, size := riceParam(res)
+	if uint64(order)*uint64(bps)+size >= uint64(len(samples))*uint64(bps) {
+		w.write(0, 1)
+		w.write(uint64(subFrameVerbatim), 6)
+		w.write(0, 1)
+		for _, s := range samples {
+			w.writeSigned(int64(s), bps)
+		}
+		return
+	}
+
+	w.write(0, 1)
+	w.write(uint64(subFrameFixed)|uint64(order), 6)
+	w.write(0, 1)
+	for _, s := range samples[:order] {
+		w.writeSigned(int64(s), bps)
+	}
+	// A single partition, with a 5-bit Rice parameter if it does not fit in 4 bits.
+	if k < 0xF {
+		w.write(0, 2)
+		w.write(0, 4)
+		w.write(uint64(k), 4)
+	} else {
+		w.write(1, 2)
+		w.write(0, 4)
+		w.write(uint64(k), 5)
+	}
+	for _, r := range res {
+		w.writeRice(r, k)
+	}
+}
+
+// fixedResiduals returns the residuals of the fixed predictor of the given order.
+func fixedResiduals(samples []int32, order int) []int32 {
+	res := make([]int32, len(samples)-order)
+	for i := order; i < len(samples); i++ {
+		s := int64(samples[i])
+		switch order {
+		case 1:
+			s -= int64(samples[i-1])
+		case 2:
+			s -= 2*int64(samples[i-1]) - int64(samples[i-2])
+		case 3:
+			s -= 3*int64(samples[i-1]) - 3*int64(samples[i-2]) + int64(samples[i-3])
+		case 4:
+			s -= 4*int64(samples[i-1]) - 6*int64(samples[i-2]) + 4*int64(samples[i-3]) - int64(samples[i-4])
+		}
+		res[i-order] = int32(s)
+	}
+	return res
+}
+
+// zigzag returns r folded to an unsigned value, as it is Rice coded.
+func zigzag(r int32) uint64 {
+	return uint64(uint32(r<<1) ^ uint32(r>>31))
+}
+
+// riceParam returns the Rice parameter that codes res in the fewest bits,
+// and the number of bits of the coded residual, including the coding method,
+// partition order, and parameter.
+func riceParam(res []int32) (uint, uint64) {
+	if len(res) == 0 {
+		return 0, 10
+	}
+	var sum uint64
+	for _, r := range res {
+		sum += zigzag(r)
+	}
+	// The best parameter is near the number of bits of the mean.
+	guess := bits.Len64(sum / uint64(len(res)))
+	var k uint
+	var best uint64
+	for p := guess - 1; p <= guess+1; p++ {
+		if p < 0 || p > 30 {
+			continue
+		}
+		size := uint64(len(res)) * uint64(p+1)
+		for _, r := range res {
+			size += zigzag(r) >> uint(p)
+		}
+		if p < 0xF {
+			size += 10
+		} else {
+			size += 11
+		}
+		if best == 0 || size < best {
+			k, best = uint(p), size
+		}
+	}
+	return k, best
+}
+
+// A bitWriter packs values most-significant bit first; it is the inverse of bit.Reader.
+type bitWriter struct {
+	buf []byte
+	acc byte
+	n   uint
+}
+
+func (w *bitWriter) write(v uint64, n uint) {
+	for n > 0 {
+		n--
+		w.acc = w.acc<<1 | byte((v>>n)&1)
+		w.n++
+		if w.n == 8 {
+			w.buf = append(w.buf, w.acc)
+			w.acc, w.n = 0, 0
+		}
+	}
+}
+
+func (w *bitWriter) writeSigned(v int64, n uint) {
+	w.write(uint64(v)&(^uint64(0)>>(64-n)), n)
+}
+
+func (w *bitWriter) writeUnary(q uint64) {
+	for ; q > 0; q-- {
+		w.write(0, 1)
+	}
+	w.write(1, 1)
+}
+
+func (w *bitWriter) writeRice(v int32, k uint) {
+	u := uint64(uint32(v<<1) ^ uint32(v>>31))
+	w.writeUnary(u >> k)
+	w.write(u&(1<<k-1), k)
+}
+
+func (w *bitWriter) align() {
+	if w.n > 0 {
+		w.write(0, 8-w.n)
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	w.align()
+	return w.buf
+}
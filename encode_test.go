@@ -0,0 +1,104 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"crypto/md5"
+	"math"
+	"testing"
+)
+
+func TestEncodePCM(t *testing.T) {
+	sine := func(n, bps int, freq float64) []int32 {
+		s := make([]int32, n)
+		amp := float64(int(1)<<uint(bps-2)) - 1
+		for i := range s {
+			s[i] = int32(amp * math.Sin(2*math.Pi*freq*float64(i)/44100))
+		}
+		return s
+	}
+	noise := func(n, bps int) []int32 {
+		s := make([]int32, n)
+		seed := uint32(bps)
+		for i := range s {
+			seed = seed*1664525 + 1013904223
+			s[i] = int32(seed) >> uint(32-bps)
+		}
+		return s
+	}
+	tests := []struct {
+		name      string
+		bps       int
+		blockSize int
+		chans     [][]int32
+	}{
+		{name: "stereo 16", bps: 16, blockSize: 1024, chans: [][]int32{sine(5000, 16, 440), sine(5000, 16, 660)}},
+		{name: "mono 8", bps: 8, blockSize: 256, chans: [][]int32{sine(1000, 8, 300)}},
+		{name: "24-bit ramp", bps: 24, blockSize: 64, chans: [][]int32{testRamp(300, 24, 99991), sine(300, 24, 1000)}},
+		{name: "full scale noise", bps: 24, blockSize: 4096, chans: [][]int32{noise(5000, 24)}},
+		{name: "silence", bps: 16, blockSize: 16, chans: [][]int32{make([]int32, 40), make([]int32, 40), make([]int32, 40)}},
+		{name: "one sample", bps: 16, blockSize: 0, chans: [][]int32{{-5}, {7}}},
+		{name: "empty", bps: 16, blockSize: 0, chans: [][]int32{{}, {}}},
+		{name: "six channels", bps: 16, blockSize: 192, chans: [][]int32{
+			sine(500, 16, 100), sine(500, 16, 200), noise(500, 16), testRamp(500, 16, 3), make([]int32, 500), sine(500, 16, 50),
+		}},
+	}
+	for _, test := range tests {
+		pcm, err := interleave(test.chans, test.bps)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		info := StreamInfo{
+			MaxBlock:      test.blockSize,
+			SampleRate:    44100,
+			NChannels:     len(test.chans),
+			BitsPerSample: test.bps,
+		}
+		var buf bytes.Buffer
+		if err := EncodePCM(&buf, pcm, info); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		data, meta, err := Decode(bytes.NewReader(buf.Bytes()), WithStrict())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if !bytes.Equal(data, pcm) {
+			t.Errorf("%s: decoded data does not match", test.name)
+		}
+		if err := meta.StreamInfo.Validate(); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if meta.MD5 != md5.Sum(pcm) {
+			t.Errorf("%s: expected MD5 %x, got %x", test.name, md5.Sum(pcm), meta.MD5)
+		}
+		if n := int64(len(test.chans[0])); meta.TotalSamples != n {
+			t.Errorf("%s: expected %d total samples, got %d", test.name, n, meta.TotalSamples)
+		}
+	}
+
+	// A smooth signal is compressed.
+	pcm, _ := interleave([][]int32{sine(44100, 16, 440), sine(44100, 16, 440)}, 16)
+	var buf bytes.Buffer
+	if err := EncodePCM(&buf, pcm, StreamInfo{SampleRate: 44100, NChannels: 2, BitsPerSample: 16}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buf.Len() > len(pcm)/2 {
+		t.Errorf("Expected at most %d bytes, got %d", len(pcm)/2, buf.Len())
+	}
+
+	bad := []StreamInfo{
+		{SampleRate: 44100, NChannels: 2, BitsPerSample: 12},
+		{SampleRate: 44100, NChannels: 0, BitsPerSample: 16},
+		{SampleRate: 0, NChannels: 2, BitsPerSample: 16},
+		{SampleRate: 44100, NChannels: 2, BitsPerSample: 16, MaxBlock: 8},
+	}
+	for _, info := range bad {
+		if err := EncodePCM(new(bytes.Buffer), make([]byte, 64), info); err == nil {
+			t.Errorf("%+v: expected an error", info)
+		}
+	}
+	if err := EncodePCM(new(bytes.Buffer), make([]byte, 6), StreamInfo{SampleRate: 44100, NChannels: 2, BitsPerSample: 16}); err == nil {
+		t.Errorf("Expected an error for PCM data of a partial sample frame")
+	}
+}
@@ -0,0 +1,116 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// id3v1Size is the size of an ID3v1 tag.
+const id3v1Size = 128
+
+// ID3v1 is an ID3v1 tag appended to the end of a FLAC stream.
+// Such tags are not part of the FLAC format, but some legacy taggers add them.
+type ID3v1 struct {
+	Title   string
+	Artist  string
+	Album   string
+	Year    string
+	Comment string
+	// Track is the track number of an ID3v1.1 tag, or 0 if there is none.
+	Track int
+	// Genre is the index of the genre in the ID3v1 genre list.
+	Genre byte
+}
+
+// isID3v1 returns whether b begins with the signature of an ID3v1 tag.
+func isID3v1(b []byte) bool {
+	return len(b) >= 3 && string(b[:3]) == "TAG"
+}
+
+// parseID3v1 parses a 128-byte ID3v1 tag.
+func parseID3v1(b []byte) *ID3v1 {
+	t := &ID3v1{
+		Title:  id3v1String(b[3:33]),
+		Artist: id3v1String(b[33:63]),
+		Album:  id3v1String(b[63:93]),
+		Year:   id3v1String(b[93:97]),
+		Genre:  b[127],
+	}
+	comment := b[97:127]
+	if comment[28] == 0 && comment[29] != 0 {
+		t.Track = int(comment[29])
+		comment = comment[:28]
+	}
+	t.Comment = id3v1String(comment)
+	return t
+}
+
+// id3v1String decodes a NUL or space padded ISO-8859-1 field.
+func id3v1String(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	var s strings.Builder
+	for _, c := range b {
+		s.WriteRune(rune(c))
+	}
+	return strings.TrimRight(s.String(), " ")
+}
+
+// trimID3v1 looks for an ID3v1 tag at the end of r, if r is an io.ReadSeeker.
+// If one is found, it returns the tag and a reader of r that ends before the tag.
+// Otherwise it returns r unchanged.
+func trimID3v1(r io.Reader) (io.Reader, *ID3v1, error) {
+	rs, ok := r.(io.ReadSeeker)
+	if !ok {
+		return r, nil, nil
+	}
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		// Not actually seekable, for example a pipe.
+		return r, nil, nil
+	}
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, nil, err
+	}
+	var tag *ID3v1
+	if end-start >= id3v1Size {
+		b := make([]byte, id3v1Size)
+		if _, err := rs.Seek(end-id3v1Size, io.SeekStart); err != nil {
+			return nil, nil, err
+		}
+		if _, err := io.ReadFull(rs, b); err != nil {
+			return nil, nil, err
+		}
+		if isID3v1(b) {
+			tag = parseID3v1(b)
+		}
+	}
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	if tag == nil {
+		return r, nil, nil
+	}
+	return io.LimitReader(rs, end-id3v1Size-start), tag, nil
+}
+
+// readTrailingID3v1 reports whether the next bytes of the stream are an ID3v1 tag
+// that ends the stream, for streams that could not be checked in advance by trimID3v1.
+// If so, the tag is consumed and recorded in the metadata.
+func (d *Decoder) readTrailingID3v1() bool {
+	if b, _ := d.r.Peek(3); !isID3v1(b) {
+		return false
+	}
+	b, _ := d.r.Peek(id3v1Size + 1)
+	if len(b) != id3v1Size {
+		return false
+	}
+	d.ID3v1 = parseID3v1(b)
+	d.r.Discard(id3v1Size)
+	return true
+}
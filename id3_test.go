@@ -0,0 +1,62 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func testID3v1() []byte {
+	b := make([]byte, id3v1Size)
+	copy(b, "TAG")
+	copy(b[3:], "Caf\xe9")
+	copy(b[33:], "Artist  ")
+	copy(b[63:], "Album")
+	copy(b[93:], "1999")
+	copy(b[97:], "A comment")
+	b[126] = 7
+	b[127] = 17
+	return b
+}
+
+func TestParseID3v1(t *testing.T) {
+	got := *parseID3v1(testID3v1())
+	want := ID3v1{Title: "Café", Artist: "Artist", Album: "Album", Year: "1999", Comment: "A comment", Track: 7, Genre: 17}
+	if got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestTrailingID3v1(t *testing.T) {
+	samples := testRamp(1000, 16, 311)
+	stream, pcm := testPCMStream(44100, 16, 256, samples)
+	data := append(stream, testID3v1()...)
+
+	readers := []struct {
+		name string
+		r    io.Reader
+	}{
+		{"seekable", bytes.NewReader(data)},
+		{"unseekable", struct{ io.Reader }{bytes.NewReader(data)}},
+	}
+	for _, test := range readers {
+		got, meta, err := Decode(test.r)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(got, pcm) {
+			t.Errorf("%s: decoded data does not match", test.name)
+		}
+		if meta.ID3v1 == nil || meta.ID3v1.Title != "Café" {
+			t.Errorf("%s: expected the ID3v1 tag, got %+v", test.name, meta.ID3v1)
+		}
+	}
+
+	_, meta, err := Decode(bytes.NewReader(stream))
+	if err != nil || meta.ID3v1 != nil {
+		t.Errorf("Expected no ID3v1 tag or error, got %+v, %v", meta.ID3v1, err)
+	}
+}
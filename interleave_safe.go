@@ -0,0 +1,21 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+//go:build !flacunsafe || !(386 || amd64 || arm || arm64 || loong64 || mips64le || mipsle || ppc64le || riscv64 || wasm)
+
+package flac
+
+import (
+	"encoding/binary"
+)
+
+// interleave16BitStereo interleaves 16-bit stereo samples.
+// Each inter-channel sample is written as a single 32-bit store,
+// which the compiler does not split into byte stores.
+func interleave16BitStereo(left, right []int32) ([]byte, error) {
+	data := make([]byte, len(left)*4)
+	right = right[:len(left)]
+	for i, l := range left {
+		binary.LittleEndian.PutUint32(data[4*i:], uint32(uint16(l))|uint32(right[i])<<16)
+	}
+	return data, nil
+}
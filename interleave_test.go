@@ -0,0 +1,35 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestInterleave16BitStereo(t *testing.T) {
+	for _, n := range []int{0, 1, 7, 4096} {
+		left, right := testRamp(n, 16, 1001), testRamp(n, 16, 77)
+		got, err := interleave16BitStereo(left, right)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		want := make([]byte, 0, 4*n)
+		for i := range left {
+			want = append(want, byte(left[i]), byte(left[i]>>8), byte(right[i]), byte(right[i]>>8))
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%d samples: expected\n% x\ngot\n% x", n, want, got)
+		}
+	}
+}
+
+// BenchmarkInterleave16BitStereo measures the 16-bit stereo fast path.
+// Run it with and without -tags flacunsafe to compare the implementations.
+func BenchmarkInterleave16BitStereo(b *testing.B) {
+	left, right := testRamp(4096, 16, 1001), testRamp(4096, 16, 77)
+	b.SetBytes(4 * 4096)
+	for i := 0; i < b.N; i++ {
+		interleave16BitStereo(left, right)
+	}
+}
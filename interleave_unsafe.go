@@ -0,0 +1,26 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+//go:build flacunsafe && (386 || amd64 || arm || arm64 || loong64 || mips64le || mipsle || ppc64le || riscv64 || wasm)
+
+package flac
+
+import (
+	"unsafe"
+)
+
+// interleave16BitStereo interleaves 16-bit stereo samples by viewing the output
+// as a slice of uint32, one per inter-channel sample, without bounds checks on
+// the byte slice. It is only built with the flacunsafe build tag, and only on
+// little-endian architectures, where the layout of a uint32 is that of the output.
+func interleave16BitStereo(left, right []int32) ([]byte, error) {
+	data := make([]byte, len(left)*4)
+	if len(left) == 0 {
+		return data, nil
+	}
+	right = right[:len(left)]
+	out := unsafe.Slice((*uint32)(unsafe.Pointer(unsafe.SliceData(data))), len(left))
+	for i, l := range left {
+		out[i] = uint32(uint16(l)) | uint32(right[i])<<16
+	}
+	return data, nil
+}
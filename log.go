@@ -0,0 +1,22 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+// A Logger receives messages about notable events while decoding,
+// such as data that the decoder skipped or recovered from rather than
+// reporting as an error.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+}
+
+// WithLogger sets the Logger of the decoder.
+// By default, nothing is logged.
+func WithLogger(l Logger) Option {
+	return func(d *Decoder) { d.log = l }
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Warnf(string, ...interface{})  {}
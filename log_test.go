@@ -0,0 +1,64 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+type recordingLogger struct {
+	debug, warn []string
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.debug = append(l.debug, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Warnf(format string, args ...interface{}) {
+	l.warn = append(l.warn, fmt.Sprintf(format, args...))
+}
+
+func TestLogger(t *testing.T) {
+	samples := testRamp(32, 16, 1000)
+	info := StreamInfo{
+		MinBlock:      16,
+		MaxBlock:      16,
+		SampleRate:    44100,
+		NChannels:     1,
+		BitsPerSample: 16,
+		TotalSamples:  48,
+	}
+	bad := verbatimFrame(2, 16, samples[16:])
+	bad[len(bad)-1] ^= 0xFF
+	data := testStream(info, [][]byte{metaBlock(PaddingType, true, make([]byte, 8))},
+		verbatimFrame(0, 16, samples[:16]), bad)
+
+	var l recordingLogger
+	d, err := NewDecoder(bytes.NewReader(data), WithLogger(&l), WithIgnoreCRC())
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	for {
+		if _, err := d.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error decoding: %v", err)
+		}
+	}
+	if len(l.debug) != 1 || !strings.Contains(l.debug[0], "PADDING") {
+		t.Errorf("Debug messages: %q, want one about the PADDING block", l.debug)
+	}
+	wants := []string{"MD5", "frame 2 starts at sample 32, expected sample 16", "frame 2 failed its CRC16"}
+	if len(l.warn) != len(wants) {
+		t.Fatalf("Warnings: %q, want %d", l.warn, len(wants))
+	}
+	for i, want := range wants {
+		if !strings.Contains(l.warn[i], want) {
+			t.Errorf("Warning %d: %q, want it to contain %q", i, l.warn[i], want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"hash"
+	"sync"
+)
+
+// An asyncHash computes a hash on its own goroutine,
+// so that hashing overlaps with the work of the writer.
+// The slices written to it must not be modified afterwards.
+type asyncHash struct {
+	blocks chan []byte
+	sum    chan []byte
+	once   sync.Once
+}
+
+func newAsyncHash(h hash.Hash) *asyncHash {
+	a := &asyncHash{
+		blocks: make(chan []byte, 64),
+		sum:    make(chan []byte, 1),
+	}
+	go func() {
+		for b := range a.blocks {
+			h.Write(b)
+		}
+		a.sum <- h.Sum(nil)
+	}()
+	return a
+}
+
+func (a *asyncHash) Write(p []byte) (int, error) {
+	a.blocks <- p
+	return len(p), nil
+}
+
+// Close stops the hashing goroutine once it has hashed everything written.
+func (a *asyncHash) Close() error {
+	a.once.Do(func() { close(a.blocks) })
+	return nil
+}
+
+// Sum closes the asyncHash and returns the hash of everything written.
+func (a *asyncHash) Sum() []byte {
+	a.Close()
+	return <-a.sum
+}
@@ -0,0 +1,84 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestAsyncMD5(t *testing.T) {
+	left, right := testRamp(5000, 16, 37), testRamp(5000, 16, 5)
+	data, pcm := testPCMStream(44100, 16, 1024, left, right)
+	got, _, err := Decode(bytes.NewReader(data), WithAsyncMD5())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(got, pcm) {
+		t.Errorf("Decoded data does not match")
+	}
+
+	// Corrupt the MD5 checksum in STREAMINFO.
+	bad := append([]byte{}, data...)
+	bad[8+34-1] ^= 0xFF
+	if _, _, err := Decode(bytes.NewReader(bad), WithAsyncMD5()); err == nil || err.Error() != "Bad MD5 checksum" {
+		t.Errorf("Expected Bad MD5 checksum, got %v", err)
+	}
+}
+
+func TestUnsetMD5(t *testing.T) {
+	data, pcm := testPCMStream(44100, 16, 64, testRamp(200, 16, 37))
+	unset := append([]byte{}, data...)
+	copy(unset[8+34-16:8+34], make([]byte, 16))
+
+	for _, opts := range [][]Option{nil, {WithAsyncMD5()}} {
+		got, meta, err := Decode(bytes.NewReader(unset), opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !bytes.Equal(got, pcm) {
+			t.Errorf("Decoded data does not match")
+		}
+		if meta.StreamInfo.HasMD5() {
+			t.Errorf("Expected no MD5 checksum")
+		}
+	}
+
+	d, err := NewDecoder(bytes.NewReader(unset))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := d.DecodeStreaming(io.Discard, 1000); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	_, meta, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !meta.StreamInfo.HasMD5() {
+		t.Errorf("Expected an MD5 checksum")
+	}
+}
+
+func BenchmarkDecodeMD5(b *testing.B) {
+	data := testTrack(30 * 44100)
+	for _, bench := range []struct {
+		name string
+		opts []Option
+	}{
+		{"inline", nil},
+		{"async", []Option{WithAsyncMD5()}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := Decode(bytes.NewReader(data), bench.opts...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"errors"
+)
+
+// ErrMemoryLimit is returned when decoding would allocate more memory than
+// was allowed by WithMaxMemory.
+var ErrMemoryLimit = errors.New("Memory limit exceeded")
+
+// StringSize is the size of a string header, charged per Vorbis comment.
+const stringSize = 16
+
+// A memBudget accounts for allocations against an optional limit.
+type memBudget struct {
+	// Limit is the maximum number of bytes; 0 or less means no limit.
+	limit int64
+	// Used is the number of bytes held by long-lived allocations.
+	used int64
+}
+
+// alloc records a long-lived allocation of n bytes.
+func (m *memBudget) alloc(n int64) error {
+	if err := m.check(n); err != nil {
+		return err
+	}
+	m.used += n
+	return nil
+}
+
+// check returns ErrMemoryLimit if a transient allocation of n bytes,
+// on top of the long-lived allocations, would exceed the limit.
+func (m *memBudget) check(n int64) error {
+	if m.limit > 0 && (n < 0 || m.used+n > m.limit) {
+		return ErrMemoryLimit
+	}
+	return nil
+}
+
+// remaining returns the number of bytes left in the budget,
+// or -1 if there is no limit.
+func (m *memBudget) remaining() int64 {
+	if m.limit <= 0 {
+		return -1
+	}
+	return m.limit - m.used
+}
@@ -0,0 +1,125 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"testing"
+)
+
+func TestMaxMemory(t *testing.T) {
+	left, right := testRamp(10000, 16, 7), testRamp(10000, 16, 13)
+	data, pcm := testPCMStream(44100, 16, 1024, left, right)
+
+	out, _, err := Decode(bytes.NewReader(data), WithMaxMemory(1<<20))
+	if err != nil {
+		t.Fatalf("Unexpected error decoding within budget: %v", err)
+	}
+	if !bytes.Equal(out, pcm) {
+		t.Errorf("Decoded PCM does not match")
+	}
+
+	if _, _, err := Decode(bytes.NewReader(data), WithMaxMemory(int64(len(pcm)/2))); err != ErrMemoryLimit {
+		t.Errorf("Expected %v, got %v", ErrMemoryLimit, err)
+	}
+}
+
+func TestMaxMemoryMetaData(t *testing.T) {
+	// A VORBIS_COMMENT block with an empty vendor string declaring a huge number of comments.
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint32(body[4:], 0x7FFFFFFF)
+	info := StreamInfo{SampleRate: 44100, NChannels: 1, BitsPerSample: 16}
+	data := testStream(info, [][]byte{metaBlock(VorbisCommentType, true, body)})
+
+	if _, err := NewDecoder(bytes.NewReader(data), WithMaxMemory(1<<20)); err != ErrMemoryLimit {
+		t.Errorf("Expected %v, got %v", ErrMemoryLimit, err)
+	}
+}
+
+func TestDecodeStreaming(t *testing.T) {
+	left, right := testRamp(10000, 16, 7), testRamp(10000, 16, 13)
+	data, pcm := testPCMStream(44100, 16, 1024, left, right)
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	var out bytes.Buffer
+	if err := d.DecodeStreaming(&out, 1000); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), pcm) {
+		t.Errorf("Decoded PCM does not match")
+	}
+
+	bad := append([]byte{}, data...)
+	bad[len(magic)+4+34-1] ^= 0xFF // The last byte of the MD5 checksum.
+	d, err = NewDecoder(bytes.NewReader(bad))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	if err := d.DecodeStreaming(io.Discard, 1000); err == nil || err.Error() != "Bad MD5 checksum" {
+		t.Errorf("Expected a bad MD5 checksum, got %v", err)
+	}
+}
+
+// A heapWriter discards what is written to it, recording the peak size of the live heap.
+type heapWriter struct {
+	base, peak uint64
+}
+
+func (w *heapWriter) Write(p []byte) (int, error) {
+	var m runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m)
+	if m.HeapAlloc > w.base && m.HeapAlloc-w.base > w.peak {
+		w.peak = m.HeapAlloc - w.base
+	}
+	return len(p), nil
+}
+
+func TestDecodeStreamingMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping in short mode")
+	}
+	const bufSize = 64 << 10
+	peak := func(seconds int) uint64 {
+		data := testTrack(seconds * 44100)
+		d, err := NewDecoder(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Unexpected error making a new decoder: %v", err)
+		}
+		var m runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&m)
+		w := &heapWriter{base: m.HeapAlloc}
+		if err := d.DecodeStreaming(w, bufSize); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return w.peak
+	}
+	short, long := peak(2), peak(20)
+	// Twenty seconds of output is 3.5MB, so any accumulation would dwarf the slack.
+	if long > short+bufSize {
+		t.Errorf("Peak heap grew from %d bytes for 2s to %d bytes for 20s", short, long)
+	}
+}
+
+func FuzzReadVorbisComment(f *testing.F) {
+	huge := make([]byte, 8)
+	binary.LittleEndian.PutUint32(huge[4:], 0xFFFFFFFF)
+	f.Add(huge)
+	f.Add([]byte("\x03\x00\x00\x00abc\x02\x00\x00\x00\x03\x00\x00\x00a=b\x00\x00\x00\x00"))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		var mem memBudget
+		cmnt, err := readVorbisComment(bytes.NewReader(body), &mem)
+		if err != nil {
+			return
+		}
+		if cap(cmnt.Comments) > len(body)/4 {
+			t.Errorf("Preallocated %d comments for a %d byte block", cap(cmnt.Comments), len(body))
+		}
+	})
+}
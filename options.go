@@ -0,0 +1,148 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+// An Option configures a Decoder.
+type Option func(*Decoder)
+
+// WithMaxMemory bounds the total memory allocated while decoding to n bytes.
+// The budget covers metadata buffers, the per-frame sample slices, and,
+// for Decode, the accumulated output buffer.
+// Operations that would exceed the budget fail with ErrMemoryLimit.
+// A limit of 0 or less means no limit.
+func WithMaxMemory(n int64) Option {
+	return func(d *Decoder) { d.mem.limit = n }
+}
+
+// WithStrict enables additional validation, rejecting streams that the
+// decoder would otherwise decode leniently, such as streams with gaps
+// between the sample numbers of consecutive frames or with a STREAMINFO
+// that fails StreamInfo.Validate.
+// It also bounds the work of decoding untrusted input: if STREAMINFO gives
+// the total number of samples, a frame beginning after that many samples
+// have been decoded is an error.
+// LPC subframes whose shift discards the whole prediction, which is allowed
+// but typical of corruption, are rejected too.
+func WithStrict() Option {
+	return func(d *Decoder) { d.strict = true }
+}
+
+// WithoutCRC disables computing and verifying the frame CRC8 and CRC16 checksums.
+func WithoutCRC() Option {
+	return func(d *Decoder) { d.noCRC = true }
+}
+
+// WithIgnoreCRC verifies frame checksums but decodes frames that fail
+// them instead of returning an error.
+// Such frames are reported by FrameInfo with CRCValid set to false.
+// Their samples are likely to be garbage.
+func WithIgnoreCRC() Option {
+	return func(d *Decoder) { d.ignoreCRC = true }
+}
+
+// WithClipDetection counts decoded samples at the full-scale minimum or
+// maximum value, reported by Decoder.ClippedSamples.
+func WithClipDetection() Option {
+	return func(d *Decoder) { d.detectClipping = true }
+}
+
+// WithLastFrameDetection sets FrameInfo.IsLast for the last frame of the stream.
+// Finding it peeks past each frame, so on a streaming source Next does not
+// return a frame until the first byte of the next one, or the end of the
+// stream, arrives, which delays every frame by up to one frame.
+func WithLastFrameDetection() Option {
+	return func(d *Decoder) { d.detectLast = true }
+}
+
+// WithBitDepthAnalysis tracks which bits of the decoded samples are in use,
+// reported by Decoder.EffectiveBitDepth.
+func WithBitDepthAnalysis() Option {
+	return func(d *Decoder) { d.bitDepthAnalysis = true }
+}
+
+// WithStereoAnalysis computes the correlation of the left and right channels
+// of each frame of a stereo stream, reported by FrameInfo, and over the whole
+// stream, reported by Decoder.StereoMode.
+func WithStereoAnalysis() Option {
+	return func(d *Decoder) { d.stereoAnalysis = true }
+}
+
+// WithLenientBlockSize decodes frames with the reserved block size code 0,
+// which are otherwise rejected, if STREAMINFO gives a fixed block size
+// (equal MinBlock and MaxBlock). Such frames are taken to have that block size.
+// This recovers streams from an encoder known to write code 0 in fixed block size streams.
+func WithLenientBlockSize() Option {
+	return func(d *Decoder) { d.lenientBlockSize = true }
+}
+
+// WithFullFinalFrame returns every sample of a final frame that extends beyond
+// the total number of samples given by STREAMINFO. By default such a frame,
+// padded by its encoder, is trimmed so that exactly TotalSamples samples are
+// decoded, as by the reference decoder. FrameInfo reports the block size coded
+// in the frame header either way.
+func WithFullFinalFrame() Option {
+	return func(d *Decoder) { d.fullFinalFrame = true }
+}
+
+// With24In32 makes the data returned by Next, and so by Decode, hold the
+// samples of 24-bit streams in 4-byte little-endian containers placed as
+// justify selects, as wanted by audio APIs such as ASIO and Core Audio.
+// The MD5 checksum is still verified, against the 24-bit samples.
+// Streams of other bit depths are not affected.
+func With24In32(justify Justification) Option {
+	return func(d *Decoder) { d.justify = justify }
+}
+
+// With16BitRounding makes the data returned by Next, and so by Decode, hold
+// the samples of streams of more than 16 bits per sample reduced to 16 bits,
+// rounded as mode selects, for deterministic output without dither noise.
+// The metadata still gives the bit depth of the stream. It takes precedence
+// over With24In32. Decode does not verify the MD5 checksum of reduced audio.
+// Streams of 16 bits per sample or fewer are not affected.
+func With16BitRounding(mode RoundingMode) Option {
+	return func(d *Decoder) { d.rounding = mode }
+}
+
+// WithAsyncMD5 makes Decode compute the MD5 checksum of the decoded audio on
+// a separate goroutine, rather than on the decoding goroutine between frames.
+// Hashing can then overlap with decoding, but only where another CPU is free,
+// and each frame costs a channel send. On a single CPU it is no faster than
+// the default; measure with BenchmarkDecodeMD5 before relying on a gain.
+func WithAsyncMD5() Option {
+	return func(d *Decoder) { d.asyncMD5 = true }
+}
+
+// WithRawMetadata keeps the raw bytes of every metadata block in the Blocks
+// field of the metadata, including blocks of types that are not otherwise
+// parsed, so that they can be written back byte for byte.
+func WithRawMetadata() Option {
+	return func(d *Decoder) { d.rawMetadata = true }
+}
+
+// WithReadAhead decodes up to frames frames ahead of the caller on a
+// background goroutine, started by the first read of a frame, so that reads
+// can be served from the queue while the source is briefly starved.
+// Decoder.ReadAheadDepth reports the number of frames queued.
+// Close stops the goroutine and discards the queued frames. It waits for a
+// read of the source in progress on the goroutine to return, so while the
+// source is stalled Close blocks too; to close promptly, first unblock the
+// read, for example by setting a deadline on or closing a network connection.
+// While reading ahead, statistics such as ClippedSamples and
+// ChannelAssignmentStats include the queued frames, and must not be called
+// until decoding has ended or Close has been called.
+// A frames of 0 or less disables reading ahead.
+func WithReadAhead(frames int) Option {
+	return func(d *Decoder) { d.readAhead = frames }
+}
+
+// WithSampleTransform calls transform with the samples of each channel of
+// every decoded frame, after resampling and before interleaving, so that it
+// can change them in place; for example to apply gain or invert polarity.
+// To reorder or swap channels, use Decoder.SelectChannels instead.
+// The transform runs on the decoding hot path and must not
+// retain the slice, which is reused by the next frame. Samples must be left
+// within the range of the stream's bit depth; out of range values are not clipped.
+// Decode does not verify the MD5 checksum of transformed audio.
+func WithSampleTransform(transform func(ch int, samples []int32)) Option {
+	return func(d *Decoder) { d.transform = transform }
+}
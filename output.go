@@ -0,0 +1,243 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// NextMono returns the audio data from the next frame mixed down to a single channel.
+// Each mono sample is the average of the channels, rounded to the nearest
+// integer with halves rounded away from zero, and clipped to the stream's bit depth.
+// The data has the same bits per sample as the stream.
+func (d *Decoder) NextMono() ([]byte, error) {
+	data, err := d.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	return d.interleave([][]int32{mixMono(data, d.BitsPerSample)})
+}
+
+func mixMono(chs [][]int32, bps int) []int32 {
+	n := int64(len(chs))
+	max := int64(1)<<uint(bps-1) - 1
+	min := -max - 1
+	mono := make([]int32, len(chs[0]))
+	for i := range mono {
+		var sum int64
+		for _, ch := range chs {
+			sum += int64(ch[i])
+		}
+		// Round half away from zero.
+		var v int64
+		if sum >= 0 {
+			v = (2*sum + n) / (2 * n)
+		} else {
+			v = -((-2*sum + n) / (2 * n))
+		}
+		if v > max {
+			v = max
+		} else if v < min {
+			v = min
+		}
+		mono[i] = int32(v)
+	}
+	return mono
+}
+
+// NextInt32Interleaved returns the samples of the next frame as a single slice
+// with the channels interleaved, in the same order as the data returned by Next.
+// Samples of any bit depth, including 8, 16, and 24 bits, are sign-extended into int32
+// without scaling.
+func (d *Decoder) NextInt32Interleaved() ([]int32, error) {
+	data, err := d.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	return interleaveInt32(data), nil
+}
+
+func interleaveInt32(chs [][]int32) []int32 {
+	if len(chs) == 2 {
+		return interleaveInt32Stereo(chs[0], chs[1])
+	}
+	nChannels := len(chs)
+	out := make([]int32, len(chs[0])*nChannels)
+	for ch, samples := range chs {
+		for j, s := range samples {
+			out[j*nChannels+ch] = s
+		}
+	}
+	return out
+}
+
+func interleaveInt32Stereo(left, right []int32) []int32 {
+	out := make([]int32, 2*len(left))
+	for i, l := range left {
+		out[2*i] = l
+		out[2*i+1] = right[i]
+	}
+	return out
+}
+
+// NextFixedQ returns the samples of each channel of the next frame in a signed
+// fixed-point format with the given number of fractional bits,
+// so that full scale of any source bit depth maps to 1.0 in the Q-format;
+// for example, 24 selects Q8.24 and 31 selects Q0.31 (Q31).
+// Samples are shifted left when fractionalBits is at least the source bit depth less one,
+// and otherwise shifted right, rounding to the nearest value with halves rounded up.
+// Results are clamped to the range [-1.0, 1.0), that is [-1<<fractionalBits, 1<<fractionalBits-1],
+// so rounding can never overflow it.
+// The fractionalBits must be between 0 and 31.
+func (d *Decoder) NextFixedQ(fractionalBits int) ([][]int32, error) {
+	if fractionalBits < 0 || fractionalBits > 31 {
+		return nil, errors.New("Bad number of fractional bits (" + strconv.Itoa(fractionalBits) + ")")
+	}
+	data, err := d.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	chs := make([][]int32, len(data))
+	for ch := range data {
+		chs[ch] = toFixedQ(data[ch], d.BitsPerSample, fractionalBits)
+	}
+	return chs, nil
+}
+
+func toFixedQ(samples []int32, bps, fractionalBits int) []int32 {
+	q := make([]int32, len(samples))
+	shift := fractionalBits - (bps - 1)
+	if shift >= 0 {
+		for i, s := range samples {
+			q[i] = s << uint(shift)
+		}
+		return q
+	}
+	max := int64(1)<<uint(fractionalBits) - 1
+	min := -max - 1
+	shift = -shift
+	for i, s := range samples {
+		v := (int64(s) + 1<<uint(shift-1)) >> uint(shift)
+		if v > max {
+			v = max
+		} else if v < min {
+			v = min
+		}
+		q[i] = int32(v)
+	}
+	return q
+}
+
+// Justification is the placement of a sample in a wider container.
+type Justification int
+
+const (
+	// RightJustified places a sample in the low bits of its container,
+	// sign-extended through the high bits, so that its value is unchanged.
+	RightJustified Justification = iota + 1
+	// LeftJustified places a sample in the high bits of its container,
+	// with the low bits zero, so that full scale is that of the container.
+	LeftJustified
+)
+
+// interleave returns the interleaved data of chs in the output format of the decoder.
+func (d *Decoder) interleave(chs [][]int32) ([]byte, error) {
+	if d.reducesTo16() {
+		out := make([][]int32, len(chs))
+		for ch := range chs {
+			out[ch] = roundTo16(chs[ch], d.BitsPerSample, d.rounding)
+		}
+		return interleave(out, 16)
+	}
+	if d.justify != 0 && d.BitsPerSample == 24 {
+		return interleave24In32(chs, d.justify), nil
+	}
+	return interleave(chs, d.BitsPerSample)
+}
+
+func interleave24In32(chs [][]int32, justify Justification) []byte {
+	var shift uint
+	if justify == LeftJustified {
+		shift = 8
+	}
+	data := make([]byte, 4*len(chs)*len(chs[0]))
+	var i int
+	for j := range chs[0] {
+		for _, ch := range chs {
+			binary.LittleEndian.PutUint32(data[i:], uint32(ch[j]<<shift))
+			i += 4
+		}
+	}
+	return data
+}
+
+// RoundingMode is the rounding of samples reduced to fewer bits, as selected by With16BitRounding.
+type RoundingMode int
+
+const (
+	// Truncate drops the low bits, rounding toward negative infinity.
+	// It is the cheapest, but biases the signal by half of the new least significant bit.
+	Truncate RoundingMode = iota + 1
+	// RoundHalfUp rounds to the nearest value, with halves rounded up.
+	RoundHalfUp
+	// RoundHalfEven rounds to the nearest value, with halves rounded to the even value,
+	// which avoids any bias.
+	RoundHalfEven
+)
+
+// reducesTo16 returns whether the decoder reduces the samples of its stream to 16 bits.
+func (d *Decoder) reducesTo16() bool {
+	return d.rounding != 0 && d.BitsPerSample > 16
+}
+
+// roundTo16 returns the samples of the given bit depth reduced to 16 bits,
+// rounded as mode selects and clipped to the 16-bit range.
+func roundTo16(samples []int32, bps int, mode RoundingMode) []int32 {
+	shift := uint(bps - 16)
+	half := int32(1) << (shift - 1)
+	mask := int32(1)<<shift - 1
+	out := make([]int32, len(samples))
+	for i, s := range samples {
+		q := s >> shift
+		switch r := s & mask; {
+		case mode == Truncate:
+		case r > half, r == half && (mode == RoundHalfUp || q&1 == 1):
+			q++
+		}
+		if q > 32767 {
+			q = 32767
+		}
+		out[i] = q
+	}
+	return out
+}
+
+// md5Data returns the data of the frame just returned by Next as it is hashed
+// for the MD5 checksum, with each sample in the fewest whole bytes,
+// and without the samples of a final frame beyond the end of the stream
+// that WithFullFinalFrame keeps.
+func (d *Decoder) md5Data(data []byte) []byte {
+	f := d.currentFrame()
+	if end := f.FirstSample + int64(f.BlockSize); d.fullFinalFrame && d.HasTotalSamples() && end > d.TotalSamples {
+		n := d.TotalSamples - f.FirstSample
+		if n < 0 {
+			n = 0
+		}
+		data = data[:int64(len(data))/int64(f.BlockSize)*n]
+	}
+	if d.justify == 0 || d.BitsPerSample != 24 {
+		return data
+	}
+	// The 24 bits of a container, least significant byte first.
+	lo := 0
+	if d.justify == LeftJustified {
+		lo = 1
+	}
+	packed := make([]byte, 0, len(data)/4*3)
+	for i := 0; i+4 <= len(data); i += 4 {
+		packed = append(packed, data[i+lo:i+lo+3]...)
+	}
+	return packed
+}
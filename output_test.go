@@ -0,0 +1,214 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestMixMono(t *testing.T) {
+	tests := []struct {
+		chs  [][]int32
+		want []int32
+	}{
+		{[][]int32{{1, 2, -1, -2, 32767, -32768}, {2, 2, -2, -2, 32766, -32767}}, []int32{2, 2, -2, -2, 32767, -32768}},
+		{[][]int32{{0, 1, -1}, {0, 0, 0}, {1, 0, 0}}, []int32{0, 0, 0}},
+		{[][]int32{{2, 2, -2}, {0, 0, 0}, {1, 0, 0}}, []int32{1, 1, -1}},
+	}
+	for _, test := range tests {
+		got := mixMono(test.chs, 16)
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("Expected %v to mix to %v, got %v", test.chs, test.want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestNextMono(t *testing.T) {
+	left := []int32{100, 101, -3, 0}
+	right := []int32{200, 200, -4, 1}
+	data, _ := testPCMStream(16000, 16, 4, left, right)
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	mono, err := d.NextMono()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []byte{150, 0, 151, 0, 0xFC, 0xFF, 1, 0}
+	if !bytes.Equal(mono, want) {
+		t.Errorf("Expected %v, got %v", want, mono)
+	}
+}
+
+func TestToFixedQ(t *testing.T) {
+	tests := []struct {
+		samples []int32
+		bps, q  int
+		want    []int32
+	}{
+		{[]int32{1, -1, 32767, -32768}, 16, 24, []int32{1 << 9, -1 << 9, 32767 << 9, -32768 << 9}},
+		{[]int32{8388607, -8388608}, 24, 31, []int32{8388607 << 8, -8388608 << 8}},
+		{[]int32{8388607, -8388608, 5}, 24, 23, []int32{8388607, -8388608, 5}},
+		// Rounding 32767 to the nearest Q0.8 value gives 1.0, which is clamped.
+		{[]int32{32767, -32768, 64, 63, -64, -65}, 16, 8, []int32{255, -256, 1, 0, 0, -1}},
+		{[]int32{32767, -32768, 1}, 16, 0, []int32{0, -1, 0}},
+	}
+	for _, test := range tests {
+		got := toFixedQ(test.samples, test.bps, test.q)
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("Expected %v at %d bits in Q%d to be %v, got %v", test.samples, test.bps, test.q, test.want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestNextFixedQ(t *testing.T) {
+	left := []int32{100, -128}
+	right := []int32{-1, 127}
+	data, _ := testPCMStream(16000, 8, 2, left, right)
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	if _, err := d.NextFixedQ(32); err == nil {
+		t.Errorf("Expected an error for 32 fractional bits")
+	}
+	chs, err := d.NextFixedQ(24)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := [][]int32{{100 << 17, -128 << 17}, {-1 << 17, 127 << 17}}
+	for ch := range want {
+		for i := range want[ch] {
+			if chs[ch][i] != want[ch][i] {
+				t.Errorf("Channel %d: expected %v, got %v", ch, want[ch], chs[ch])
+				break
+			}
+		}
+	}
+}
+
+func TestNextInt32Interleaved(t *testing.T) {
+	for _, bps := range []int{8, 16, 24} {
+		for nChannels := 1; nChannels <= 3; nChannels++ {
+			chans := make([][]int32, nChannels)
+			for ch := range chans {
+				chans[ch] = testRamp(40, bps, 3+ch*(1<<uint(bps-4)))
+			}
+			data, _ := testPCMStream(44100, bps, 16, chans...)
+			d, err := NewDecoder(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Unexpected error making a new decoder: %v", err)
+			}
+			var got []int32
+			for {
+				samples, err := d.NextInt32Interleaved()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("%d bits, %d channels: unexpected error: %v", bps, nChannels, err)
+				}
+				got = append(got, samples...)
+			}
+			if len(got) != 40*nChannels {
+				t.Fatalf("%d bits, %d channels: got %d samples, want %d", bps, nChannels, len(got), 40*nChannels)
+			}
+			for i, s := range got {
+				if want := chans[i%nChannels][i/nChannels]; s != want {
+					t.Errorf("%d bits, %d channels: sample %d is %d, want %d", bps, nChannels, i, s, want)
+					break
+				}
+			}
+		}
+	}
+}
+
+func Test24In32(t *testing.T) {
+	left := []int32{0x123456, -2, 0x7FFFFF, -0x800000}
+	right := []int32{0, 1, -1, 0x000100}
+	stream, _ := testPCMStream(48000, 24, 64, left, right)
+	tests := []struct {
+		justify Justification
+		want    []byte
+	}{
+		{RightJustified, []byte{
+			0x56, 0x34, 0x12, 0x00, 0x00, 0x00, 0x00, 0x00,
+			0xFE, 0xFF, 0xFF, 0xFF, 0x01, 0x00, 0x00, 0x00,
+			0xFF, 0xFF, 0x7F, 0x00, 0xFF, 0xFF, 0xFF, 0xFF,
+			0x00, 0x00, 0x80, 0xFF, 0x00, 0x01, 0x00, 0x00,
+		}},
+		{LeftJustified, []byte{
+			0x00, 0x56, 0x34, 0x12, 0x00, 0x00, 0x00, 0x00,
+			0x00, 0xFE, 0xFF, 0xFF, 0x00, 0x01, 0x00, 0x00,
+			0x00, 0xFF, 0xFF, 0x7F, 0x00, 0xFF, 0xFF, 0xFF,
+			0x00, 0x00, 0x00, 0x80, 0x00, 0x00, 0x01, 0x00,
+		}},
+	}
+	for _, test := range tests {
+		// Decode verifies the MD5 checksum of the 24-bit samples.
+		got, _, err := Decode(bytes.NewReader(stream), With24In32(test.justify))
+		if err != nil {
+			t.Fatalf("Justification %d: unexpected error: %v", test.justify, err)
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("Justification %d: expected % X, got % X", test.justify, test.want, got)
+		}
+	}
+
+	// Other bit depths are unchanged.
+	stream, pcm := testPCMStream(44100, 16, 64, testRamp(100, 16, 7))
+	if got, _, err := Decode(bytes.NewReader(stream), With24In32(LeftJustified)); err != nil || !bytes.Equal(got, pcm) {
+		t.Errorf("Expected 16-bit data to be unchanged, got error %v", err)
+	}
+}
+
+func TestRoundTo16(t *testing.T) {
+	samples := []int32{0x123480, 0x123580, 0x12347F, 0x123481, -128, -384, 0x7FFFFF, -0x800000}
+	tests := []struct {
+		mode RoundingMode
+		want []int32
+	}{
+		{Truncate, []int32{0x1234, 0x1235, 0x1234, 0x1234, -1, -2, 0x7FFF, -0x8000}},
+		{RoundHalfUp, []int32{0x1235, 0x1236, 0x1234, 0x1235, 0, -1, 0x7FFF, -0x8000}},
+		{RoundHalfEven, []int32{0x1234, 0x1236, 0x1234, 0x1235, 0, -2, 0x7FFF, -0x8000}},
+	}
+	for _, test := range tests {
+		got := roundTo16(samples, 24, test.mode)
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("Mode %d: expected %#x to round to %#x, got %#x", test.mode, samples[i], test.want[i], got[i])
+			}
+		}
+	}
+}
+
+func TestWith16BitRounding(t *testing.T) {
+	left := []int32{0x123480, -384}
+	right := []int32{0x7FFFFF, 0x000180}
+	stream, _ := testPCMStream(48000, 24, 64, left, right)
+	got, meta, err := Decode(bytes.NewReader(stream), With16BitRounding(RoundHalfEven), With24In32(RightJustified))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []byte{0x34, 0x12, 0xFF, 0x7F, 0xFE, 0xFF, 0x02, 0x00}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Expected % X, got % X", want, got)
+	}
+	if meta.BitsPerSample != 24 {
+		t.Errorf("Expected the metadata to keep 24 bits per sample, got %d", meta.BitsPerSample)
+	}
+
+	stream, pcm := testPCMStream(44100, 16, 64, testRamp(100, 16, 7))
+	if got, _, err := Decode(bytes.NewReader(stream), With16BitRounding(Truncate)); err != nil || !bytes.Equal(got, pcm) {
+		t.Errorf("Expected 16-bit data to be unchanged, got error %v", err)
+	}
+}
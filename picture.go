@@ -0,0 +1,76 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// Picture is a picture, such as cover art, from a PICTURE metadata block.
+type Picture struct {
+	// Type is the picture type as defined by the ID3v2 APIC frame,
+	// for example 3 for the front cover.
+	Type uint32
+	// MIME is the MIME type of the data, or "-->" if Data is a URL of the picture.
+	MIME string
+	// Description is a UTF-8 description of the picture.
+	Description string
+	// Width and Height are the dimensions of the picture in pixels.
+	Width  uint32
+	Height uint32
+	// Depth is the color depth in bits per pixel.
+	Depth uint32
+	// Colors is the number of colors of an indexed-color picture, or 0.
+	Colors uint32
+	Data   []byte
+}
+
+func readPicture(r io.Reader) (*Picture, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	p := new(Picture)
+	var mime, desc []byte
+	if p.Type, data, err = pictureUint32(data); err != nil {
+		return nil, err
+	}
+	if mime, data, err = pictureBytes(data); err != nil {
+		return nil, err
+	}
+	if desc, data, err = pictureBytes(data); err != nil {
+		return nil, err
+	}
+	p.MIME, p.Description = string(mime), string(desc)
+	for _, v := range []*uint32{&p.Width, &p.Height, &p.Depth, &p.Colors} {
+		if *v, data, err = pictureUint32(data); err != nil {
+			return nil, err
+		}
+	}
+	if p.Data, _, err = pictureBytes(data); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func pictureUint32(data []byte) (uint32, []byte, error) {
+	if len(data) < 4 {
+		return 0, nil, errors.New("Truncated PICTURE block")
+	}
+	return binary.BigEndian.Uint32(data), data[4:], nil
+}
+
+// pictureBytes returns the big-endian length-prefixed bytes at the start of data.
+func pictureBytes(data []byte) ([]byte, []byte, error) {
+	n, data, err := pictureUint32(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if uint64(n) > uint64(len(data)) {
+		return nil, nil, errors.New("PICTURE field length exceeds block size")
+	}
+	return data[:n:n], data[n:], nil
+}
@@ -0,0 +1,23 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+//go:build !flac_noimage
+
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"image"
+)
+
+// Decode decodes the picture data using the image formats registered with the
+// image package, returning the image and the name of its format.
+// As with image.Decode, the formats must be registered by the program,
+// typically by importing image/jpeg and image/png for their side effects.
+// Build with the flac_noimage tag to omit Decode and the image dependency.
+func (p *Picture) Decode() (image.Image, string, error) {
+	if p.MIME == "-->" {
+		return nil, "", errors.New("Picture data is a URL")
+	}
+	return image.Decode(bytes.NewReader(p.Data))
+}
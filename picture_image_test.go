@@ -0,0 +1,38 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+//go:build !flac_noimage
+
+package flac
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestPictureDecode(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(1, 1, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	p := Picture{MIME: "image/png", Data: buf.Bytes()}
+	got, format, err := p.Decode()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if format != "png" || got.Bounds() != img.Bounds() {
+		t.Errorf("Expected a 3x2 png, got a %v %s", got.Bounds(), format)
+	}
+	if r, _, _, _ := got.At(1, 1).RGBA(); r != 0xFFFF {
+		t.Errorf("Expected a red pixel at 1,1, got %v", got.At(1, 1))
+	}
+
+	url := Picture{MIME: "-->", Data: []byte("http://example.com/cover.jpg")}
+	if _, _, err := url.Decode(); err == nil {
+		t.Errorf("Expected an error decoding a URL picture")
+	}
+}
@@ -0,0 +1,55 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func pictureBody(p Picture) []byte {
+	var b []byte
+	b = binary.BigEndian.AppendUint32(b, p.Type)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(p.MIME)))
+	b = append(b, p.MIME...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(p.Description)))
+	b = append(b, p.Description...)
+	for _, v := range []uint32{p.Width, p.Height, p.Depth, p.Colors, uint32(len(p.Data))} {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return append(b, p.Data...)
+}
+
+func TestPictures(t *testing.T) {
+	front := Picture{Type: 3, MIME: "image/png", Description: "Front – cover", Width: 2, Height: 1, Depth: 24, Data: []byte{1, 2, 3}}
+	back := Picture{Type: 4, MIME: "image/jpeg", Data: []byte{4}}
+	info := StreamInfo{MinBlock: 16, MaxBlock: 16, SampleRate: 44100, NChannels: 1, BitsPerSample: 16}
+	data := testStream(info, [][]byte{
+		metaBlock(PictureType, false, pictureBody(front)),
+		metaBlock(PictureType, true, pictureBody(back)),
+	})
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(d.Pictures) != 2 {
+		t.Fatalf("Expected 2 pictures, got %d", len(d.Pictures))
+	}
+	for i, want := range []Picture{front, back} {
+		got := *d.Pictures[i]
+		if got.Type != want.Type || got.MIME != want.MIME || got.Description != want.Description ||
+			got.Width != want.Width || got.Height != want.Height || got.Depth != want.Depth ||
+			got.Colors != want.Colors || !bytes.Equal(got.Data, want.Data) {
+			t.Errorf("Picture %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+
+	body := pictureBody(front)
+	for _, n := range []int{3, 10, len(body) - 1} {
+		bad := testStream(info, [][]byte{metaBlock(PictureType, true, body[:n])})
+		if _, err := NewDecoder(bytes.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error for a PICTURE block truncated to %d bytes", n)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+// A readAheadQueue is the state of a Decoder decoding frames ahead of the
+// caller on a background goroutine.
+type readAheadQueue struct {
+	frames chan queuedFrame
+	// Stop is closed to ask the decoding goroutine to return.
+	stop chan struct{}
+	// Done is closed when the decoding goroutine returns.
+	done chan struct{}
+	// Frame describes the frame most recently returned from the queue.
+	frame FrameInfo
+	// Offset is the offset of the end of that frame in the stream.
+	offset int64
+	// Decoded is the number of samples decoded through that frame.
+	decoded int64
+	// Err is the error that ended decoding, once it is returned from the queue.
+	err error
+}
+
+// A queuedFrame is a decoded frame, or the error that ended decoding.
+type queuedFrame struct {
+	data    [][]int32
+	info    FrameInfo
+	offset  int64
+	decoded int64
+	err     error
+}
+
+// startReadAhead starts the goroutine decoding frames into the read-ahead queue.
+func (d *Decoder) startReadAhead() {
+	q := &readAheadQueue{
+		frames: make(chan queuedFrame, d.readAhead),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	d.ahead = q
+	go func() {
+		defer close(q.done)
+		for {
+			data, err := d.readNextFrame()
+			f := queuedFrame{info: d.frame, offset: d.offset, decoded: d.decoded, err: err}
+			f.info.Subframes = copySubframes(f.info.Subframes)
+			if err == nil {
+				// The frame buffers are reused by the next frame.
+				f.data = make([][]int32, len(data))
+				for ch := range data {
+					f.data[ch] = append([]int32(nil), data[ch]...)
+				}
+			}
+			select {
+			case q.frames <- f:
+			case <-q.stop:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// readQueuedFrame returns the next frame from the read-ahead queue,
+// starting the decoding goroutine if needed.
+func (d *Decoder) readQueuedFrame() ([][]int32, error) {
+	if d.ahead == nil {
+		d.startReadAhead()
+	}
+	q := d.ahead
+	if q.err != nil {
+		return nil, q.err
+	}
+	f := <-q.frames
+	if f.err != nil {
+		q.err = f.err
+		return nil, f.err
+	}
+	q.frame, q.offset, q.decoded = f.info, f.offset, f.decoded
+	return f.data, nil
+}
+
+// stopReadAhead stops the read-ahead goroutine, if any, and waits for it to return,
+// which it does only once any read of the source in progress returns.
+func (d *Decoder) stopReadAhead() {
+	q := d.ahead
+	if q == nil {
+		return
+	}
+	close(q.stop)
+	<-q.done
+	d.ahead = nil
+}
+
+// ReadAheadDepth returns the number of decoded frames waiting in the
+// read-ahead queue of a decoder created with WithReadAhead.
+func (d *Decoder) ReadAheadDepth() int {
+	if d.ahead == nil {
+		return 0
+	}
+	return len(d.ahead.frames)
+}
@@ -0,0 +1,100 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadAhead(t *testing.T) {
+	stream, pcm := testPCMStream(44100, 16, 64, testRamp(1000, 16, 31), testRamp(1000, 16, 57))
+	d, err := NewDecoder(bytes.NewReader(stream), WithReadAhead(4), WithStrict())
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	defer d.Close()
+	if n := d.ReadAheadDepth(); n != 0 {
+		t.Errorf("Expected an empty queue before the first read, got %d", n)
+	}
+	var got []byte
+	for i := 0; ; i++ {
+		frame, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info := d.FrameInfo(); info.FirstSample != int64(i*64) {
+			t.Errorf("Frame %d: expected first sample %d, got %d", i, i*64, info.FirstSample)
+		}
+		if n := d.ReadAheadDepth(); n > 4 {
+			t.Errorf("Queue depth %d exceeds the read-ahead of 4 frames", n)
+		}
+		got = append(got, frame...)
+	}
+	if !bytes.Equal(got, pcm) {
+		t.Errorf("Decoded data does not match")
+	}
+	if _, err := d.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF after the end, got %v", err)
+	}
+}
+
+func TestReadAheadFill(t *testing.T) {
+	stream, _ := testPCMStream(44100, 16, 64, testRamp(1000, 16, 31))
+	d, err := NewDecoder(bytes.NewReader(stream), WithReadAhead(3))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	if _, err := d.Next(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for d.ReadAheadDepth() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := d.ReadAheadDepth(); n != 3 {
+		t.Errorf("Expected 3 queued frames, got %d", n)
+	}
+	// Close must stop the goroutine blocked on the full queue.
+	if err := d.Close(); err != nil {
+		t.Errorf("Unexpected error closing: %v", err)
+	}
+	if n := d.ReadAheadDepth(); n != 0 {
+		t.Errorf("Expected an empty queue after Close, got %d", n)
+	}
+}
+
+func TestReadAheadError(t *testing.T) {
+	stream, pcm := testPCMStream(44100, 16, 64, testRamp(1000, 16, 31))
+	// Cut the stream in the middle of the third frame.
+	frameSize := (len(stream) - (len(magic) + 4 + 34)) / 16
+	stream = stream[:len(magic)+4+34+2*frameSize+frameSize/2]
+	d, err := NewDecoder(bytes.NewReader(stream), WithReadAhead(8))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	defer d.Close()
+	var got []byte
+	for {
+		frame, err := d.Next()
+		if err != nil {
+			if err == io.EOF || !strings.Contains(err.Error(), "runcated") {
+				t.Errorf("Expected a truncation error, got %v", err)
+			}
+			break
+		}
+		got = append(got, frame...)
+	}
+	if !bytes.Equal(got, pcm[:2*64*2]) {
+		t.Errorf("Expected the first two frames, got %d bytes", len(got))
+	}
+	if _, err := d.Next(); err == nil || err == io.EOF {
+		t.Errorf("Expected the error to be returned again, got %v", err)
+	}
+}
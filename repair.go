@@ -0,0 +1,78 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bufio"
+	"crypto/md5"
+	"io"
+)
+
+// Repair decodes a FLAC stream and writes it to w with a corrected STREAMINFO,
+// fixing streams whose encoder left its fields unset or wrong.
+// The MD5 checksum, total samples, and minimum and maximum block and frame
+// sizes are those of the decoded frames; the other fields are kept.
+// Every other metadata block and every frame is copied byte for byte.
+// The stream must begin at the current offset of r.
+func Repair(r io.ReadSeeker, w io.Writer) error {
+	base, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	// Every sample of the final frame counts, whatever the old total samples.
+	d, err := NewDecoder(r, WithRawMetadata(), WithFullFinalFrame())
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	info := *d.StreamInfo
+	info.MinBlock, info.MaxBlock, info.MinFrame, info.MaxFrame = 0, 0, 0, 0
+	h := md5.New()
+	var total int64
+	// Last is the block size of the last frame, which does not count towards the minimum.
+	var last int
+	for {
+		data, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		h.Write(data)
+		f := d.currentFrame()
+		size := len(d.in.buf)
+		if last != 0 && (info.MinBlock == 0 || last < info.MinBlock) {
+			info.MinBlock = last
+		}
+		if f.BlockSize > info.MaxBlock {
+			info.MaxBlock = f.BlockSize
+		}
+		if info.MinFrame == 0 || size < info.MinFrame {
+			info.MinFrame = size
+		}
+		if size > info.MaxFrame {
+			info.MaxFrame = size
+		}
+		last = f.BlockSize
+		total += int64(f.BlockSize)
+	}
+	if info.MinBlock == 0 {
+		// There is at most one frame.
+		info.MinBlock = info.MaxBlock
+	}
+	info.TotalSamples = total
+	copy(info.MD5[:], h.Sum(nil))
+
+	if _, err := r.Seek(base+d.HeaderSize(), io.SeekStart); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	if err := writeMetadata(bw, d.Blocks, info); err != nil {
+		return err
+	}
+	if _, err := io.Copy(bw, r); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,52 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"crypto/md5"
+	"testing"
+)
+
+func TestRepair(t *testing.T) {
+	samples := testRamp(150, 16, 1001)
+	frames := [][]byte{
+		verbatimFrame(0, 16, samples[:64], samples[:64]),
+		verbatimFrame(1, 16, samples[64:128], samples[64:128]),
+		verbatimFrame(2, 16, samples[128:], samples[128:]),
+	}
+	// An encoder that left everything but the audio format unset.
+	broken := StreamInfo{SampleRate: 44100, NChannels: 2, BitsPerSample: 16}
+	comment := metaBlock(VorbisCommentType, false, []byte("\x03\x00\x00\x00abc\x00\x00\x00\x00"))
+	padding := metaBlock(PaddingType, true, make([]byte, 10))
+	stream := testStream(broken, [][]byte{comment, padding}, frames...)
+
+	var buf bytes.Buffer
+	if err := Repair(bytes.NewReader(stream), &buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := buf.Bytes()
+
+	pcm, meta, err := Decode(bytes.NewReader(got), WithStrict())
+	if err != nil {
+		t.Fatalf("Unexpected error decoding the repaired stream: %v", err)
+	}
+	want := StreamInfo{
+		MinBlock:      64,
+		MaxBlock:      64,
+		MinFrame:      len(frames[2]),
+		MaxFrame:      len(frames[0]),
+		SampleRate:    44100,
+		NChannels:     2,
+		BitsPerSample: 16,
+		TotalSamples:  150,
+		MD5:           md5.Sum(pcm),
+	}
+	if *meta.StreamInfo != want {
+		t.Errorf("Expected STREAMINFO %+v, got %+v", want, *meta.StreamInfo)
+	}
+	// Only the STREAMINFO changed.
+	if len(got) != len(stream) || !bytes.Equal(got[:8], stream[:8]) || !bytes.Equal(got[42:], stream[42:]) {
+		t.Errorf("Expected everything but the STREAMINFO to be copied")
+	}
+}
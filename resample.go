@@ -0,0 +1,107 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import "strconv"
+
+// A Resampler converts decoded audio to a different sample rate.
+// Resample is called once per frame for each channel, in channel order,
+// and returns the resampled samples of that channel.
+// Implementations may keep per-channel state between calls in order to
+// interpolate across frame boundaries.
+type Resampler interface {
+	Resample(ch int, samples []int32) []int32
+}
+
+// WithResample resamples the decoded audio to targetRate Hz.
+// NewResampler is called once the source sample rate is known to create
+// the Resampler; if it is nil, NewLinearResampler is used.
+//
+// Resampling is not lossless, so Decode does not verify the MD5 checksum of
+// resampled audio. The metadata continues to describe the source stream.
+func WithResample(targetRate int, newResampler func(srcRate, dstRate, nChannels int) Resampler) Option {
+	if newResampler == nil {
+		newResampler = NewLinearResampler
+	}
+	return func(d *Decoder) {
+		d.resampleRate = targetRate
+		d.newResampler = newResampler
+	}
+}
+
+// NewLinearResampler returns a Resampler that linearly interpolates between
+// neighbouring source samples, including across frame boundaries.
+// It applies no low-pass filter, so downsampling aliases any content above
+// the target Nyquist frequency, and upsampling slightly attenuates high
+// frequencies. That is adequate for speech or analysis pipelines that need a
+// uniform rate, but a windowed-sinc Resampler should be used where quality matters.
+// It panics if either rate is not positive.
+func NewLinearResampler(srcRate, dstRate, nChannels int) Resampler {
+	if srcRate <= 0 || dstRate <= 0 {
+		panic("flac: bad resampler rates (" + strconv.Itoa(srcRate) + ", " + strconv.Itoa(dstRate) + ")")
+	}
+	return &linearResampler{
+		src:   int64(srcRate),
+		dst:   int64(dstRate),
+		chans: make([]linearState, nChannels),
+	}
+}
+
+type linearResampler struct {
+	src, dst int64
+	chans    []linearState
+}
+
+// linearState is the interpolation state of a single channel.
+type linearState struct {
+	// T is the position of the next output sample relative to the start of
+	// the next frame, in units of 1/dst source samples.
+	// It is negative if the output sample lies between the last sample of
+	// the previous frame and the first sample of the next.
+	t int64
+	// Prev is the last sample of the previous frame.
+	prev    int32
+	started bool
+}
+
+func (r *linearResampler) Resample(ch int, samples []int32) []int32 {
+	st := &r.chans[ch]
+	n := int64(len(samples))
+	if n == 0 {
+		return samples
+	}
+	if !st.started {
+		st.prev = samples[0]
+		st.started = true
+	}
+	at := func(i int64) int64 {
+		if i < 0 {
+			return int64(st.prev)
+		}
+		return int64(samples[i])
+	}
+
+	out := make([]int32, 0, (n*r.dst)/r.src+1)
+	for ; st.t <= (n-1)*r.dst; st.t += r.src {
+		i := floorDiv(st.t, r.dst)
+		frac := st.t - i*r.dst
+		v := at(i)
+		if frac > 0 {
+			// Round the interpolated value to the nearest integer.
+			diff := (at(i+1) - v) * frac
+			v += floorDiv(2*diff+r.dst, 2*r.dst)
+		}
+		out = append(out, int32(v))
+	}
+	st.t -= n * r.dst
+	st.prev = samples[n-1]
+	return out
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
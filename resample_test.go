@@ -0,0 +1,142 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestLinearResampler(t *testing.T) {
+	tests := []struct {
+		src, dst int
+		frames   [][]int32
+		want     []int32
+	}{
+		{
+			src: 1, dst: 2,
+			frames: [][]int32{{0, 10, 20}, {30, 41}},
+			want:   []int32{0, 5, 10, 15, 20, 25, 30, 36, 41},
+		},
+		{
+			src: 2, dst: 1,
+			frames: [][]int32{{0, 10, 20}, {30, 40, 50}},
+			want:   []int32{0, 20, 40},
+		},
+		{
+			src: 3, dst: 2,
+			frames: [][]int32{{0, 30, 60, 90}, {120, 150}},
+			want:   []int32{0, 45, 90, 135},
+		},
+		{
+			src: 1, dst: 3,
+			frames: [][]int32{{0, -10}, {-11}},
+			want:   []int32{0, -3, -7, -10, -10, -11, -11},
+		},
+	}
+	for _, test := range tests {
+		r := NewLinearResampler(test.src, test.dst, 1)
+		var got []int32
+		for _, f := range test.frames {
+			got = append(got, r.Resample(0, f)...)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%d→%d: expected %v, got %v", test.src, test.dst, test.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%d→%d: expected %v, got %v", test.src, test.dst, test.want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestWithResample(t *testing.T) {
+	samples := testRamp(4800, 16, 3)
+	data, _ := testPCMStream(48000, 16, 1000, samples, samples)
+	d, err := NewDecoder(bytes.NewReader(data), WithResample(44100, nil))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	n := 0
+	for {
+		frame, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error decoding: %v", err)
+		}
+		n += len(frame) / 4
+	}
+	// 0.1s of audio at 44.1kHz, give or take the final interpolation point.
+	if n < 4409 || n > 4410 {
+		t.Errorf("Expected about 4410 resampled samples, got %d", n)
+	}
+
+	if _, _, err := Decode(bytes.NewReader(data), WithResample(22050, nil)); err != nil {
+		t.Errorf("Unexpected error decoding with resampling: %v", err)
+	}
+}
+
+// doublingResampler repeats every sample, reusing its output buffer between calls.
+type doublingResampler struct {
+	out [][]int32
+}
+
+func (r *doublingResampler) Resample(ch int, samples []int32) []int32 {
+	out := r.out[ch][:0]
+	for _, s := range samples {
+		out = append(out, s, s)
+	}
+	r.out[ch] = out
+	return out
+}
+
+func TestResamplerBuffers(t *testing.T) {
+	samples := testRamp(1000, 16, 37)
+	data, _ := testPCMStream(48000, 16, 100, samples)
+	d, err := NewDecoder(bytes.NewReader(data), WithResample(96000, func(src, dst, n int) Resampler {
+		return &doublingResampler{out: make([][]int32, n)}
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	defer d.Close()
+	var got []int32
+	for {
+		frame, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error decoding: %v", err)
+		}
+		for i := 0; i+2 <= len(frame); i += 2 {
+			got = append(got, int32(int16(frame[i])|int16(frame[i+1])<<8))
+		}
+	}
+	want := make([]int32, 0, 2*len(samples))
+	for _, s := range samples {
+		want = append(want, s, s)
+	}
+	if !equalInt32s(got, want) {
+		t.Errorf("Resampled audio does not match")
+	}
+
+	info := StreamInfo{MinBlock: 16, MaxBlock: 16, NChannels: 1, BitsPerSample: 16}
+	if _, err := NewDecoder(bytes.NewReader(testStream(info, nil)), WithResample(44100, nil)); err == nil {
+		t.Errorf("Expected an error resampling from an unknown sample rate")
+	}
+	for _, rates := range [][2]int{{0, 44100}, {44100, 0}, {-1, 44100}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic for rates %v", rates)
+				}
+			}()
+			NewLinearResampler(rates[0], rates[1], 1)
+		}()
+	}
+}
@@ -0,0 +1,306 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// A frameScanner splits a stream into raw frames without decoding their subframes.
+//
+// Frames carry no length, so the end of a frame is found by searching for the
+// next sync code that begins a frame header with a valid CRC8 and at which the
+// CRC16 of the bytes read so far is valid. The last frame ends at the end of the stream.
+type frameScanner struct {
+	r    *bufio.Reader
+	info *StreamInfo
+	// Pending holds the sync code of the next frame, consumed while finding the end of the current one.
+	pending []byte
+	buf     bytes.Buffer
+}
+
+func newFrameScanner(r *bufio.Reader, info *StreamInfo) *frameScanner {
+	return &frameScanner{r: r, info: info}
+}
+
+// next returns the raw bytes and the header of the next frame.
+// The returned bytes are only valid until the next call.
+// At the end of the stream, next returns io.EOF.
+func (s *frameScanner) next() ([]byte, *frameHeader, error) {
+	s.buf.Reset()
+	in := io.MultiReader(bytes.NewReader(s.pending), s.r)
+	s.pending = s.pending[:0]
+	h, err := readFrameHeader(io.TeeReader(in, &s.buf), s.info)
+	if err == io.EOF && s.buf.Len() == 0 {
+		return nil, nil, io.EOF
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("Failed to read the frame header: %w", err)
+	}
+	limit := maxFrameSize(h)
+
+	// CRC is the CRC16 of the frame so far, and prevCRC is its value before the last byte.
+	crc := crc16(s.buf.Bytes())
+	var prevCRC uint16
+	prev := byte(0)
+	for {
+		b, err := s.r.ReadByte()
+		if err == io.EOF {
+			if crc != 0 {
+				return nil, nil, errors.New("Bad checksum")
+			}
+			return s.buf.Bytes(), h, nil
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		if prev == 0xFF && b&0xFE == 0xF8 && prevCRC == 0 && s.isFrameHeader(b) {
+			// The 0xFF is the start of the next frame, not part of this one.
+			s.buf.Truncate(s.buf.Len() - 1)
+			s.pending = append(s.pending, 0xFF, b)
+			return s.buf.Bytes(), h, nil
+		}
+
+		s.buf.WriteByte(b)
+		if s.buf.Len() > limit {
+			return nil, nil, errors.New("Bad checksum or missing frame boundary within " + strconv.Itoa(limit) + " bytes")
+		}
+		prev, prevCRC, crc = b, crc, crc16Update(crc, b)
+	}
+}
+
+// maxFrameHeaderSize is the size in bytes of the largest frame header.
+const maxFrameHeaderSize = 16
+
+// isFrameHeader returns whether a valid frame header starts with 0xFF, b, and the upcoming bytes.
+func (s *frameScanner) isFrameHeader(b byte) bool {
+	peek, _ := s.r.Peek(maxFrameHeaderSize - 2)
+	hdr := append([]byte{0xFF, b}, peek...)
+	h, err := readFrameHeader(bytes.NewReader(hdr), s.info)
+	return err == nil && (s.info == nil || h.channelAssignment.nChannels() == s.info.NChannels)
+}
+
+// maxFrameSize returns a generous upper bound on the size in bytes of a frame with the given header.
+// It allows for residual coding to be up to twice the size of verbatim samples.
+func maxFrameSize(h *frameHeader) int {
+	const overhead = 16 + 2 // Header and footer.
+	n := overhead
+	for ch := 0; ch < h.channelAssignment.nChannels(); ch++ {
+		n += 8 + 2*(h.blockSize*int(h.bitsPerSample(ch))+7)/8
+	}
+	return n
+}
+
+// VerifyCRC checks the structural integrity of a FLAC stream by verifying
+// the CRC8 and CRC16 checksums of every frame, without decoding any audio.
+// It is much faster than a full decode, but unlike Decode it does not verify the MD5
+// checksum of the audio data.
+// It returns the number of frames checked before any error.
+func VerifyCRC(r io.Reader) (int, error) {
+	d, err := NewDecoder(r)
+	if err != nil {
+		return 0, err
+	}
+	s := newFrameScanner(d.r, d.StreamInfo)
+	for n := 0; ; n++ {
+		if _, _, err := s.next(); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, fmt.Errorf("Frame %d: %w", n, err)
+		}
+	}
+}
+
+// A FrameIndexEntry locates a frame of a stream, as returned by BuildIndex.
+type FrameIndexEntry struct {
+	// Offset is the offset in bytes of the frame from the start of the stream.
+	Offset int64
+	// FirstSample is the number of the first inter-channel sample in the frame.
+	FirstSample int64
+	// Samples is the number of inter-channel samples in the frame.
+	Samples int
+}
+
+// BuildIndex reads the header of a FLAC stream and scans its frames without
+// decoding any audio, returning the STREAMINFO and the location of every frame,
+// everything needed for random access to the stream later.
+// The CRC8 and CRC16 checksums of every frame are verified while scanning.
+// The stream must begin at the current offset of r, from which offsets are measured.
+func BuildIndex(r io.ReadSeeker) (StreamInfo, []FrameIndexEntry, error) {
+	d, err := NewDecoder(r)
+	if err != nil {
+		return StreamInfo{}, nil, err
+	}
+	var index []FrameIndexEntry
+	off := d.HeaderSize()
+	s := newFrameScanner(d.r, d.StreamInfo)
+	for {
+		frame, h, err := s.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return StreamInfo{}, nil, fmt.Errorf("Frame %d: %w", len(index), err)
+		}
+		index = append(index, FrameIndexEntry{Offset: off, FirstSample: frameInfo(h, d.StreamInfo).FirstSample, Samples: h.blockSize})
+		off += int64(len(frame))
+	}
+	return *d.StreamInfo, index, nil
+}
+
+// ComputeDuration scans the frames of the stream decoded by d without decoding
+// any audio, and returns its duration from the sum of their block sizes.
+// It recovers the duration of a stream whose STREAMINFO does not give the
+// total samples, such as one written by a streaming encoder.
+// The CRC8 and CRC16 checksums of every frame are verified while scanning.
+//
+// R must read the stream of d, beginning at offset 0. The scan is independent
+// of the decoding position of d: the offset of r is restored when it returns.
+func (d *Decoder) ComputeDuration(r io.ReadSeeker) (time.Duration, error) {
+	if d.SampleRate == 0 {
+		return 0, errors.New("Indeterminate duration: the sample rate is unknown (0)")
+	}
+	pos, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	samples, err := d.countSamples(r)
+	if _, serr := r.Seek(pos, io.SeekStart); err == nil {
+		err = serr
+	}
+	if err != nil {
+		return 0, err
+	}
+	// Whole seconds first, so that the product cannot overflow for long streams.
+	rate := int64(d.SampleRate)
+	return time.Duration(samples/rate)*time.Second + time.Duration(samples%rate)*time.Second/time.Duration(rate), nil
+}
+
+// countSamples returns the number of inter-channel samples of the frames of d read from r.
+func (d *Decoder) countSamples(r io.ReadSeeker) (int64, error) {
+	sr, err := newStreamRange(d, r, 0)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(sr.first, io.SeekStart); err != nil {
+		return 0, err
+	}
+	s := newFrameScanner(bufio.NewReader(io.LimitReader(r, sr.end-sr.first)), d.StreamInfo)
+	var total int64
+	for n := 0; ; n++ {
+		_, h, err := s.next()
+		if err == io.EOF {
+			return total, nil
+		} else if err != nil {
+			return 0, fmt.Errorf("Frame %d: %w", n, err)
+		}
+		total += int64(h.blockSize)
+	}
+}
+
+// renumberFrame returns a copy of the raw frame with the frame number,
+// or for a variable block size stream the sample number, in its header replaced by number.
+// The CRC8 and CRC16 of the frame are recomputed.
+func renumberFrame(frame []byte, number uint64) ([]byte, error) {
+	hdrLen, err := frameHeaderSize(frame)
+	if err != nil {
+		return nil, err
+	}
+	n := utf8Len(frame[4])
+	num := utf8Encode(number)
+	out := make([]byte, 0, len(frame)-n+len(num))
+	out = append(out, frame[:4]...)
+	out = append(out, num...)
+	out = append(out, frame[4+n:hdrLen-1]...)
+	out = append(out, crc8(out))
+	out = append(out, frame[hdrLen:len(frame)-2]...)
+	crc := crc16(out)
+	return append(out, byte(crc>>8), byte(crc)), nil
+}
+
+// frameHeaderSize returns the size in bytes of the header of the raw frame,
+// including its CRC8.
+func frameHeaderSize(frame []byte) (int, error) {
+	if len(frame) < 5 {
+		return 0, errors.New("Truncated frame")
+	}
+	hdrLen := 4 + utf8Len(frame[4]) + 1
+	switch frame[2] >> 4 {
+	case 6:
+		hdrLen++
+	case 7:
+		hdrLen += 2
+	}
+	switch frame[2] & 0xF {
+	case 12:
+		hdrLen++
+	case 13, 14:
+		hdrLen += 2
+	}
+	if len(frame) < hdrLen+2 {
+		return 0, errors.New("Truncated frame")
+	}
+	return hdrLen, nil
+}
+
+// sniffFrames is the number of frames read by SniffStreamInfo.
+const sniffFrames = 4
+
+// SniffStreamInfo infers the audio format of a stream of raw frames with no
+// header, such as FLAC in a container, from the headers of its first few frames.
+// The returned StreamInfo has the sample rate, number of channels, and bits
+// per sample of the frames; for a stream with a fixed block size, MinBlock
+// and MaxBlock are the largest block size of the frames read, and the other
+// fields are unknown. It suits NewDecoderWithStart.
+// It is an error for the frames to disagree, or for the first frame to defer
+// its sample rate or bits per sample to a STREAMINFO block.
+// The CRC8 and CRC16 checksums of the frames read are verified.
+func SniffStreamInfo(r io.Reader) (StreamInfo, error) {
+	br := bufio.NewReader(r)
+	peek, err := br.Peek(maxFrameHeaderSize)
+	if len(peek) == 0 {
+		if err == io.EOF {
+			err = errors.New("No frames")
+		}
+		return StreamInfo{}, err
+	}
+	// Sample size code 0, in bits 1 to 3 of the fourth byte, defers to STREAMINFO.
+	// It is checked first, as reading the header fails on it with a less specific error.
+	if len(peek) >= 4 && peek[0] == 0xFF && peek[1]&0xFE == 0xF8 && peek[3]>>1&0x7 == 0 {
+		return StreamInfo{}, errors.New("Frame header defers its bits per sample to STREAMINFO")
+	}
+	// An unset STREAMINFO makes the header fail if it defers its sample rate to one.
+	h, err := readFrameHeader(bytes.NewReader(peek), &StreamInfo{})
+	if err != nil {
+		return StreamInfo{}, fmt.Errorf("Failed to read the frame header: %w", err)
+	}
+	info := StreamInfo{
+		SampleRate:    h.sampleRate,
+		NChannels:     h.channelAssignment.nChannels(),
+		BitsPerSample: h.sampleSize,
+	}
+
+	s := newFrameScanner(br, &info)
+	for n := 0; n < sniffFrames; n++ {
+		_, f, err := s.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return StreamInfo{}, fmt.Errorf("Frame %d: %w", n, err)
+		}
+		if f.sampleRate != info.SampleRate || f.channelAssignment.nChannels() != info.NChannels || f.sampleSize != info.BitsPerSample {
+			return StreamInfo{}, errors.New("Frame " + strconv.Itoa(n) + " has " + strconv.Itoa(f.sampleRate) + " Hz, " +
+				strconv.Itoa(f.channelAssignment.nChannels()) + " channels, and " + strconv.Itoa(f.sampleSize) +
+				" bits per sample, but frame 0 has " + strconv.Itoa(info.SampleRate) + " Hz, " + strconv.Itoa(info.NChannels) +
+				" channels, and " + strconv.Itoa(info.BitsPerSample) + " bits per sample")
+		}
+		if !f.variableSize && f.blockSize > info.MaxBlock {
+			info.MinBlock, info.MaxBlock = f.blockSize, f.blockSize
+		}
+	}
+	return info, nil
+}
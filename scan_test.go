@@ -0,0 +1,200 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSniffStreamInfo(t *testing.T) {
+	samples := testRamp(300, 16, 1001)
+	// frame returns a frame of the stereo samples from i with the given sample rate code,
+	// and 16-bit samples given by the header.
+	frame := func(number uint64, rateCode uint64, i, n int) []byte {
+		h := testHeader{blockSize: n, assign: 1, rateCode: rateCode, sizeCode: 4, number: number}
+		return testFrame(h, func(w *bitWriter) {
+			writeVerbatim(w, 16, samples[i:i+n])
+			writeVerbatim(w, 16, samples[i:i+n])
+		})
+	}
+	var stream []byte
+	for i := 0; i < 4; i++ {
+		stream = append(stream, frame(uint64(i), 9, 64*i, 64)...)
+	}
+	stream = append(stream, frame(4, 9, 256, 44)...)
+
+	info, err := SniffStreamInfo(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := StreamInfo{MinBlock: 64, MaxBlock: 64, SampleRate: 44100, NChannels: 2, BitsPerSample: 16}
+	if info != want {
+		t.Errorf("Expected %+v, got %+v", want, info)
+	}
+	d, err := NewDecoderWithStart(bytes.NewReader(stream), info, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var n int
+	for {
+		data, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error decoding: %v", err)
+		}
+		n += len(data) / 4
+	}
+	if n != 300 {
+		t.Errorf("Expected 300 samples, got %d", n)
+	}
+
+	// A frame at 48 kHz.
+	mixed := append(frame(0, 9, 0, 64), frame(1, 10, 64, 64)...)
+	if _, err := SniffStreamInfo(bytes.NewReader(mixed)); err == nil {
+		t.Errorf("Expected an error for frames that disagree")
+	}
+	if _, err := SniffStreamInfo(bytes.NewReader(verbatimFrame(0, 16, samples))); err == nil {
+		t.Errorf("Expected an error for a frame that defers to STREAMINFO")
+	}
+	deferred := testFrame(testHeader{blockSize: 64, rateCode: 9}, func(w *bitWriter) {
+		writeVerbatim(w, 16, samples[:64])
+	})
+	if _, err := SniffStreamInfo(bytes.NewReader(deferred)); err == nil || err.Error() != "Frame header defers its bits per sample to STREAMINFO" {
+		t.Errorf("Expected an error for a frame that defers its bits per sample, got %v", err)
+	}
+	if _, err := SniffStreamInfo(bytes.NewReader(frame(0, 0, 0, 64))); !errors.Is(err, errUnknownSampleRate) {
+		t.Errorf("Expected %v, got %v", errUnknownSampleRate, err)
+	}
+	if _, err := SniffStreamInfo(bytes.NewReader(nil)); err == nil {
+		t.Errorf("Expected an error for no frames")
+	}
+}
+
+func TestVerifyCRC(t *testing.T) {
+	left, right := testRamp(10000, 16, 771), testRamp(10000, 16, 13)
+	data, _ := testPCMStream(44100, 16, 1152, left, right)
+
+	n, err := VerifyCRC(bytes.NewReader(data))
+	if err != nil || n != 9 {
+		t.Errorf("Expected 9 frames and no error, got %d, %v", n, err)
+	}
+
+	// Corrupt a sample in the middle of the stream.
+	bad := append([]byte{}, data...)
+	bad[len(bad)/2] ^= 0x10
+	if n, err := VerifyCRC(bytes.NewReader(bad)); err == nil || n != 4 {
+		t.Errorf("Expected an error in frame 4, got %d frames, %v", n, err)
+	}
+}
+
+func TestBuildIndex(t *testing.T) {
+	left, right := testRamp(10000, 16, 771), testRamp(10000, 16, 13)
+	data, _ := testPCMStream(44100, 16, 1152, left, right)
+	desc, err := Describe(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	info, index, err := BuildIndex(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info != desc.StreamInfo {
+		t.Errorf("Expected %+v, got %+v", desc.StreamInfo, info)
+	}
+	if len(index) != len(desc.Frames) {
+		t.Fatalf("Expected %d frames, got %d", len(desc.Frames), len(index))
+	}
+	for i, f := range desc.Frames {
+		want := FrameIndexEntry{Offset: f.Offset, FirstSample: f.FirstSample, Samples: f.BlockSize}
+		if index[i] != want {
+			t.Errorf("Frame %d: expected %+v, got %+v", i, want, index[i])
+		}
+	}
+
+	bad := append([]byte{}, data...)
+	bad[len(bad)/2] ^= 0x10
+	if _, _, err := BuildIndex(bytes.NewReader(bad)); err == nil {
+		t.Errorf("Expected an error indexing a corrupt stream")
+	}
+}
+
+func BenchmarkVerifyCRC(b *testing.B) {
+	left, right := testRamp(44100, 16, 77), testRamp(44100, 16, 91)
+	data, _ := testPCMStream(44100, 16, 4096, left, right)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if _, err := VerifyCRC(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	left, right := testRamp(44100, 16, 77), testRamp(44100, 16, 91)
+	data, _ := testPCMStream(44100, 16, 4096, left, right)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := Decode(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestComputeDuration(t *testing.T) {
+	left, right := testRamp(10000, 16, 771), testRamp(10000, 16, 13)
+	data, _ := testPCMStream(8000, 16, 1152, left, right)
+	// Clear the total samples, the low 36 bits of bytes 13 to 17 of the STREAMINFO body.
+	const body = 4 + 4
+	data[body+13] &^= 0x0F
+	for i := body + 14; i < body+18; i++ {
+		data[i] = 0
+	}
+
+	r := bytes.NewReader(data)
+	d, err := NewDecoder(r)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if d.TotalSamples != 0 {
+		t.Fatalf("Expected 0 total samples, got %d", d.TotalSamples)
+	}
+	pos, _ := r.Seek(0, io.SeekCurrent)
+	got, err := d.ComputeDuration(r)
+	if want := 1250 * time.Millisecond; err != nil || got != want {
+		t.Errorf("Expected %v, got %v, %v", want, got, err)
+	}
+	if off, _ := r.Seek(0, io.SeekCurrent); off != pos {
+		t.Errorf("Expected the offset %d to be restored, got %d", pos, off)
+	}
+	// Decoding continues from where it was.
+	var n int
+	for {
+		data, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		n += len(data) / 4
+	}
+	if n != 10000 {
+		t.Errorf("Expected 10000 samples, got %d", n)
+	}
+
+	bad := append([]byte{}, data...)
+	bad[len(bad)/2] ^= 0x10
+	d, err = NewDecoder(bytes.NewReader(bad))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := d.ComputeDuration(bytes.NewReader(bad)); err == nil {
+		t.Errorf("Expected an error scanning a corrupt stream")
+	}
+}
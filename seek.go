@@ -0,0 +1,313 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// seekSearchLimit is the size in bytes of the range of a stream below which
+// seeking stops bisecting and decodes forward instead.
+const seekSearchLimit = 64 << 10
+
+// A streamRange describes where the frames of a stream are in an io.ReadSeeker.
+type streamRange struct {
+	rs io.ReadSeeker
+	// First is the offset of the first frame.
+	first int64
+	// End is the offset of the end of the last frame.
+	end int64
+}
+
+// newStreamRange returns the range of the frames of the stream decoded by d,
+// which was made from rs positioned at base.
+func newStreamRange(d *Decoder, rs io.ReadSeeker, base int64) (*streamRange, error) {
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if d.ID3v1 != nil {
+		end -= id3v1Size
+	}
+	return &streamRange{rs: rs, first: base + d.HeaderSize(), end: end}, nil
+}
+
+// reset positions d to decode frames starting at offset off.
+func (s *streamRange) reset(d *Decoder, off int64) error {
+	if _, err := s.rs.Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+	d.r.Reset(io.LimitReader(s.rs, s.end-off))
+	d.frame = FrameInfo{}
+	d.offset = d.HeaderSize() + off - s.first
+	return nil
+}
+
+// nextFrame returns the offset and header of the first frame beginning at or after off.
+// If there is none, it returns s.end and a nil header.
+func (s *streamRange) nextFrame(d *Decoder, off int64) (int64, *frameHeader, error) {
+	if _, err := s.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, nil, err
+	}
+	br := bufio.NewReader(io.LimitReader(s.rs, s.end-off))
+	for ; ; off++ {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return s.end, nil, nil
+		} else if err != nil {
+			return 0, nil, err
+		}
+		if b != 0xFF {
+			continue
+		}
+		peek, _ := br.Peek(maxFrameHeaderSize - 1)
+		if len(peek) == 0 || peek[0]&0xFE != 0xF8 {
+			continue
+		}
+		h, err := readFrameHeader(bytes.NewReader(append([]byte{0xFF}, peek...)), d.StreamInfo)
+		if err == nil && h.channelAssignment.nChannels() == d.NChannels {
+			return off, h, nil
+		}
+	}
+}
+
+// seek positions d at a frame beginning at or before the given sample,
+// close enough to it to decode forward.
+func (s *streamRange) seek(d *Decoder, sample int64) error {
+	lo, hi := s.first, s.end
+	for hi-lo > seekSearchLimit {
+		mid := lo + (hi-lo)/2
+		off, h, err := s.nextFrame(d, mid)
+		if err != nil {
+			return err
+		}
+		// No frame begins between mid and off, so if the frame at off is past the sample,
+		// the frame holding the sample begins before mid.
+		if h == nil || off >= hi || frameInfo(h, d.StreamInfo).FirstSample > sample {
+			hi = mid
+		} else {
+			lo = off
+		}
+	}
+	return s.reset(d, lo)
+}
+
+// ReadSamples decodes count inter-channel samples of a FLAC stream beginning at sample start,
+// returning the interleaved data and the STREAMINFO of the stream.
+// Rather than decoding from the beginning, it seeks near the frame containing start.
+// The range is clamped to the samples of the stream.
+// The stream must begin at the current offset of r.
+func ReadSamples(r io.ReadSeeker, start, count int64) ([]byte, StreamInfo, error) {
+	base, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, StreamInfo{}, err
+	}
+	d, err := NewDecoder(r)
+	if err != nil {
+		return nil, StreamInfo{}, err
+	}
+	defer d.Close()
+	info := *d.StreamInfo
+
+	if start < 0 {
+		start = 0
+	}
+	if count < 0 {
+		count = 0
+	}
+	if info.HasTotalSamples() {
+		if start > info.TotalSamples {
+			start = info.TotalSamples
+		}
+		if count > info.TotalSamples-start {
+			count = info.TotalSamples - start
+		}
+	}
+	if count == 0 {
+		return []byte{}, info, nil
+	}
+
+	s, err := newStreamRange(d, r, base)
+	if err != nil {
+		return nil, StreamInfo{}, err
+	}
+	if err := s.seek(d, start); err != nil {
+		return nil, StreamInfo{}, err
+	}
+	data, err := d.readRange(start, count)
+	if err != nil && s.first < s.end {
+		// The search may have found a false frame header in the audio data.
+		// Decode from the beginning instead.
+		if err = s.reset(d, s.first); err == nil {
+			data, err = d.readRange(start, count)
+		}
+	}
+	if err != nil {
+		return nil, StreamInfo{}, err
+	}
+	return data, info, nil
+}
+
+// readRange decodes frames, returning the interleaved data of count samples
+// beginning at sample start. Frames before start are skipped.
+func (d *Decoder) readRange(start, count int64) ([]byte, error) {
+	var data []byte
+	if d.HasTotalSamples() {
+		// The range is clamped to TotalSamples.
+		data = make([]byte, 0, count*int64(d.NChannels)*int64(bytesPerSample(d.BitsPerSample)))
+	}
+	end := start + count
+	for began := false; ; began = true {
+		chs, err := d.readFrame()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		first := d.frame.FirstSample
+		last := first + int64(d.frame.BlockSize)
+		if !began && first > start {
+			return nil, errors.New("Seeked past sample " + strconv.FormatInt(start, 10))
+		}
+		if last <= start {
+			continue
+		}
+		if first >= end {
+			break
+		}
+		lo, hi := int64(0), int64(d.frame.BlockSize)
+		if first < start {
+			lo = start - first
+		}
+		if last > end {
+			hi = end - first
+		}
+		part := make([][]int32, len(chs))
+		for ch := range chs {
+			part[ch] = chs[ch][lo:hi]
+		}
+		p, err := d.interleave(part)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, p...)
+		if last >= end {
+			break
+		}
+	}
+	return data, nil
+}
+
+// RangeReader returns a reader of the bytes startByte up to endByte of the
+// interleaved audio data of a FLAC stream, as returned by Decode, such as
+// for serving HTTP range requests for the decoded audio.
+// It seeks near the frame containing startByte, and decodes the frames of
+// the range as they are read. The range may begin and end part way through
+// a sample or a frame, and is clamped to the audio data of the stream.
+// The stream must begin at the current offset of r,
+// and r must not be used by others until the range has been read.
+func RangeReader(r io.ReadSeeker, startByte, endByte int64) (io.Reader, error) {
+	base, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	d, err := NewDecoder(r)
+	if err != nil {
+		return nil, err
+	}
+	align := int64(d.NChannels * bytesPerSample(d.BitsPerSample))
+	if startByte < 0 {
+		startByte = 0
+	}
+	if size := d.TotalSamples * align; d.HasTotalSamples() && endByte > size {
+		endByte = size
+	}
+	rr := &rangeReader{d: d, pos: startByte, end: endByte, align: align}
+	if startByte >= endByte {
+		d.Close()
+		rr.err = io.EOF
+		return rr, nil
+	}
+	if rr.s, err = newStreamRange(d, r, base); err != nil {
+		d.Close()
+		return nil, err
+	}
+	if err := rr.s.seek(d, startByte/align); err != nil {
+		d.Close()
+		return nil, err
+	}
+	return rr, nil
+}
+
+// A rangeReader reads a range of the interleaved audio data of a stream.
+type rangeReader struct {
+	d *Decoder
+	s *streamRange
+	// Pos is the offset in the audio data of the next byte to read, and end is the end of the range.
+	pos, end int64
+	// Align is the size in bytes of an inter-channel sample.
+	align int64
+	// Buf holds the decoded data from pos.
+	buf []byte
+	// Began is set once a frame of the range has been decoded.
+	began bool
+	err   error
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.fill()
+		if r.err != nil {
+			r.d.Close()
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	r.pos += int64(n)
+	return n, nil
+}
+
+// fill decodes the next frame of the range into buf.
+func (r *rangeReader) fill() error {
+	if r.pos >= r.end {
+		return io.EOF
+	}
+	chs, err := r.d.readFrame()
+	if err == io.EOF {
+		return io.EOF
+	}
+	first := r.d.frame.FirstSample * r.align
+	if err == nil && !r.began && first > r.pos {
+		err = errors.New("Seeked past sample " + strconv.FormatInt(r.pos/r.align, 10))
+	}
+	if err != nil && !r.began && r.s.first < r.s.end {
+		// The search may have found a false frame header in the audio data.
+		// Decode from the beginning instead.
+		r.began = true
+		return r.s.reset(r.d, r.s.first)
+	} else if err != nil {
+		return err
+	}
+	r.began = true
+	// The final frame may be trimmed to the total samples of the stream.
+	last := first + int64(len(chs[0]))*r.align
+	if last <= r.pos {
+		return nil
+	}
+	data, err := r.d.interleave(chs)
+	if err != nil {
+		return err
+	}
+	if last > r.end {
+		data = data[:r.end-first]
+	}
+	r.buf = data[r.pos-first:]
+	return nil
+}
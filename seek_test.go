@@ -0,0 +1,93 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestReadSamples(t *testing.T) {
+	const n = 100000
+	left, right := testRamp(n, 16, 7), testRamp(n, 16, 3)
+	data, pcm := testPCMStream(44100, 16, 1152, left, right)
+	if len(data) < 4*seekSearchLimit {
+		t.Fatalf("Test stream too small to exercise seeking: %d bytes", len(data))
+	}
+
+	tests := []struct {
+		start, count int64
+		// Want is the expected range of samples after clamping.
+		wantStart, wantEnd int64
+	}{
+		{0, 10, 0, 10},
+		{1151, 2, 1151, 1153},
+		{50000, 1152 * 3, 50000, 50000 + 1152*3},
+		{n - 5, 5, n - 5, n},
+		{n - 5, 100, n - 5, n},
+		{-10, 20, 0, 20},
+		{n + 10, 20, n, n},
+		{12345, 0, 12345, 12345},
+		{0, n, 0, n},
+	}
+	for _, test := range tests {
+		got, info, err := ReadSamples(bytes.NewReader(data), test.start, test.count)
+		if err != nil {
+			t.Errorf("ReadSamples(%d, %d): unexpected error: %v", test.start, test.count, err)
+			continue
+		}
+		if info.TotalSamples != n {
+			t.Errorf("ReadSamples(%d, %d): expected %d total samples, got %d", test.start, test.count, n, info.TotalSamples)
+		}
+		want := pcm[test.wantStart*4 : test.wantEnd*4]
+		if !bytes.Equal(got, want) {
+			t.Errorf("ReadSamples(%d, %d): got %d bytes, want samples %d to %d (%d bytes)",
+				test.start, test.count, len(got), test.wantStart, test.wantEnd, len(want))
+		}
+	}
+}
+
+func TestRangeReader(t *testing.T) {
+	const n = 100000
+	left, right := testRamp(n, 16, 7), testRamp(n, 16, 3)
+	data, pcm := testPCMStream(44100, 16, 1152, left, right)
+	size := int64(len(pcm))
+
+	tests := []struct{ start, end int64 }{
+		{0, size},
+		{0, 1},
+		{1, 3},
+		{4 * 1152, 4*1152 + 4},
+		{4*1152 - 2, 4*1152 + 2},
+		{size / 2, size/2 + 3*4*1152 + 7},
+		{size - 5, size + 100},
+		{-10, 10},
+		{size, size + 10},
+		{500, 400},
+	}
+	for _, test := range tests {
+		r, err := RangeReader(bytes.NewReader(data), test.start, test.end)
+		if err != nil {
+			t.Fatalf("%d–%d: unexpected error: %v", test.start, test.end, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%d–%d: unexpected error reading: %v", test.start, test.end, err)
+		}
+		start, end := test.start, test.end
+		if start < 0 {
+			start = 0
+		}
+		if end > size {
+			end = size
+		}
+		want := []byte{}
+		if start < end {
+			want = pcm[start:end]
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%d–%d: expected %d bytes of audio data, got %d bytes that differ", test.start, test.end, len(want), len(got))
+		}
+	}
+}
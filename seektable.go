@@ -0,0 +1,58 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+// SeekTable is the content of a SEEKTABLE metadata block: its seek points,
+// in stream order.
+type SeekTable []SeekPoint
+
+// SeekPoint is a point of a SeekTable, locating the frame that starts at a sample.
+type SeekPoint struct {
+	// SampleNumber is the number of the first sample of the target frame,
+	// or PlaceholderPoint for a placeholder point.
+	SampleNumber uint64
+	// Offset is the offset in bytes of the target frame from the first frame.
+	Offset uint64
+	// FrameSamples is the number of samples in the target frame.
+	FrameSamples uint16
+}
+
+// PlaceholderPoint is the sample number of a placeholder seek point,
+// which an encoder reserves to fill in later and which locates no frame.
+const PlaceholderPoint = 0xFFFFFFFFFFFFFFFF
+
+// seekPointSize is the size in bytes of a seek point in a SEEKTABLE block.
+const seekPointSize = 8 + 8 + 2
+
+// IsPlaceholder returns whether the seek point is a placeholder point.
+func (p SeekPoint) IsPlaceholder() bool {
+	return p.SampleNumber == PlaceholderPoint
+}
+
+func readSeekTable(r io.Reader) (SeekTable, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%seekPointSize != 0 {
+		return nil, errors.New("Bad SEEKTABLE length (" + strconv.Itoa(len(data)) + ")")
+	}
+	st := make(SeekTable, len(data)/seekPointSize)
+	for i := range st {
+		st[i] = SeekPoint{
+			SampleNumber: binary.BigEndian.Uint64(data),
+			Offset:       binary.BigEndian.Uint64(data[8:]),
+			FrameSamples: binary.BigEndian.Uint16(data[16:]),
+		}
+		data = data[seekPointSize:]
+	}
+	return st, nil
+}
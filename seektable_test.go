@@ -0,0 +1,67 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+// seekTableBody returns the body of a SEEKTABLE block.
+func seekTableBody(st SeekTable) []byte {
+	var b []byte
+	for _, p := range st {
+		pb := make([]byte, seekPointSize)
+		binary.BigEndian.PutUint64(pb, p.SampleNumber)
+		binary.BigEndian.PutUint64(pb[8:], p.Offset)
+		binary.BigEndian.PutUint16(pb[16:], p.FrameSamples)
+		b = append(b, pb...)
+	}
+	return b
+}
+
+func TestSeekTable(t *testing.T) {
+	info := StreamInfo{MinBlock: 16, MaxBlock: 16, SampleRate: 44100, NChannels: 1, BitsPerSample: 16}
+	want := SeekTable{
+		{SampleNumber: 0, Offset: 0, FrameSamples: 16},
+		{SampleNumber: 4096, Offset: 12345, FrameSamples: 16},
+		{SampleNumber: PlaceholderPoint},
+	}
+	data := testStream(info, [][]byte{metaBlock(SeekTableType, true, seekTableBody(want))})
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fmt.Sprint(d.SeekTable) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got %v", want, d.SeekTable)
+	}
+	for i, p := range d.SeekTable {
+		if p.IsPlaceholder() != (i == 2) {
+			t.Errorf("Point %d: expected placeholder %v, got %v", i, i == 2, p.IsPlaceholder())
+		}
+	}
+
+	// An empty table is present but has no points.
+	d, err = NewDecoder(bytes.NewReader(testStream(info, [][]byte{metaBlock(SeekTableType, true, nil)})))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if d.SeekTable == nil || len(d.SeekTable) != 0 {
+		t.Errorf("Expected an empty seek table, got %v", d.SeekTable)
+	}
+
+	d, err = NewDecoder(bytes.NewReader(testStream(info, nil)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if d.SeekTable != nil {
+		t.Errorf("Expected no seek table, got %v", d.SeekTable)
+	}
+
+	bad := testStream(info, [][]byte{metaBlock(SeekTableType, true, make([]byte, 20))})
+	if _, err := NewDecoder(bytes.NewReader(bad)); err == nil || err.Error() != "Bad SEEKTABLE length (20)" {
+		t.Errorf("Expected Bad SEEKTABLE length (20), got %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bufio"
+	"crypto/md5"
+	"errors"
+	"hash"
+	"io"
+)
+
+// A frameLocation is the position of a frame in a stream.
+type frameLocation struct {
+	offset int64
+	size   int
+	// First is the number of the first sample of the frame.
+	first    int64
+	variable bool
+}
+
+// A trackSplit is the part of a stream written as one track by SplitByCueSheet.
+type trackSplit struct {
+	frames  []frameLocation
+	samples int64
+	md5     hash.Hash
+}
+
+// SplitByCueSheet splits a FLAC stream with a CUESHEET block into a standalone
+// FLAC stream for each track, written to the writer returned by out for the
+// track number. The lead-out track is not written.
+//
+// Tracks are cut at frame boundaries: each frame goes to the track containing
+// its first sample, and samples before the first track go to the first track.
+// SplitByCueSheet returns the actual split points, the number of the first
+// sample of each track, which may differ from the cuesheet's track offsets.
+//
+// Each stream has the metadata of the original, except for the CUESHEET and
+// SEEKTABLE blocks, which no longer apply. Its STREAMINFO has the total samples
+// and MD5 checksum of the track and unknown frame sizes, and its frames are renumbered
+// from the start of the track.
+// The stream must begin at the current offset of r.
+func SplitByCueSheet(r io.ReadSeeker, out func(trackNum int) (io.Writer, error)) ([]int64, error) {
+	base, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	d, err := NewDecoder(r, WithRawMetadata(), WithFullFinalFrame())
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	if d.CueSheet == nil {
+		return nil, errors.New("Missing CUESHEET block")
+	}
+	var tracks []CueTrack
+	for _, t := range d.CueSheet.Tracks {
+		if !d.CueSheet.IsLeadOut(t) {
+			tracks = append(tracks, t)
+		}
+	}
+	if len(tracks) == 0 {
+		return nil, errors.New("CUESHEET has no tracks")
+	}
+
+	splits := make([]trackSplit, len(tracks))
+	for i := range splits {
+		splits[i].md5 = md5.New()
+	}
+	off := base + d.HeaderSize()
+	k := 0
+	for {
+		data, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		f := d.currentFrame()
+		for k+1 < len(tracks) && f.FirstSample >= int64(tracks[k+1].Offset) {
+			k++
+		}
+		s := &splits[k]
+		size := len(d.in.buf)
+		s.frames = append(s.frames, frameLocation{offset: off, size: size, first: f.FirstSample, variable: f.VariableBlockSize})
+		s.samples += int64(f.BlockSize)
+		s.md5.Write(data)
+		off += int64(size)
+	}
+
+	points := make([]int64, len(tracks))
+	next := d.Position()
+	for i := len(splits) - 1; i >= 0; i-- {
+		if len(splits[i].frames) > 0 {
+			next = splits[i].frames[0].first
+		}
+		points[i] = next
+	}
+	for i, s := range splits {
+		w, err := out(int(tracks[i].Number))
+		if err != nil {
+			return nil, err
+		}
+		if err := writeTrack(w, r, d.MetaData, s, points[i]); err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+// writeTrack writes the frames of s, read from r, as a stream with the metadata of meta.
+func writeTrack(w io.Writer, r io.ReadSeeker, meta MetaData, s trackSplit, start int64) error {
+	info := *meta.StreamInfo
+	info.TotalSamples = s.samples
+	info.MinFrame, info.MaxFrame = 0, 0
+	copy(info.MD5[:], s.md5.Sum(nil))
+
+	bw := bufio.NewWriter(w)
+	if err := writeHeader(bw, meta.Blocks, info); err != nil {
+		return err
+	}
+
+	if len(s.frames) > 0 {
+		if _, err := r.Seek(s.frames[0].offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	var buf []byte
+	for i, f := range s.frames {
+		if cap(buf) < f.size {
+			buf = make([]byte, f.size)
+		}
+		buf = buf[:f.size]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return err
+		}
+		number := uint64(i)
+		if f.variable {
+			number = uint64(f.first - start)
+		}
+		frame, err := renumberFrame(buf, number)
+		if err != nil {
+			return err
+		}
+		if _, err := bw.Write(frame); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// writeHeader writes the fLaC magic and the raw metadata blocks, with the STREAMINFO
+// replaced by info and without the CUESHEET and SEEKTABLE blocks, which no longer
+// apply to a stream made from the frames of others.
+func writeHeader(w io.Writer, raw []RawBlock, info StreamInfo) error {
+	var blocks []RawBlock
+	for _, b := range raw {
+		if b.Type != CueSheetType && b.Type != SeekTableType {
+			blocks = append(blocks, b)
+		}
+	}
+	return writeMetadata(w, blocks, info)
+}
+
+// writeMetadata writes the fLaC magic and the raw metadata blocks, with the
+// STREAMINFO replaced by info.
+func writeMetadata(w io.Writer, raw []RawBlock, info StreamInfo) error {
+	if _, err := w.Write(magic[:]); err != nil {
+		return err
+	}
+	blocks := make([]RawBlock, len(raw))
+	for i, b := range raw {
+		if b.Type == StreamInfoType {
+			b.Data = encodeStreamInfo(info)
+		}
+		b.Last = i == len(raw)-1
+		blocks[i] = b
+	}
+	for _, b := range blocks {
+		if _, err := w.Write(b.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
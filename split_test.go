@@ -0,0 +1,128 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestSplitByCueSheet(t *testing.T) {
+	const n, blockSize = 4000, 512
+	left, right := testRamp(n, 16, 33), testRamp(n, 16, 71)
+	stream, pcm := testPCMStream(44100, 16, blockSize, left, right)
+	cs := CueSheet{
+		CDDA: true,
+		Tracks: []CueTrack{
+			{Offset: 0, Number: 1, Audio: true, Indices: []CueIndex{{Number: 1}}},
+			{Offset: 1000, Number: 2, Audio: true, Indices: []CueIndex{{Number: 1}}},
+			{Offset: 2500, Number: 3, Audio: true, Indices: []CueIndex{{Number: 1}}},
+			{Offset: n, Number: 170},
+		},
+	}
+	// Insert a VORBIS_COMMENT, CUESHEET, and SEEKTABLE after STREAMINFO.
+	hdrEnd := len(magic) + 4 + 34
+	info := stream[len(magic)+4 : hdrEnd]
+	comment := metaBlock(VorbisCommentType, false, []byte("\x03\x00\x00\x00abc\x00\x00\x00\x00"))
+	blocks := [][]byte{comment, metaBlock(CueSheetType, false, cueSheetBody(cs)), metaBlock(SeekTableType, true, make([]byte, 18))}
+	data := append([]byte{}, magic[:]...)
+	data = append(data, metaBlock(StreamInfoType, false, info)...)
+	for _, b := range blocks {
+		data = append(data, b...)
+	}
+	data = append(data, stream[hdrEnd:]...)
+
+	outs := make(map[int]*bytes.Buffer)
+	points, err := SplitByCueSheet(bytes.NewReader(data), func(track int) (io.Writer, error) {
+		outs[track] = new(bytes.Buffer)
+		return outs[track], nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wantPoints := []int64{0, 1024, 2560}
+	if fmt.Sprint(points) != fmt.Sprint(wantPoints) {
+		t.Errorf("Expected split points %v, got %v", wantPoints, points)
+	}
+	if len(outs) != 3 {
+		t.Fatalf("Expected 3 tracks, got %d", len(outs))
+	}
+	ends := append(wantPoints[1:], n)
+	for i, start := range wantPoints {
+		out := outs[i+1]
+		got, meta, err := Decode(bytes.NewReader(out.Bytes()), WithStrict())
+		if err != nil {
+			t.Errorf("Track %d: unexpected error: %v", i+1, err)
+			continue
+		}
+		if want := pcm[start*4 : ends[i]*4]; !bytes.Equal(got, want) {
+			t.Errorf("Track %d: got %d bytes, want %d", i+1, len(got), len(want))
+		}
+		if meta.TotalSamples != ends[i]-start {
+			t.Errorf("Track %d: expected %d total samples, got %d", i+1, ends[i]-start, meta.TotalSamples)
+		}
+		if meta.CueSheet != nil || meta.VorbisComment == nil || meta.VorbisComment.Vendor != "abc" {
+			t.Errorf("Track %d: unexpected metadata %+v", i+1, meta)
+		}
+	}
+
+	if _, err := SplitByCueSheet(bytes.NewReader(stream), func(int) (io.Writer, error) { return io.Discard, nil }); err == nil {
+		t.Errorf("Expected an error splitting a stream without a CUESHEET")
+	}
+}
+
+func TestSplitByCueSheetNotCDDA(t *testing.T) {
+	const n, blockSize = 2000, 500
+	stream, pcm := testPCMStream(44100, 16, blockSize, testRamp(n, 16, 33))
+	// Track 170 of a cuesheet that is not CD-DA is an ordinary track.
+	cs := CueSheet{
+		Tracks: []CueTrack{
+			{Offset: 0, Number: 1, Audio: true, Indices: []CueIndex{{Number: 1}}},
+			{Offset: 1000, Number: 170, Audio: true, Indices: []CueIndex{{Number: 1}}},
+			{Offset: n, Number: 255},
+		},
+	}
+	hdrEnd := len(magic) + 4 + 34
+	data := append([]byte{}, magic[:]...)
+	data = append(data, metaBlock(StreamInfoType, false, stream[len(magic)+4:hdrEnd])...)
+	data = append(data, metaBlock(CueSheetType, true, cueSheetBody(cs))...)
+	data = append(data, stream[hdrEnd:]...)
+
+	outs := make(map[int]*bytes.Buffer)
+	if _, err := SplitByCueSheet(bytes.NewReader(data), func(track int) (io.Writer, error) {
+		outs[track] = new(bytes.Buffer)
+		return outs[track], nil
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(outs) != 2 || outs[1] == nil || outs[170] == nil {
+		t.Fatalf("Expected tracks 1 and 170, got %d tracks", len(outs))
+	}
+	got, _, err := Decode(bytes.NewReader(outs[170].Bytes()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := pcm[1000*2:]; !bytes.Equal(got, want) {
+		t.Errorf("Track 170: got %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestRenumberFrame(t *testing.T) {
+	samples := testRamp(300, 16, 17)
+	for _, test := range []struct{ from, to uint64 }{{0, 1}, {5, 200000}, {1 << 30, 3}, {127, 128}} {
+		frame := testFrame(testHeader{blockSize: 300, number: test.from, rateCode: 12, rate: 44000}, func(w *bitWriter) {
+			writeVerbatim(w, 16, samples)
+		})
+		want := testFrame(testHeader{blockSize: 300, number: test.to, rateCode: 12, rate: 44000}, func(w *bitWriter) {
+			writeVerbatim(w, 16, samples)
+		})
+		got, err := renumberFrame(frame, test.to)
+		if err != nil {
+			t.Errorf("%d to %d: unexpected error: %v", test.from, test.to, err)
+		} else if !bytes.Equal(got, want) {
+			t.Errorf("%d to %d: expected\n% x\ngot\n% x", test.from, test.to, want, got)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// A RingBuffer is a fixed-size buffer of interleaved audio data filled by
+// Decoder.StartStreaming and drained by a real-time consumer, such as an
+// audio output callback.
+//
+// Reads never wait for data to be decoded: they return what is buffered.
+// They do take a lock that is held while decoded data is copied in,
+// so they can wait for the length of that copy.
+// The decoder blocks while the buffer is full, so decoding stays only as
+// far ahead of playback as the buffer size allows.
+type RingBuffer struct {
+	mu       sync.Mutex
+	notFull  *sync.Cond
+	buf      []byte
+	start, n int
+	// Closed is set once no more data will be written.
+	closed bool
+	// Err is the error that ended decoding, returned after the buffered data.
+	err       error
+	underruns int64
+	overruns  int64
+}
+
+// NewRingBuffer returns a new RingBuffer holding up to size bytes.
+func NewRingBuffer(size int) *RingBuffer {
+	b := &RingBuffer{buf: make([]byte, size)}
+	b.notFull = sync.NewCond(&b.mu)
+	return b
+}
+
+// Read copies up to len(p) bytes of buffered data into p without waiting for more.
+// If less than len(p) bytes are buffered while decoding is still in progress,
+// the read is counted as an underrun and returns what is available, possibly nothing.
+// Once decoding has ended and the buffered data is drained, Read returns io.EOF,
+// or the error that ended decoding.
+func (b *RingBuffer) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.n == 0 && b.closed {
+		if b.err != nil {
+			return 0, b.err
+		}
+		return 0, io.EOF
+	}
+	if b.n < len(p) && !b.closed {
+		b.underruns++
+	}
+	m := 0
+	for m < len(p) && b.n > 0 {
+		end := b.start + b.n
+		if end > len(b.buf) {
+			end = len(b.buf)
+		}
+		c := copy(p[m:], b.buf[b.start:end])
+		m += c
+		b.n -= c
+		b.start = (b.start + c) % len(b.buf)
+	}
+	if m > 0 {
+		b.notFull.Broadcast()
+	}
+	return m, nil
+}
+
+// Buffered returns the number of bytes that can be read without an underrun.
+func (b *RingBuffer) Buffered() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.n
+}
+
+// Underruns returns the number of reads that found less data than requested.
+func (b *RingBuffer) Underruns() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.underruns
+}
+
+// Overruns returns the number of times the decoder found the buffer full
+// and had to wait for it to be read.
+func (b *RingBuffer) Overruns() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.overruns
+}
+
+// write copies p into the buffer, blocking while it is full.
+// It returns false if the buffer was closed before all of p was written.
+func (b *RingBuffer) write(p []byte) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(p) > 0 {
+		if b.closed {
+			return false
+		}
+		if b.n == len(b.buf) {
+			b.overruns++
+			for b.n == len(b.buf) && !b.closed {
+				b.notFull.Wait()
+			}
+			continue
+		}
+		end := (b.start + b.n) % len(b.buf)
+		limit := len(b.buf)
+		if end < b.start {
+			limit = b.start
+		}
+		c := copy(b.buf[end:limit], p)
+		b.n += c
+		p = p[c:]
+	}
+	return true
+}
+
+// close marks the end of the data, with the error that ended decoding, if any.
+func (b *RingBuffer) close(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed, b.err = true, err
+	}
+	b.notFull.Broadcast()
+}
+
+// A streamer is the state of a Decoder streaming to a RingBuffer.
+type streamer struct {
+	ring *RingBuffer
+	// Done is closed when the decoding goroutine returns.
+	done chan struct{}
+}
+
+// StartStreaming starts decoding the remaining frames on a new goroutine,
+// writing their interleaved audio data to ring.
+// The decoder must not be otherwise used until Stop is called.
+// At the end of the stream, or on an error, streaming stops
+// and reads of ring return io.EOF or the error once it is drained.
+func (d *Decoder) StartStreaming(ring *RingBuffer) error {
+	if d.streaming != nil {
+		return errors.New("Already streaming")
+	}
+	if len(ring.buf) == 0 {
+		return errors.New("Ring buffer has no capacity")
+	}
+	s := &streamer{ring: ring, done: make(chan struct{})}
+	d.streaming = s
+	go func() {
+		defer close(s.done)
+		for {
+			data, err := d.Next()
+			if err == io.EOF {
+				ring.close(nil)
+				return
+			} else if err != nil {
+				ring.close(err)
+				return
+			}
+			if !ring.write(data) {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops streaming started by StartStreaming, waiting for the decoding
+// goroutine to return. Data already in the ring buffer can still be read,
+// after which reads return io.EOF.
+// Stop does nothing if the decoder is not streaming.
+func (d *Decoder) Stop() error {
+	s := d.streaming
+	if s == nil {
+		return nil
+	}
+	s.ring.close(nil)
+	<-s.done
+	d.streaming = nil
+	return nil
+}
@@ -0,0 +1,123 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"testing"
+)
+
+func TestStreaming(t *testing.T) {
+	left, right := testRamp(20000, 16, 71), testRamp(20000, 16, 13)
+	data, pcm := testPCMStream(44100, 16, 1152, left, right)
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	ring := NewRingBuffer(1000)
+	if n, err := ring.Read(make([]byte, 10)); n != 0 || err != nil || ring.Underruns() != 1 {
+		t.Errorf("Expected an underrun reading an empty ring, got %d, %v, %d underruns", n, err, ring.Underruns())
+	}
+	if err := d.StartStreaming(ring); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := d.StartStreaming(ring); err == nil {
+		t.Errorf("Expected an error starting to stream twice")
+	}
+
+	var got []byte
+	buf := make([]byte, 333)
+	for {
+		n, err := ring.Read(buf)
+		got = append(got, buf[:n]...)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if n == 0 {
+			runtime.Gosched()
+		}
+	}
+	if !bytes.Equal(got, pcm) {
+		t.Errorf("Streamed %d bytes not matching the %d expected", len(got), len(pcm))
+	}
+	if ring.Overruns() == 0 {
+		t.Errorf("Expected overruns with a ring smaller than a frame")
+	}
+	if err := d.Stop(); err != nil {
+		t.Errorf("Unexpected error stopping: %v", err)
+	}
+}
+
+func TestStreamingStop(t *testing.T) {
+	samples := testRamp(50000, 16, 71)
+	data, pcm := testPCMStream(44100, 16, 1152, samples)
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	ring := NewRingBuffer(4096)
+	if err := d.StartStreaming(ring); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for ring.Buffered() < 100 {
+		runtime.Gosched()
+	}
+	if err := d.Stop(); err != nil {
+		t.Fatalf("Unexpected error stopping: %v", err)
+	}
+	got, err := io.ReadAll(ring)
+	if err != nil {
+		t.Fatalf("Unexpected error draining the ring: %v", err)
+	}
+	if len(got) == 0 || len(got) >= len(pcm) || !bytes.Equal(got, pcm[:len(got)]) {
+		t.Errorf("Expected a prefix of the audio after stopping, got %d of %d bytes", len(got), len(pcm))
+	}
+
+	// Close stops streaming before releasing the buffers it decodes into.
+	d, err = NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	ring = NewRingBuffer(4096)
+	if err := d.StartStreaming(ring); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for ring.Buffered() < 100 {
+		runtime.Gosched()
+	}
+	d.Close()
+	if d.streaming != nil {
+		t.Errorf("Expected Close to stop streaming")
+	}
+}
+
+func TestStreamingError(t *testing.T) {
+	samples := testRamp(5000, 16, 71)
+	data, _ := testPCMStream(44100, 16, 1152, samples)
+	data[len(data)-10] ^= 0xFF
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error making a new decoder: %v", err)
+	}
+	ring := NewRingBuffer(1 << 16)
+	if err := d.StartStreaming(ring); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer d.Stop()
+	for {
+		_, err := ring.Read(make([]byte, 512))
+		if err == io.EOF {
+			t.Fatalf("Expected a checksum error, got io.EOF")
+		} else if err != nil {
+			if err.Error() != "Bad checksum" {
+				t.Errorf("Expected Bad checksum, got %v", err)
+			}
+			break
+		}
+		runtime.Gosched()
+	}
+}
@@ -0,0 +1,83 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// Limits on STREAMINFO values given by the FLAC specification.
+const (
+	minBlockSize  = 16
+	maxBlockSize  = 65535
+	maxSampleRate = 655350
+	minBPS        = 4
+)
+
+// MinBlockSize returns MinBlock, or an error if it is outside of the range
+// allowed by the specification or exceeds MaxBlock.
+func (s *StreamInfo) MinBlockSize() (int, error) {
+	if err := checkBlockSize("Minimum", s.MinBlock); err != nil {
+		return s.MinBlock, err
+	}
+	if s.MinBlock > s.MaxBlock {
+		return s.MinBlock, errors.New("Minimum block size (" + strconv.Itoa(s.MinBlock) +
+			") exceeds maximum block size (" + strconv.Itoa(s.MaxBlock) + ")")
+	}
+	return s.MinBlock, nil
+}
+
+// MaxBlockSize returns MaxBlock, or an error if it is outside of the range
+// allowed by the specification.
+func (s *StreamInfo) MaxBlockSize() (int, error) {
+	return s.MaxBlock, checkBlockSize("Maximum", s.MaxBlock)
+}
+
+func checkBlockSize(which string, n int) error {
+	if n < minBlockSize || n > maxBlockSize {
+		return errors.New(which + " block size (" + strconv.Itoa(n) + ") is outside of " +
+			strconv.Itoa(minBlockSize) + "–" + strconv.Itoa(maxBlockSize))
+	}
+	return nil
+}
+
+// Validate checks the STREAMINFO for values that the specification does not
+// allow or that are inconsistent with each other.
+// The returned error joins the errors of all failing checks.
+func (s *StreamInfo) Validate() error {
+	var errs []error
+	if _, err := s.MinBlockSize(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := s.MaxBlockSize(); err != nil {
+		errs = append(errs, err)
+	}
+	if s.HasFrameSizeInfo() && s.MinFrame > s.MaxFrame {
+		errs = append(errs, errors.New("Minimum frame size ("+strconv.Itoa(s.MinFrame)+
+			") exceeds maximum frame size ("+strconv.Itoa(s.MaxFrame)+")"))
+	}
+	if s.SampleRate == 0 || s.SampleRate > maxSampleRate {
+		errs = append(errs, errors.New("Bad sample rate ("+strconv.Itoa(s.SampleRate)+")"))
+	}
+	if s.NChannels < 1 || s.NChannels > 8 {
+		errs = append(errs, errors.New("Bad number of channels ("+strconv.Itoa(s.NChannels)+")"))
+	}
+	if s.BitsPerSample < minBPS || s.BitsPerSample > 32 {
+		errs = append(errs, errors.New("Bad bits per sample ("+strconv.Itoa(s.BitsPerSample)+")"))
+	}
+	return errors.Join(errs...)
+}
+
+// encodeStreamInfo returns the 34-byte body of a STREAMINFO block describing s.
+func encodeStreamInfo(s StreamInfo) []byte {
+	b := make([]byte, 0, 34)
+	b = binary.BigEndian.AppendUint16(b, uint16(s.MinBlock))
+	b = binary.BigEndian.AppendUint16(b, uint16(s.MaxBlock))
+	b = append(b, byte(s.MinFrame>>16), byte(s.MinFrame>>8), byte(s.MinFrame))
+	b = append(b, byte(s.MaxFrame>>16), byte(s.MaxFrame>>8), byte(s.MaxFrame))
+	v := uint64(s.SampleRate)<<44 | uint64(s.NChannels-1)<<41 | uint64(s.BitsPerSample-1)<<36 | uint64(s.TotalSamples)&(1<<36-1)
+	b = binary.BigEndian.AppendUint64(b, v)
+	return append(b, s.MD5[:]...)
+}
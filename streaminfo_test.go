@@ -0,0 +1,74 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStreamInfoValidate(t *testing.T) {
+	valid := StreamInfo{MinBlock: 4096, MaxBlock: 4096, MinFrame: 14, MaxFrame: 12000, SampleRate: 44100, NChannels: 2, BitsPerSample: 16}
+	tests := []struct {
+		edit func(*StreamInfo)
+		errs []string
+	}{
+		{func(*StreamInfo) {}, nil},
+		{func(s *StreamInfo) { s.MinFrame, s.MaxFrame = 0, 0 }, nil},
+		{func(s *StreamInfo) { s.MinBlock = 8192 }, []string{"Minimum block size (8192) exceeds maximum block size (4096)"}},
+		{func(s *StreamInfo) { s.MinBlock = 15 }, []string{"Minimum block size (15) is outside of 16–65535"}},
+		{func(s *StreamInfo) { s.MaxBlock = 65536 }, []string{"Maximum block size (65536) is outside of 16–65535"}},
+		{func(s *StreamInfo) { s.MinFrame = 20000 }, []string{"Minimum frame size (20000) exceeds maximum frame size (12000)"}},
+		{
+			func(s *StreamInfo) { s.SampleRate, s.BitsPerSample = 0, 3 },
+			[]string{"Bad sample rate (0)", "Bad bits per sample (3)"},
+		},
+	}
+	for _, test := range tests {
+		s := valid
+		test.edit(&s)
+		err := s.Validate()
+		if len(test.errs) == 0 {
+			if err != nil {
+				t.Errorf("%+v: unexpected error: %v", s, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%+v: expected errors %q", s, test.errs)
+			continue
+		}
+		if got := strings.Split(err.Error(), "\n"); strings.Join(got, "|") != strings.Join(test.errs, "|") {
+			t.Errorf("%+v: expected errors %q, got %q", s, test.errs, got)
+		}
+	}
+
+	s := valid
+	s.MinBlock = 8192
+	if n, err := s.MinBlockSize(); n != 8192 || err == nil {
+		t.Errorf("MinBlockSize: expected 8192 and an error, got %d, %v", n, err)
+	}
+	if n, err := s.MaxBlockSize(); n != 4096 || err != nil {
+		t.Errorf("MaxBlockSize: expected 4096 and no error, got %d, %v", n, err)
+	}
+}
+
+func TestStrictStreamInfo(t *testing.T) {
+	info := StreamInfo{MinBlock: 4096, MaxBlock: 1024, SampleRate: 44100, NChannels: 1, BitsPerSample: 16}
+	data := testStream(info, nil)
+	if _, err := NewDecoder(bytes.NewReader(data)); err != nil {
+		t.Errorf("Unexpected error without WithStrict: %v", err)
+	}
+	if _, err := NewDecoder(bytes.NewReader(data), WithStrict()); err == nil {
+		t.Errorf("Expected an error with WithStrict")
+	}
+}
+
+func TestEncodeStreamInfo(t *testing.T) {
+	info := StreamInfo{MinBlock: 4096, MaxBlock: 4608, MinFrame: 14, MaxFrame: 0xABCDEF, SampleRate: 96000, NChannels: 6, BitsPerSample: 24, TotalSamples: 1<<36 - 3}
+	info.MD5[3] = 0x42
+	if got, want := encodeStreamInfo(info), streamInfoBody(info); !bytes.Equal(got, want) {
+		t.Errorf("Expected % x, got % x", want, got)
+	}
+}
@@ -5,6 +5,7 @@ package flac
 import (
 	"errors"
 	"io"
+	"math/bits"
 
 	"github.com/eaburns/bit"
 )
@@ -65,3 +66,29 @@ func utf8Decode(br *bit.Reader) (uint64, error) {
 
 	return v, nil
 }
+
+// utf8Encode returns the UTF-8-like coding of v used for frame and sample numbers.
+func utf8Encode(v uint64) []byte {
+	if v < 0x80 {
+		return []byte{byte(v)}
+	}
+	n := 2
+	for v >= 1<<uint(5*n+1) {
+		n++
+	}
+	b := make([]byte, n)
+	for i := n - 1; i > 0; i-- {
+		b[i] = 0x80 | byte(v&0x3F)
+		v >>= 6
+	}
+	b[0] = byte(0xFF<<uint(8-n)) | byte(v)
+	return b
+}
+
+// utf8Len returns the length of the coded number beginning with the byte b0.
+func utf8Len(b0 byte) int {
+	if b0 < 0x80 {
+		return 1
+	}
+	return bits.LeadingZeros8(^b0)
+}
@@ -0,0 +1,126 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxBlockLength is the largest body of a metadata block, whose length is a 24-bit field.
+const maxBlockLength = 1<<24 - 1
+
+// value returns the value of the first comment whose field name is the first of keys
+// that any comment has, comparing field names case-insensitively.
+// It returns false if no comment has any of the keys, or if vc is nil.
+func (vc *VorbisComment) value(keys ...string) (string, bool) {
+	if vc == nil {
+		return "", false
+	}
+	for _, key := range keys {
+		for _, c := range vc.Comments {
+			name, val, ok := strings.Cut(c, "=")
+			if ok && strings.EqualFold(name, key) {
+				return val, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Lyrics returns the unsynchronized lyrics of the LYRICS comment or, failing that,
+// of the UNSYNCEDLYRICS or UNSYNCED LYRICS comment written by some taggers.
+// Field names are compared case-insensitively.
+// It returns false if there are no lyrics.
+func (vc *VorbisComment) Lyrics() (string, bool) {
+	return vc.value("LYRICS", "UNSYNCEDLYRICS", "UNSYNCED LYRICS")
+}
+
+// musicBrainzKeys are the field names of the MusicBrainz and AcoustID
+// identifiers, as written by MusicBrainz Picard.
+var musicBrainzKeys = []string{
+	"MUSICBRAINZ_TRACKID",
+	"MUSICBRAINZ_RELEASETRACKID",
+	"MUSICBRAINZ_ALBUMID",
+	"MUSICBRAINZ_ARTISTID",
+	"MUSICBRAINZ_ALBUMARTISTID",
+	"MUSICBRAINZ_RELEASEGROUPID",
+	"MUSICBRAINZ_WORKID",
+	"MUSICBRAINZ_DISCID",
+	"ACOUSTID_ID",
+}
+
+// MusicBrainzIDs returns the MusicBrainz and AcoustID identifiers in the comments,
+// such as MUSICBRAINZ_TRACKID and ACOUSTID_ID, keyed by their upper-case field names.
+// Field names are compared case-insensitively, and only the first value of a
+// field given more than once, such as MUSICBRAINZ_ARTISTID, is returned.
+// The map is empty if there are no identifiers.
+func (vc *VorbisComment) MusicBrainzIDs() map[string]string {
+	ids := make(map[string]string)
+	for _, key := range musicBrainzKeys {
+		if v, ok := vc.value(key); ok {
+			ids[key] = v
+		}
+	}
+	return ids
+}
+
+// ValidateComments checks that vc can be written as a VORBIS_COMMENT block
+// that other decoders accept: the vendor string and every comment are valid
+// UTF-8, every comment has a field name and a value separated by '=',
+// every field name is of ASCII characters 0x20 through 0x7D other than '=',
+// and the block fits in the 24-bit length of a metadata block.
+// The error names the index of the first offending comment.
+// A nil vc has no comments, and is valid.
+func ValidateComments(vc *VorbisComment) error {
+	if vc == nil {
+		return nil
+	}
+	if !utf8.ValidString(vc.Vendor) {
+		return errors.New("Vendor string is not valid UTF-8")
+	}
+	for i, c := range vc.Comments {
+		if err := validateComment(c); err != nil {
+			return errors.New("Comment " + strconv.Itoa(i) + ": " + err.Error())
+		}
+	}
+	if n := vc.SerializedSize(); n > maxBlockLength {
+		return errors.New("Comments take " + strconv.Itoa(n) + " bytes, more than the " +
+			strconv.Itoa(maxBlockLength) + " bytes of a metadata block")
+	}
+	return nil
+}
+
+func validateComment(c string) error {
+	if !utf8.ValidString(c) {
+		return errors.New("Not valid UTF-8")
+	}
+	name, _, ok := strings.Cut(c, "=")
+	if !ok {
+		return errors.New("Missing '=' between the field name and value")
+	}
+	if name == "" {
+		return errors.New("Empty field name")
+	}
+	for _, r := range name {
+		if r < 0x20 || r > 0x7D {
+			return errors.New("Bad character " + strconv.QuoteRune(r) + " in field name " + strconv.Quote(name))
+		}
+	}
+	return nil
+}
+
+// SerializedSize returns the size in bytes of the body of the VORBIS_COMMENT
+// block coding vc, without the 4-byte block header: the length and bytes of
+// the vendor string, the number of comments, and the length and bytes of each.
+// An edited block can be written in place if it is no larger than the old
+// block plus any PADDING after it.
+func (vc *VorbisComment) SerializedSize() int {
+	n := 4 + len(vc.Vendor) + 4
+	for _, c := range vc.Comments {
+		n += 4 + len(c)
+	}
+	return n
+}
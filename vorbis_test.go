@@ -0,0 +1,139 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestLyrics(t *testing.T) {
+	tests := []struct {
+		comments []string
+		lyrics   string
+		ok       bool
+	}{
+		{[]string{"TITLE=Song", "LYRICS=la la\nla"}, "la la\nla", true},
+		{[]string{"lyrics=first", "LYRICS=second"}, "first", true},
+		{[]string{"UnsyncedLyrics=hm=hm"}, "hm=hm", true},
+		{[]string{"UNSYNCED LYRICS=oh", "LYRICS=ah"}, "ah", true},
+		{[]string{"LYRICS="}, "", true},
+		{[]string{"TITLE=Song", "LYRICIST=Someone", "LYRICS"}, "", false},
+		{nil, "", false},
+	}
+	for _, test := range tests {
+		vc := &VorbisComment{Comments: test.comments}
+		if lyrics, ok := vc.Lyrics(); lyrics != test.lyrics || ok != test.ok {
+			t.Errorf("%q: expected %q, %v, got %q, %v", test.comments, test.lyrics, test.ok, lyrics, ok)
+		}
+	}
+	var meta MetaData
+	if _, ok := meta.Lyrics(); ok {
+		t.Errorf("Expected no lyrics without a VORBIS_COMMENT block")
+	}
+}
+
+func TestMusicBrainzIDs(t *testing.T) {
+	vc := &VorbisComment{Comments: []string{
+		"TITLE=Song",
+		"musicbrainz_trackid=b1a9c0e9-d987-4042-ae91-78d6a3267d69",
+		"MUSICBRAINZ_ARTISTID=0383dadf-2a4e-4d10-a46a-e9e041da8eb3",
+		"MUSICBRAINZ_ARTISTID=5b11f4ce-a62d-471e-81fc-a69a8278c7da",
+		"AcoustID_ID=e6d1d8fb-6a24-4b5c-8d8d-3f7e0f5a9c1a",
+		"ACOUSTID_FINGERPRINT=AQAAT0mkJEmSJMk",
+	}}
+	want := map[string]string{
+		"MUSICBRAINZ_TRACKID":  "b1a9c0e9-d987-4042-ae91-78d6a3267d69",
+		"MUSICBRAINZ_ARTISTID": "0383dadf-2a4e-4d10-a46a-e9e041da8eb3",
+		"ACOUSTID_ID":          "e6d1d8fb-6a24-4b5c-8d8d-3f7e0f5a9c1a",
+	}
+	got := vc.MusicBrainzIDs()
+	if len(got) != len(want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Expected %s=%s, got %q", k, v, got[k])
+		}
+	}
+
+	var meta MetaData
+	if ids := meta.MusicBrainzIDs(); ids == nil || len(ids) != 0 {
+		t.Errorf("Expected an empty map without a VORBIS_COMMENT block, got %v", ids)
+	}
+}
+
+func TestValidateComments(t *testing.T) {
+	tests := []struct {
+		vc  VorbisComment
+		err string
+	}{
+		{vc: VorbisComment{Vendor: "reference libFLAC 1.4.3", Comments: []string{"TITLE=Ünïcödé", "Replay Gain=-3 dB", "EMPTY="}}},
+		{vc: VorbisComment{}},
+		{vc: VorbisComment{Vendor: "\xff"}, err: "Vendor string is not valid UTF-8"},
+		{vc: VorbisComment{Comments: []string{"TITLE=ok", "ARTIST=\xc3"}}, err: "Comment 1: Not valid UTF-8"},
+		{vc: VorbisComment{Comments: []string{"TITLE"}}, err: "Comment 0: Missing '=' between the field name and value"},
+		{vc: VorbisComment{Comments: []string{"TITLE=ok", "=value"}}, err: "Comment 1: Empty field name"},
+		{vc: VorbisComment{Comments: []string{"A=1", "B=2", "TÍTLE=x"}}, err: `Comment 2: Bad character 'Í' in field name "TÍTLE"`},
+		{vc: VorbisComment{Comments: []string{"TAB\t=x"}}, err: `Comment 0: Bad character '\t' in field name "TAB\t"`},
+		{vc: VorbisComment{Comments: []string{"BRACE}=x", "BRACE~=x"}}, err: `Comment 1: Bad character '~' in field name "BRACE~"`},
+	}
+	for _, test := range tests {
+		err := ValidateComments(&test.vc)
+		if test.err == "" && err != nil {
+			t.Errorf("%q: unexpected error: %v", test.vc.Comments, err)
+		} else if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("%q: expected error %q, got %v", test.vc.Comments, test.err, err)
+		}
+	}
+
+	if err := ValidateComments(nil); err != nil {
+		t.Errorf("Unexpected error for nil comments: %v", err)
+	}
+
+	big := VorbisComment{Comments: []string{"DATA=" + strings.Repeat("x", maxBlockLength)}}
+	if err := ValidateComments(&big); err == nil {
+		t.Errorf("Expected an error for comments larger than a metadata block")
+	}
+}
+
+// vorbisCommentBody returns the body of a VORBIS_COMMENT block.
+func vorbisCommentBody(vc VorbisComment) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, uint32(len(vc.Vendor)))
+	b = append(b, vc.Vendor...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(vc.Comments)))
+	for _, c := range vc.Comments {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(c)))
+		b = append(b, c...)
+	}
+	return b
+}
+
+func TestSerializedSize(t *testing.T) {
+	// SerializedSize is checked against the VORBIS_COMMENT blocks as read.
+	bodies := []string{
+		"\x00\x00\x00\x00\x00\x00\x00\x00",
+		"\x17\x00\x00\x00reference libFLAC 1.4.3\x00\x00\x00\x00",
+		"\x01\x00\x00\x00x\x03\x00\x00\x00\x0b\x00\x00\x00TITLE=Ünï\x06\x00\x00\x00EMPTY=\x00\x00\x00\x00",
+	}
+	info := StreamInfo{MinBlock: 16, MaxBlock: 16, SampleRate: 44100, NChannels: 1, BitsPerSample: 16}
+	for _, body := range bodies {
+		data := testStream(info, [][]byte{metaBlock(VorbisCommentType, true, []byte(body))})
+		d, err := NewDecoder(bytes.NewReader(data), WithRawMetadata())
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", body, err)
+		}
+		raw := d.Blocks[1]
+		if raw.Type != VorbisCommentType {
+			t.Fatalf("Expected a VORBIS_COMMENT block, got %v", raw.Type)
+		}
+		if n := d.VorbisComment.SerializedSize(); n != len(raw.Data) {
+			t.Errorf("%q: expected %d bytes, got %d", body, len(raw.Data), n)
+		}
+		if !bytes.Equal(vorbisCommentBody(*d.VorbisComment), raw.Data) {
+			t.Errorf("%q: re-encoded block does not match", body)
+		}
+	}
+}
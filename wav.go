@@ -0,0 +1,385 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// WAVE speaker position bits, used in the channel mask of WAVE_FORMAT_EXTENSIBLE.
+const (
+	speakerFrontLeft    = 0x1
+	speakerFrontRight   = 0x2
+	speakerFrontCenter  = 0x4
+	speakerLowFrequency = 0x8
+	speakerBackLeft     = 0x10
+	speakerBackRight    = 0x20
+	speakerBackCenter   = 0x100
+	speakerSideLeft     = 0x200
+	speakerSideRight    = 0x400
+)
+
+const (
+	wavFormatPCM         = 0x1
+	wavFormatExtensible  = 0xFFFE
+	wavPCMFmtSize        = 16
+	wavExtensibleFmtSize = 40
+)
+
+// wavSpeakers maps a FLAC channel count to the WAVE speaker position of
+// each channel, in FLAC channel order. The surround channels of the 5.0 and
+// 5.1 layouts are side speakers, as written by the reference flac tool.
+var wavSpeakers = [...][]uint32{
+	1: {speakerFrontCenter},
+	2: {speakerFrontLeft, speakerFrontRight},
+	3: {speakerFrontLeft, speakerFrontRight, speakerFrontCenter},
+	4: {speakerFrontLeft, speakerFrontRight, speakerBackLeft, speakerBackRight},
+	5: {speakerFrontLeft, speakerFrontRight, speakerFrontCenter, speakerSideLeft, speakerSideRight},
+	6: {speakerFrontLeft, speakerFrontRight, speakerFrontCenter, speakerLowFrequency, speakerSideLeft, speakerSideRight},
+	7: {speakerFrontLeft, speakerFrontRight, speakerFrontCenter, speakerLowFrequency, speakerBackCenter, speakerSideLeft, speakerSideRight},
+	8: {speakerFrontLeft, speakerFrontRight, speakerFrontCenter, speakerLowFrequency, speakerBackLeft, speakerBackRight, speakerSideLeft, speakerSideRight},
+}
+
+// wavChannelMask returns the WAVE_FORMAT_EXTENSIBLE channel mask for the
+// default FLAC channel layout with the given number of channels.
+func wavChannelMask(nChannels int) uint32 {
+	if nChannels <= 0 || nChannels >= len(wavSpeakers) {
+		return 0
+	}
+	var mask uint32
+	for _, s := range wavSpeakers[nChannels] {
+		mask |= s
+	}
+	return mask
+}
+
+// A WAVOption configures the WAVE file written by WriteWAV.
+type WAVOption func(*wavOptions)
+
+type wavOptions struct {
+	bext bool
+}
+
+// WithBroadcastExtension writes a Broadcast Wave Format bext chunk, as defined by
+// EBU Tech 3285, populated from the Vorbis comments of the metadata:
+//
+//	Description          DESCRIPTION, or else COMMENT
+//	Originator           ORIGINATOR, or else ORGANIZATION
+//	OriginatorReference  ORIGINATORREFERENCE
+//	OriginationDate      ORIGINATIONDATE, or else the date of a DATE of the form yyyy-mm-dd
+//	OriginationTime      ORIGINATIONTIME, or else the time of a DATE of the form yyyy-mm-ddThh:mm:ss
+//	TimeReference        TIME_REFERENCE, in samples
+//	CodingHistory        CODINGHISTORY or CODING_HISTORY
+//
+// Fields without a comment are left empty, and values too long for their field are truncated.
+func WithBroadcastExtension() WAVOption {
+	return func(o *wavOptions) { o.bext = true }
+}
+
+// Sizes of the fields of a bext chunk preceding the coding history.
+const (
+	bextDescriptionSize = 256
+	bextOriginatorSize  = 32
+	bextReferenceSize   = 32
+	bextDateSize        = 10
+	bextTimeSize        = 8
+	bextUMIDSize        = 64
+	bextLoudnessSize    = 10
+	bextReservedSize    = 180
+	bextFixedSize       = bextDescriptionSize + bextOriginatorSize + bextReferenceSize + bextDateSize + bextTimeSize +
+		8 + 2 + bextUMIDSize + bextLoudnessSize + bextReservedSize
+)
+
+// bextChunk returns the body of a bext chunk, without its chunk header or pad byte,
+// populated from the Vorbis comments of vc, which may be nil.
+func bextChunk(vc *VorbisComment) []byte {
+	field := func(b []byte, size int, keys ...string) []byte {
+		v, _ := vc.value(keys...)
+		if len(v) > size {
+			v = v[:size]
+		}
+		b = append(b, v...)
+		return append(b, make([]byte, size-len(v))...)
+	}
+	date, _ := vc.value("DATE")
+	var day, clock string
+	if len(date) >= 10 && date[4] == '-' && date[7] == '-' {
+		day = date[:10]
+		if len(date) >= 19 && date[10] == 'T' && date[13] == ':' && date[16] == ':' {
+			clock = date[11:19]
+		}
+	}
+	var ref uint64
+	if v, ok := vc.value("TIME_REFERENCE"); ok {
+		ref, _ = strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+	}
+	history, _ := vc.value("CODINGHISTORY", "CODING_HISTORY")
+	if history != "" && !strings.HasSuffix(history, "\r\n") {
+		history += "\r\n"
+	}
+
+	b := make([]byte, 0, bextFixedSize+len(history))
+	b = field(b, bextDescriptionSize, "DESCRIPTION", "COMMENT")
+	b = field(b, bextOriginatorSize, "ORIGINATOR", "ORGANIZATION")
+	b = field(b, bextReferenceSize, "ORIGINATORREFERENCE")
+	if _, ok := vc.value("ORIGINATIONDATE"); ok {
+		b = field(b, bextDateSize, "ORIGINATIONDATE")
+	} else {
+		b = append(b, day...)
+		b = append(b, make([]byte, bextDateSize-len(day))...)
+	}
+	if _, ok := vc.value("ORIGINATIONTIME"); ok {
+		b = field(b, bextTimeSize, "ORIGINATIONTIME")
+	} else {
+		b = append(b, clock...)
+		b = append(b, make([]byte, bextTimeSize-len(clock))...)
+	}
+	b = binary.LittleEndian.AppendUint64(b, ref) // TimeReferenceLow and TimeReferenceHigh.
+	b = binary.LittleEndian.AppendUint16(b, 1)   // Version.
+	b = append(b, make([]byte, bextUMIDSize+bextLoudnessSize+bextReservedSize)...)
+	return append(b, history...)
+}
+
+// WriteWAV writes the interleaved audio data returned by Decode as a WAVE file.
+// Streams with more than two channels, more than 16 bits per sample, or a bit
+// depth that is not a multiple of 8 are written using WAVE_FORMAT_EXTENSIBLE,
+// with a channel mask derived from the FLAC channel layout.
+// Samples of a bit depth such as 12 or 20 bits are left-justified in their
+// 2- or 3-byte containers, as WAVE requires.
+func WriteWAV(w io.Writer, data []byte, meta MetaData, opts ...WAVOption) error {
+	var o wavOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if meta.StreamInfo == nil {
+		return errors.New("Missing STREAMINFO header")
+	}
+	if meta.NChannels < 1 || meta.NChannels >= len(wavSpeakers) {
+		return errors.New("Unsupported number of channels (" + strconv.Itoa(meta.NChannels) + ")")
+	}
+	width := bytesPerSample(meta.BitsPerSample)
+	blockAlign := meta.NChannels * width
+
+	fmtSize := wavPCMFmtSize
+	extensible := meta.NChannels > 2 || meta.BitsPerSample > 16 || meta.BitsPerSample%8 != 0
+	if extensible {
+		fmtSize = wavExtensibleFmtSize
+	}
+	var bext []byte
+	if o.bext {
+		bext = bextChunk(meta.VorbisComment)
+	}
+	bextSize := 0
+	if bext != nil {
+		bextSize = 8 + len(bext) + len(bext)%2
+	}
+	pad := len(data) % 2
+	riffSize := 4 + bextSize + (8 + fmtSize) + (8 + len(data) + pad)
+
+	hdr := make([]byte, 0, 12+bextSize+8+fmtSize+8)
+	hdr = append(hdr, "RIFF"...)
+	hdr = binary.LittleEndian.AppendUint32(hdr, uint32(riffSize))
+	hdr = append(hdr, "WAVE"...)
+
+	if bext != nil {
+		hdr = append(hdr, "bext"...)
+		hdr = binary.LittleEndian.AppendUint32(hdr, uint32(len(bext)))
+		hdr = append(hdr, bext...)
+		if len(bext)%2 != 0 {
+			hdr = append(hdr, 0)
+		}
+	}
+
+	hdr = append(hdr, "fmt "...)
+	hdr = binary.LittleEndian.AppendUint32(hdr, uint32(fmtSize))
+	if extensible {
+		hdr = binary.LittleEndian.AppendUint16(hdr, wavFormatExtensible)
+	} else {
+		hdr = binary.LittleEndian.AppendUint16(hdr, wavFormatPCM)
+	}
+	hdr = binary.LittleEndian.AppendUint16(hdr, uint16(meta.NChannels))
+	hdr = binary.LittleEndian.AppendUint32(hdr, uint32(meta.SampleRate))
+	hdr = binary.LittleEndian.AppendUint32(hdr, uint32(meta.SampleRate*blockAlign))
+	hdr = binary.LittleEndian.AppendUint16(hdr, uint16(blockAlign))
+	hdr = binary.LittleEndian.AppendUint16(hdr, uint16(width*8))
+	if extensible {
+		hdr = binary.LittleEndian.AppendUint16(hdr, 22) // Size of the extension.
+		hdr = binary.LittleEndian.AppendUint16(hdr, uint16(meta.BitsPerSample))
+		hdr = binary.LittleEndian.AppendUint32(hdr, wavChannelMask(meta.NChannels))
+		hdr = append(hdr, wavSubFormatPCM[:]...)
+	}
+
+	hdr = append(hdr, "data"...)
+	hdr = binary.LittleEndian.AppendUint32(hdr, uint32(len(data)))
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(wavData(data, meta.BitsPerSample)); err != nil {
+		return err
+	}
+	if pad != 0 {
+		if _, err := w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wavData returns the interleaved data returned by Decode as WAVE stores it:
+// samples of a bit depth that is not a multiple of 8 are left-justified in their
+// containers, and 8-bit samples are unsigned.
+func wavData(data []byte, bps int) []byte {
+	width := bytesPerSample(bps)
+	shift := uint(width*8 - bps)
+	if width > 1 && shift == 0 {
+		return data
+	}
+	out := make([]byte, len(data))
+	for i := 0; i+width <= len(data); i += width {
+		var v uint32
+		for j := width - 1; j >= 0; j-- {
+			v = v<<8 | uint32(data[i+j])
+		}
+		v <<= shift
+		if width == 1 {
+			v ^= 0x80
+		}
+		for j := 0; j < width; j++ {
+			out[i+j] = byte(v >> (8 * j))
+		}
+	}
+	return out
+}
+
+// wavSubFormatPCM is the KSDATAFORMAT_SUBTYPE_PCM GUID.
+var wavSubFormatPCM = [16]byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71}
+
+// A wavFormat is the format of the audio data of a WAVE file.
+type wavFormat struct {
+	sampleRate    int
+	nChannels     int
+	bitsPerSample int
+	blockAlign    int
+}
+
+// readWAVHeader reads a WAVE file up to the start of its audio data,
+// returning the format of the data and its size in bytes.
+func readWAVHeader(r io.Reader) (wavFormat, int64, error) {
+	var hdr [12]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return wavFormat{}, 0, fmt.Errorf("Failed to read the WAVE header: %w", err)
+	}
+	if string(hdr[:4]) != "RIFF" || string(hdr[8:]) != "WAVE" {
+		return wavFormat{}, 0, errors.New("Bad RIFF WAVE header")
+	}
+	var f wavFormat
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return wavFormat{}, 0, fmt.Errorf("Failed to read the WAVE data chunk: %w", err)
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+		switch string(chunk[:4]) {
+		case "fmt ":
+			if size < wavPCMFmtSize {
+				return wavFormat{}, 0, errors.New("Bad WAVE fmt chunk size (" + strconv.FormatInt(size, 10) + ")")
+			}
+			b := make([]byte, size+size%2)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return wavFormat{}, 0, fmt.Errorf("Failed to read the WAVE fmt chunk: %w", err)
+			}
+			f = wavFormat{
+				nChannels:     int(binary.LittleEndian.Uint16(b[2:])),
+				sampleRate:    int(binary.LittleEndian.Uint32(b[4:])),
+				blockAlign:    int(binary.LittleEndian.Uint16(b[12:])),
+				bitsPerSample: int(binary.LittleEndian.Uint16(b[14:])),
+			}
+			switch tag := binary.LittleEndian.Uint16(b); {
+			case tag == wavFormatExtensible && size >= wavExtensibleFmtSize && [16]byte(b[24:40]) == wavSubFormatPCM:
+				f.bitsPerSample = int(binary.LittleEndian.Uint16(b[18:]))
+			case tag != wavFormatPCM:
+				return wavFormat{}, 0, errors.New("Unsupported WAVE format (" + strconv.Itoa(int(tag)) + "), only PCM is supported")
+			}
+
+		case "data":
+			if f.nChannels == 0 {
+				return wavFormat{}, 0, errors.New("Missing WAVE fmt chunk")
+			}
+			return f, size, nil
+
+		default:
+			if _, err := io.CopyN(ioutil.Discard, r, size+size%2); err != nil {
+				return wavFormat{}, 0, fmt.Errorf("Failed to skip WAVE chunk: %w", err)
+			}
+		}
+	}
+}
+
+// CompareToWAV decodes a FLAC stream and compares its audio with the audio
+// data of a WAVE file, such as one written by flac -d, sample for sample.
+// It returns whether they match and, if they do not, the number of the first
+// inter-channel sample that differs or that only one of them has.
+// If they match, the returned sample number is -1.
+// It is an error for the sample rate, number of channels, or bits per sample
+// of the WAVE file to differ from those of the FLAC stream.
+func CompareToWAV(flac io.Reader, wav io.Reader) (bool, int64, error) {
+	d, err := NewDecoder(flac)
+	if err != nil {
+		return false, 0, err
+	}
+	defer d.Close()
+	f, size, err := readWAVHeader(wav)
+	if err != nil {
+		return false, 0, err
+	}
+	blockAlign := d.NChannels * bytesPerSample(d.BitsPerSample)
+	if f.sampleRate != d.SampleRate || f.nChannels != d.NChannels || f.bitsPerSample != d.BitsPerSample || f.blockAlign != blockAlign {
+		return false, 0, errors.New("WAVE format (" + strconv.Itoa(f.sampleRate) + " Hz, " + strconv.Itoa(f.nChannels) + " channels, " +
+			strconv.Itoa(f.bitsPerSample) + " bits) does not match the FLAC stream (" + strconv.Itoa(d.SampleRate) + " Hz, " +
+			strconv.Itoa(d.NChannels) + " channels, " + strconv.Itoa(d.BitsPerSample) + " bits)")
+	}
+
+	pcm := bufio.NewReader(io.LimitReader(wav, size))
+	var buf []byte
+	var pos int64
+	for {
+		frame, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return false, 0, err
+		}
+		if cap(buf) < len(frame) {
+			buf = make([]byte, len(frame))
+		}
+		buf = buf[:len(frame)]
+		n, err := io.ReadFull(pcm, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return false, 0, err
+		}
+		frame = wavData(frame, d.BitsPerSample)
+		for i, b := range buf[:n] {
+			if b != frame[i] {
+				return false, pos + int64(i/blockAlign), nil
+			}
+		}
+		if n < len(frame) {
+			return false, pos + int64(n/blockAlign), nil
+		}
+		pos += int64(len(frame) / blockAlign)
+	}
+	if _, err := pcm.ReadByte(); err == nil {
+		return false, pos, nil
+	} else if err != io.EOF {
+		return false, 0, err
+	}
+	return true, -1, nil
+}
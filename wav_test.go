@@ -0,0 +1,209 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestWAVChannelMask(t *testing.T) {
+	masks := []uint32{
+		1: 0x4,
+		2: 0x3,
+		3: 0x7,
+		4: 0x33,
+		5: 0x607,
+		6: 0x60F,
+		7: 0x70F,
+		8: 0x63F,
+	}
+	for n := 1; n <= 8; n++ {
+		if m := wavChannelMask(n); m != masks[n] {
+			t.Errorf("Expected %d channels to have mask %#x, got %#x", n, masks[n], m)
+		}
+		if len(wavSpeakers[n]) != n {
+			t.Errorf("Expected %d speakers for %d channels, got %d", n, n, len(wavSpeakers[n]))
+		}
+
+		info := &StreamInfo{SampleRate: 48000, NChannels: n, BitsPerSample: 24}
+		data := make([]byte, 3*n*10)
+		var buf bytes.Buffer
+		if err := WriteWAV(&buf, data, MetaData{StreamInfo: info}); err != nil {
+			t.Fatalf("Unexpected error writing %d channels: %v", n, err)
+		}
+		wav := buf.Bytes()
+		if tag := binary.LittleEndian.Uint16(wav[20:]); tag != wavFormatExtensible {
+			t.Errorf("Expected format %#x, got %#x", wavFormatExtensible, tag)
+		}
+		if m := binary.LittleEndian.Uint32(wav[40:]); m != masks[n] {
+			t.Errorf("Expected %d channels to write mask %#x, got %#x", n, masks[n], m)
+		}
+		if sz := binary.LittleEndian.Uint32(wav[4:]); int(sz) != len(wav)-8 {
+			t.Errorf("Expected RIFF size %d, got %d", len(wav)-8, sz)
+		}
+	}
+}
+
+func TestWriteWAV(t *testing.T) {
+	info := &StreamInfo{SampleRate: 8000, NChannels: 1, BitsPerSample: 8}
+	var buf bytes.Buffer
+	if err := WriteWAV(&buf, []byte{0x80, 0xFF, 0x00}, MetaData{StreamInfo: info}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []byte{
+		'R', 'I', 'F', 'F', 40, 0, 0, 0, 'W', 'A', 'V', 'E',
+		'f', 'm', 't', ' ', 16, 0, 0, 0,
+		1, 0, // PCM
+		1, 0, // 1 channel
+		0x40, 0x1F, 0, 0, // 8000 Hz
+		0x40, 0x1F, 0, 0, // 8000 bytes per second
+		1, 0, // block align
+		8, 0, // bits per sample
+		'd', 'a', 't', 'a', 3, 0, 0, 0,
+		0x00, 0x7F, 0x80, // unsigned samples
+		0, // pad byte
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("Expected\n%v\ngot\n%v", want, buf.Bytes())
+	}
+}
+
+func TestWAVData(t *testing.T) {
+	tests := []struct {
+		bps       int
+		data, wav []byte
+	}{
+		{8, []byte{0x80, 0xFF, 0x00, 0x7F}, []byte{0x00, 0x7F, 0x80, 0xFF}},
+		{12, []byte{0x00, 0xF8, 0xFF, 0x07, 0xFF, 0xFF}, []byte{0x00, 0x80, 0xF0, 0x7F, 0xF0, 0xFF}},
+		{16, []byte{0x00, 0x80, 0xFF, 0x7F}, []byte{0x00, 0x80, 0xFF, 0x7F}},
+		{20, []byte{0x00, 0x00, 0xF8, 0xFF, 0xFF, 0x07}, []byte{0x00, 0x00, 0x80, 0xF0, 0xFF, 0x7F}},
+	}
+	for _, test := range tests {
+		if got := wavData(test.data, test.bps); !bytes.Equal(got, test.wav) {
+			t.Errorf("%d bits: expected % x, got % x", test.bps, test.wav, got)
+		}
+	}
+}
+
+func TestCompareToWAV(t *testing.T) {
+	tests := []struct {
+		bps   int
+		chans [][]int32
+	}{
+		{8, [][]int32{testRamp(100, 8, 3)}},
+		{12, [][]int32{testRamp(150, 12, 29), testRamp(150, 12, 3)}},
+		{20, [][]int32{testRamp(120, 20, 40961)}},
+		{16, [][]int32{testRamp(300, 16, 37), testRamp(300, 16, 91)}},
+		{24, [][]int32{testRamp(200, 24, 4099), testRamp(200, 24, 77), testRamp(200, 24, 1)}},
+	}
+	for _, test := range tests {
+		stream, pcm := testPCMStream(44100, test.bps, 64, test.chans...)
+		info := &StreamInfo{SampleRate: 44100, NChannels: len(test.chans), BitsPerSample: test.bps}
+		blockAlign := len(test.chans) * bytesPerSample(test.bps)
+		wav := func(data []byte) *bytes.Reader {
+			var buf bytes.Buffer
+			if err := WriteWAV(&buf, data, MetaData{StreamInfo: info}); err != nil {
+				t.Fatalf("Unexpected error writing WAVE: %v", err)
+			}
+			return bytes.NewReader(buf.Bytes())
+		}
+
+		if ok, n, err := CompareToWAV(bytes.NewReader(stream), wav(pcm)); err != nil || !ok || n != -1 {
+			t.Errorf("%d bits: expected a match, got %v, %d, %v", test.bps, ok, n, err)
+		}
+
+		changed := append([]byte{}, pcm...)
+		changed[77*blockAlign+blockAlign-1]++
+		if ok, n, err := CompareToWAV(bytes.NewReader(stream), wav(changed)); err != nil || ok || n != 77 {
+			t.Errorf("%d bits: expected a difference at sample 77, got %v, %d, %v", test.bps, ok, n, err)
+		}
+
+		short := pcm[:len(pcm)-blockAlign]
+		if ok, n, err := CompareToWAV(bytes.NewReader(stream), wav(short)); err != nil || ok || n != int64(len(test.chans[0])-1) {
+			t.Errorf("%d bits: expected a short WAVE to differ at sample %d, got %v, %d, %v", test.bps, len(test.chans[0])-1, ok, n, err)
+		}
+
+		long := append(append([]byte{}, pcm...), make([]byte, blockAlign)...)
+		if ok, n, err := CompareToWAV(bytes.NewReader(stream), wav(long)); err != nil || ok || n != int64(len(test.chans[0])) {
+			t.Errorf("%d bits: expected a long WAVE to differ at sample %d, got %v, %d, %v", test.bps, len(test.chans[0]), ok, n, err)
+		}
+	}
+
+	stream, pcm := testPCMStream(44100, 16, 64, testRamp(100, 16, 3))
+	var buf bytes.Buffer
+	info := &StreamInfo{SampleRate: 48000, NChannels: 1, BitsPerSample: 16}
+	if err := WriteWAV(&buf, pcm, MetaData{StreamInfo: info}); err != nil {
+		t.Fatalf("Unexpected error writing WAVE: %v", err)
+	}
+	if _, _, err := CompareToWAV(bytes.NewReader(stream), &buf); err == nil {
+		t.Errorf("Expected an error comparing streams of different sample rates")
+	}
+}
+
+func TestWriteWAVBroadcastExtension(t *testing.T) {
+	stream, pcm := testPCMStream(48000, 16, 64, testRamp(101, 16, 3))
+	vc := &VorbisComment{Comments: []string{
+		"COMMENT=Interview, take 2",
+		"organization=Radio X",
+		"DATE=2024-03-05T14:30:15",
+		"TIME_REFERENCE=172800000",
+		"CODINGHISTORY=A=PCM,F=48000,W=16,M=mono",
+	}}
+	info := &StreamInfo{SampleRate: 48000, NChannels: 1, BitsPerSample: 16}
+	var buf bytes.Buffer
+	if err := WriteWAV(&buf, pcm, MetaData{StreamInfo: info, VorbisComment: vc}, WithBroadcastExtension()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wav := buf.Bytes()
+	if sz := binary.LittleEndian.Uint32(wav[4:]); int(sz) != len(wav)-8 {
+		t.Errorf("Expected RIFF size %d, got %d", len(wav)-8, sz)
+	}
+	if string(wav[12:16]) != "bext" {
+		t.Fatalf("Expected a bext chunk, got %q", wav[12:16])
+	}
+	history := "A=PCM,F=48000,W=16,M=mono\r\n"
+	size := int(binary.LittleEndian.Uint32(wav[16:]))
+	if size != bextFixedSize+len(history) || bextFixedSize != 602 {
+		t.Errorf("Expected a bext chunk of %d bytes, got %d", 602+len(history), size)
+	}
+	bext := wav[20 : 20+size]
+	fields := []struct {
+		off, size int
+		want      string
+	}{
+		{0, 256, "Interview, take 2"},
+		{256, 32, "Radio X"},
+		{288, 32, ""},
+		{320, 10, "2024-03-05"},
+		{330, 8, "14:30:15"},
+		{602, len(history), history},
+	}
+	for _, f := range fields {
+		if got := string(bytes.TrimRight(bext[f.off:f.off+f.size], "\x00")); got != f.want {
+			t.Errorf("Field at %d: expected %q, got %q", f.off, f.want, got)
+		}
+	}
+	if ref := binary.LittleEndian.Uint64(bext[338:]); ref != 172800000 {
+		t.Errorf("Expected time reference 172800000, got %d", ref)
+	}
+	if v := binary.LittleEndian.Uint16(bext[346:]); v != 1 {
+		t.Errorf("Expected version 1, got %d", v)
+	}
+	next := 20 + size + size%2
+	if string(wav[next:next+4]) != "fmt " {
+		t.Errorf("Expected the fmt chunk at offset %d, got %q", next, wav[next:next+4])
+	}
+	if ok, n, err := CompareToWAV(bytes.NewReader(stream), bytes.NewReader(wav)); err != nil || !ok {
+		t.Errorf("Expected the audio to match, got %v, %d, %v", ok, n, err)
+	}
+
+	buf.Reset()
+	if err := WriteWAV(&buf, pcm, MetaData{StreamInfo: info}, WithBroadcastExtension()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if size := binary.LittleEndian.Uint32(buf.Bytes()[16:]); size != bextFixedSize {
+		t.Errorf("Expected an empty bext chunk of %d bytes, got %d", bextFixedSize, size)
+	}
+}
@@ -0,0 +1,98 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"errors"
+	"io"
+	"strconv"
+)
+
+// A WindowReader reads the samples of a stream in windows of a fixed size,
+// independent of the block size of its frames, such as for spectral analysis.
+type WindowReader struct {
+	d         *Decoder
+	size, hop int
+	// Buf holds the decoded samples of each channel from the start of the next window.
+	buf [][]int32
+	// Skip is the number of samples to drop before the next window starts.
+	skip int
+	// Seen is the number of samples at the start of buf that were in the previous window.
+	seen   int
+	eof    bool
+	err    error
+	window [][]int32
+}
+
+// WindowedReader returns a WindowReader over the remaining samples of the stream.
+// Each window holds windowSize samples of every channel, and each starts hop
+// samples after the previous one, so windows overlap if hop is less than
+// windowSize and leave gaps if it is greater.
+func (d *Decoder) WindowedReader(windowSize, hop int) *WindowReader {
+	w := &WindowReader{d: d, size: windowSize, hop: hop}
+	if windowSize <= 0 {
+		w.err = errors.New("Bad window size (" + strconv.Itoa(windowSize) + ")")
+	} else if hop <= 0 {
+		w.err = errors.New("Bad window hop (" + strconv.Itoa(hop) + ")")
+	}
+	return w
+}
+
+// Next returns the samples of the next window for each channel.
+// The returned slices are overwritten by the next call.
+//
+// If the stream ends inside a window that holds samples not in any earlier
+// window, that last window is returned with fewer than windowSize samples,
+// and it is up to the caller to pad it. After the last window,
+// Next returns io.EOF.
+func (w *WindowReader) Next() ([][]int32, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	for !w.eof && (w.buf == nil || len(w.buf[0]) < w.skip+w.size) {
+		chans, err := w.d.readFrame()
+		if err == io.EOF {
+			w.eof = true
+			break
+		} else if err != nil {
+			w.err = err
+			return nil, err
+		}
+		if w.buf == nil {
+			w.buf = make([][]int32, len(chans))
+			w.window = make([][]int32, len(chans))
+		}
+		for ch := range chans {
+			w.buf[ch] = append(w.buf[ch], chans[ch]...)
+		}
+	}
+	if w.buf == nil {
+		w.err = io.EOF
+		return nil, w.err
+	}
+
+	drop := w.skip
+	if drop > len(w.buf[0]) {
+		drop = len(w.buf[0])
+	}
+	for ch := range w.buf {
+		w.buf[ch] = append(w.buf[ch][:0], w.buf[ch][drop:]...)
+	}
+	w.skip -= drop
+	w.seen -= drop
+	n := w.size
+	if n > len(w.buf[0]) {
+		n = len(w.buf[0])
+	}
+	if w.skip > 0 || n <= w.seen {
+		// The stream ended before any sample that was not in the previous window.
+		w.err = io.EOF
+		return nil, w.err
+	}
+
+	for ch := range w.buf {
+		w.window[ch] = append(w.window[ch][:0], w.buf[ch][:n]...)
+	}
+	w.skip, w.seen = w.hop, n
+	return w.window, nil
+}
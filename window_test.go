@@ -0,0 +1,78 @@
+// © 2014 the flac Authors under the MIT license. See AUTHORS for the list of authors.
+
+package flac
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestWindowedReader(t *testing.T) {
+	tests := []struct {
+		n, size, hop int
+		windows      int
+	}{
+		{n: 300, size: 100, hop: 50, windows: 5},
+		{n: 301, size: 100, hop: 50, windows: 6},
+		{n: 300, size: 100, hop: 100, windows: 3},
+		{n: 310, size: 100, hop: 100, windows: 4},
+		{n: 300, size: 50, hop: 120, windows: 3},
+		{n: 260, size: 50, hop: 120, windows: 3},
+		{n: 30, size: 128, hop: 64, windows: 1},
+		{n: 200, size: 1, hop: 1, windows: 200},
+	}
+	for _, test := range tests {
+		left, right := testRamp(test.n, 16, 7), testRamp(test.n, 16, 13)
+		stream, _ := testPCMStream(44100, 16, 64, left, right)
+		d, err := NewDecoder(bytes.NewReader(stream))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		r := d.WindowedReader(test.size, test.hop)
+		var k int
+		for ; ; k++ {
+			w, err := r.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%+v: unexpected error: %v", test, err)
+			}
+			start := k * test.hop
+			end := start + test.size
+			if end > test.n {
+				end = test.n
+			}
+			if len(w) != 2 || !equalInt32s(w[0], left[start:end]) || !equalInt32s(w[1], right[start:end]) {
+				t.Errorf("%+v: window %d does not hold samples %d to %d", test, k, start, end)
+			}
+		}
+		if k != test.windows {
+			t.Errorf("%+v: expected %d windows, got %d", test, test.windows, k)
+		}
+		if _, err := r.Next(); err != io.EOF {
+			t.Errorf("%+v: expected %v after the last window, got %v", test, io.EOF, err)
+		}
+	}
+
+	stream, _ := testPCMStream(44100, 16, 64, testRamp(100, 16, 7))
+	d, err := NewDecoder(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := d.WindowedReader(64, 0).Next(); err == nil {
+		t.Errorf("Expected an error for a hop of 0")
+	}
+}
+
+func equalInt32s(a, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}